@@ -0,0 +1,549 @@
+package main
+
+import (
+	"math"
+	"slices"
+)
+
+// The screen modes GRAPHIC can select
+const (
+	GRAPHIC_TEXT = 0
+	GRAPHIC_BITMAP = 1
+	GRAPHIC_SPLIT_BITMAP = 2
+	GRAPHIC_MULTICOLOR = 3
+	GRAPHIC_SPLIT_MULTICOLOR = 4
+	GRAPHIC_TEXT_80 = 5
+
+	BITMAP_WIDTH = 320
+	BITMAP_HEIGHT = 200
+	// Split screen modes show the bitmap above this text line, and text
+	// below it
+	DEFAULT_SPLIT_LINE = 19
+	TEXT_LINES = 25
+	// SCALE 1 maps coordinates from 0 to this onto the whole bitmap
+	DEFAULT_SCALE = 1023
+	// CIRCLE draws a line between points this many degrees apart
+	DEFAULT_CIRCLE_INCREMENT = 2
+
+	// PAINT fills until it finds the colour source it is painting with,
+	// or anything which isn't background
+	PAINT_TO_SOURCE = 0
+	PAINT_TO_NONBACKGROUND = 1
+
+	// The ways GSHAPE can combine a shape with the pixels under it
+	GSHAPE_REPLACE = 0
+	GSHAPE_INVERT = 1
+	GSHAPE_OR = 2
+	GSHAPE_AND = 3
+	GSHAPE_XOR = 4
+
+	// The edges of the bitmap a point is beyond, for clipLine
+	CLIP_LEFT = 1
+	CLIP_RIGHT = 2
+	CLIP_TOP = 4
+	CLIP_BOTTOM = 8
+)
+
+// BasicBitmap is the high resolution screen drawn on by GRAPHIC, DRAW, BOX,
+// CIRCLE and PAINT. It doesn't know how to display itself, the frontend
+// does that whenever it is dirty.
+type BasicBitmap struct {
+	mode int64
+	splitLine int64
+	// The bitmap isn't allocated until a graphic mode is used, and
+	// GRAPHIC CLR frees it again
+	allocated bool
+	pixels []byte
+	// The colour each pixel was drawn in. Background pixels are always
+	// shown in the current background colour.
+	pixelColors []byte
+	colors *[COLOR_SOURCES]int64
+	dirty bool
+
+	// The pixel cursor, in the coordinates programs use
+	cursorX float64
+	cursorY float64
+
+	scaling bool
+	scaleX float64
+	scaleY float64
+}
+
+func (self *BasicBitmap) init(colors *[COLOR_SOURCES]int64) {
+	self.colors = colors
+	self.mode = GRAPHIC_TEXT
+	self.splitLine = DEFAULT_SPLIT_LINE
+	self.allocated = false
+	self.pixels = nil
+	self.pixelColors = nil
+	self.dirty = true
+	self.cursorX = 0
+	self.cursorY = 0
+	self.scaling = false
+	self.scaleX = DEFAULT_SCALE
+	self.scaleY = DEFAULT_SCALE
+}
+
+func (self *BasicBitmap) allocate() {
+	if ( !self.allocated ) {
+		self.pixels = make([]byte, BITMAP_WIDTH * BITMAP_HEIGHT)
+		self.pixelColors = make([]byte, BITMAP_WIDTH * BITMAP_HEIGHT)
+		self.allocated = true
+	}
+}
+
+func (self *BasicBitmap) free() {
+	self.pixels = nil
+	self.pixelColors = nil
+	self.allocated = false
+	self.mode = GRAPHIC_TEXT
+	self.dirty = true
+}
+
+func (self *BasicBitmap) clear() {
+	clear(self.pixels)
+	self.dirty = true
+}
+
+// visible returns true when the current mode shows the bitmap
+func (self *BasicBitmap) visible() bool {
+	return ( self.mode != GRAPHIC_TEXT && self.mode != GRAPHIC_TEXT_80 )
+}
+
+// split returns true when the current mode shows text below the bitmap
+func (self *BasicBitmap) split() bool {
+	return ( self.mode == GRAPHIC_SPLIT_BITMAP || self.mode == GRAPHIC_SPLIT_MULTICOLOR )
+}
+
+func (self *BasicBitmap) multicolor() bool {
+	return ( self.mode == GRAPHIC_MULTICOLOR || self.mode == GRAPHIC_SPLIT_MULTICOLOR )
+}
+
+// width returns how many pixels wide the bitmap is in the current mode.
+// Multicolour pixels are twice as wide as high resolution ones.
+func (self *BasicBitmap) width() int {
+	if ( self.multicolor() ) {
+		return BITMAP_WIDTH / 2
+	}
+	return BITMAP_WIDTH
+}
+
+// toPixel turns coordinates a program uses into a pixel of the bitmap
+func (self *BasicBitmap) toPixel(x float64, y float64) (int, int) {
+	if ( self.scaling ) {
+		x = x * float64(self.width()) / (self.scaleX + 1)
+		y = y * float64(BITMAP_HEIGHT) / (self.scaleY + 1)
+	}
+	return int(math.Floor(x)), int(math.Floor(y))
+}
+
+// toPixelDistance scales a radius the same way toPixel scales coordinates
+func (self *BasicBitmap) toPixelDistance(x float64, y float64) (float64, float64) {
+	if ( self.scaling ) {
+		x = x * float64(self.width()) / (self.scaleX + 1)
+		y = y * float64(BITMAP_HEIGHT) / (self.scaleY + 1)
+	}
+	return x, y
+}
+
+// plot sets a pixel to a colour source. Pixels off the bitmap are ignored.
+func (self *BasicBitmap) plot(x int, y int, source byte) {
+	if ( x < 0 || y < 0 || x >= self.width() || y >= BITMAP_HEIGHT ) {
+		return
+	}
+	if ( self.multicolor() ) {
+		self.set((y * BITMAP_WIDTH) + (x * 2), source)
+		self.set((y * BITMAP_WIDTH) + (x * 2) + 1, source)
+	} else {
+		self.set((y * BITMAP_WIDTH) + x, source)
+	}
+	self.dirty = true
+}
+
+func (self *BasicBitmap) set(index int, source byte) {
+	self.pixels[index] = source
+	self.pixelColors[index] = byte(self.colors[source])
+}
+
+// color returns the colour a pixel is shown in
+func (self *BasicBitmap) color(index int) int64 {
+	if ( self.pixels[index] == COLOR_SOURCE_BACKGROUND ) {
+		return self.colors[COLOR_SOURCE_BACKGROUND]
+	}
+	return int64(self.pixelColors[index])
+}
+
+// point returns the colour source of a pixel, or background for pixels
+// off the bitmap
+func (self *BasicBitmap) point(x int, y int) byte {
+	if ( x < 0 || y < 0 || x >= self.width() || y >= BITMAP_HEIGHT ) {
+		return COLOR_SOURCE_BACKGROUND
+	}
+	if ( self.multicolor() ) {
+		return self.pixels[(y * BITMAP_WIDTH) + (x * 2)]
+	}
+	return self.pixels[(y * BITMAP_WIDTH) + x]
+}
+
+// line draws a line between two pixels. Only the part of it on the bitmap
+// is drawn.
+func (self *BasicBitmap) line(x1 int, y1 int, x2 int, y2 int, source byte) {
+	var dx int
+	var dy int
+	var stepx int = 1
+	var stepy int = 1
+	var fraction int
+	var visible bool
+
+	x1, y1, x2, y2, visible = self.clipLine(x1, y1, x2, y2)
+	if ( !visible ) {
+		return
+	}
+	dx = x2 - x1
+	dy = y2 - y1
+	if ( dx < 0 ) {
+		dx = -dx
+		stepx = -1
+	}
+	if ( dy < 0 ) {
+		dy = -dy
+		stepy = -1
+	}
+	self.plot(x1, y1, source)
+	if ( dx >= dy ) {
+		fraction = dy - (dx / 2)
+		for ( x1 != x2 ) {
+			if ( fraction >= 0 ) {
+				y1 += stepy
+				fraction -= dx
+			}
+			x1 += stepx
+			fraction += dy
+			self.plot(x1, y1, source)
+		}
+	} else {
+		fraction = dx - (dy / 2)
+		for ( y1 != y2 ) {
+			if ( fraction >= 0 ) {
+				x1 += stepx
+				fraction -= dy
+			}
+			y1 += stepy
+			fraction += dx
+			self.plot(x1, y1, source)
+		}
+	}
+}
+
+// clipLine cuts a line down to the part of it on the bitmap, and returns
+// false if none of it is
+func (self *BasicBitmap) clipLine(x1 int, y1 int, x2 int, y2 int) (int, int, int, int, bool) {
+	var fx1 float64 = float64(x1)
+	var fy1 float64 = float64(y1)
+	var fx2 float64 = float64(x2)
+	var fy2 float64 = float64(y2)
+	var right float64 = float64(self.width() - 1)
+	var bottom float64 = BITMAP_HEIGHT - 1
+	var code1 int = self.clipCode(fx1, fy1)
+	var code2 int = self.clipCode(fx2, fy2)
+	var code int
+	var x float64
+	var y float64
+
+	for ( code1 != 0 || code2 != 0 ) {
+		if ( code1 & code2 != 0 ) {
+			// Both ends are beyond the same edge
+			return 0, 0, 0, 0, false
+		}
+		code = code1
+		if ( code == 0 ) {
+			code = code2
+		}
+		// Move the end beyond an edge to where the line crosses it.
+		// Crossings are rounded to whole pixels, so a crossing on the
+		// bitmap stays on it.
+		switch {
+		case code & CLIP_TOP != 0:
+			x = math.Round(fx1 + ((fx2 - fx1) * (0 - fy1) / (fy2 - fy1)))
+			y = 0
+		case code & CLIP_BOTTOM != 0:
+			x = math.Round(fx1 + ((fx2 - fx1) * (bottom - fy1) / (fy2 - fy1)))
+			y = bottom
+		case code & CLIP_RIGHT != 0:
+			x = right
+			y = math.Round(fy1 + ((fy2 - fy1) * (right - fx1) / (fx2 - fx1)))
+		default:
+			x = 0
+			y = math.Round(fy1 + ((fy2 - fy1) * (0 - fx1) / (fx2 - fx1)))
+		}
+		if ( code == code1 ) {
+			fx1, fy1 = x, y
+			code1 = self.clipCode(fx1, fy1)
+		} else {
+			fx2, fy2 = x, y
+			code2 = self.clipCode(fx2, fy2)
+		}
+	}
+	return int(fx1), int(fy1), int(fx2), int(fy2), true
+}
+
+// clipCode returns the edges of the bitmap a point is beyond
+func (self *BasicBitmap) clipCode(x float64, y float64) int {
+	var code int = 0
+	if ( x < 0 ) {
+		code |= CLIP_LEFT
+	} else if ( x > float64(self.width() - 1) ) {
+		code |= CLIP_RIGHT
+	}
+	if ( y < 0 ) {
+		code |= CLIP_TOP
+	} else if ( y > BITMAP_HEIGHT - 1 ) {
+		code |= CLIP_BOTTOM
+	}
+	return code
+}
+
+// polygon draws lines joining each of the points, and the last point to
+// the first. When fill is set the inside is filled too.
+func (self *BasicBitmap) polygon(xs []float64, ys []float64, source byte, fill bool) {
+	var i int
+	var j int
+	var y int
+	var x int
+	var top float64 = BITMAP_HEIGHT
+	var bottom float64 = 0
+	var crossings []float64
+	var row float64
+	var left int
+	var right int
+
+	for i = 0; i < len(xs); i++ {
+		j = (i + 1) % len(xs)
+		self.line(
+			int(math.Round(xs[i])), int(math.Round(ys[i])),
+			int(math.Round(xs[j])), int(math.Round(ys[j])),
+			source)
+		top = math.Min(top, ys[i])
+		bottom = math.Max(bottom, ys[i])
+	}
+	if ( !fill ) {
+		return
+	}
+	// Fill each row between the pairs of edges which cross it, leaving
+	// out the rows and columns that aren't on the bitmap
+	top = math.Max(top, 0)
+	bottom = math.Min(bottom, BITMAP_HEIGHT - 1)
+	for y = int(math.Ceil(top)); y <= int(math.Floor(bottom)); y++ {
+		row = float64(y)
+		crossings = crossings[:0]
+		for i = 0; i < len(xs); i++ {
+			j = (i + 1) % len(xs)
+			if ( (ys[i] <= row && ys[j] > row) || (ys[j] <= row && ys[i] > row) ) {
+				crossings = append(crossings, xs[i] + ((row - ys[i]) * (xs[j] - xs[i]) / (ys[j] - ys[i])))
+			}
+		}
+		slices.Sort(crossings)
+		for i = 0; i + 1 < len(crossings); i += 2 {
+			left = int(math.Max(math.Round(crossings[i]), 0))
+			right = int(math.Min(math.Round(crossings[i + 1]), float64(self.width() - 1)))
+			for x = left; x <= right; x++ {
+				self.plot(x, y, source)
+			}
+		}
+	}
+}
+
+// box draws the rectangle with corners at two pixels, turned clockwise by
+// angle degrees around its centre
+func (self *BasicBitmap) box(x1 int, y1 int, x2 int, y2 int, angle float64, source byte, fill bool) {
+	var centreX float64 = float64(x1 + x2) / 2
+	var centreY float64 = float64(y1 + y2) / 2
+	var xs = []float64{float64(x1), float64(x2), float64(x2), float64(x1)}
+	var ys = []float64{float64(y1), float64(y1), float64(y2), float64(y2)}
+	var i int
+
+	for i = 0; i < len(xs); i++ {
+		xs[i], ys[i] = rotatePoint(xs[i] - centreX, ys[i] - centreY, angle)
+		xs[i] += centreX
+		ys[i] += centreY
+	}
+	self.polygon(xs, ys, source, fill)
+}
+
+// circle draws the part of an ellipse from startAngle to endAngle degrees,
+// where 0 is the top and angles go clockwise. The ellipse is turned
+// clockwise by angle degrees, and drawn as lines between points increment
+// degrees apart.
+func (self *BasicBitmap) circle(x int, y int, radiusX float64, radiusY float64, startAngle float64, endAngle float64, angle float64, increment float64, source byte) {
+	var lastX int
+	var lastY int
+	var nextX int
+	var nextY int
+	var px float64
+	var py float64
+	var theta float64 = startAngle
+
+	if ( endAngle < startAngle ) {
+		endAngle += 360
+	}
+	px, py = rotatePoint(radiusX * math.Sin(theta * math.Pi / 180), -radiusY * math.Cos(theta * math.Pi / 180), angle)
+	lastX = x + int(math.Round(px))
+	lastY = y + int(math.Round(py))
+	self.plot(lastX, lastY, source)
+	for ( theta < endAngle ) {
+		theta = math.Min(theta + increment, endAngle)
+		px, py = rotatePoint(radiusX * math.Sin(theta * math.Pi / 180), -radiusY * math.Cos(theta * math.Pi / 180), angle)
+		nextX = x + int(math.Round(px))
+		nextY = y + int(math.Round(py))
+		self.line(lastX, lastY, nextX, nextY, source)
+		lastX = nextX
+		lastY = nextY
+	}
+}
+
+// paint flood fills the area around a pixel. The area ends at pixels of
+// the colour source being painted with, or at any pixel which isn't
+// background, depending on mode.
+func (self *BasicBitmap) paint(x int, y int, source byte, mode int64) {
+	var stack [][2]int
+	var pixel [2]int
+	var seen []bool = make([]bool, self.width() * BITMAP_HEIGHT)
+
+	stack = append(stack, [2]int{x, y})
+	for ( len(stack) > 0 ) {
+		pixel = stack[len(stack) - 1]
+		stack = stack[:len(stack) - 1]
+		x = pixel[0]
+		y = pixel[1]
+		if ( x < 0 || y < 0 || x >= self.width() || y >= BITMAP_HEIGHT ) {
+			continue
+		}
+		if ( seen[(y * self.width()) + x] || self.isBoundary(x, y, source, mode) ) {
+			continue
+		}
+		seen[(y * self.width()) + x] = true
+		self.plot(x, y, source)
+		stack = append(stack, [2]int{x + 1, y}, [2]int{x - 1, y}, [2]int{x, y + 1}, [2]int{x, y - 1})
+	}
+}
+
+func (self *BasicBitmap) isBoundary(x int, y int, source byte, mode int64) bool {
+	if ( mode == PAINT_TO_NONBACKGROUND ) {
+		return ( self.point(x, y) != COLOR_SOURCE_BACKGROUND )
+	}
+	return ( self.point(x, y) == source )
+}
+
+// pixelBits returns how many bits a shape uses for each pixel: one for
+// foreground or background, or two for a multicolour colour source
+func (self *BasicBitmap) pixelBits() int {
+	if ( self.multicolor() ) {
+		return 2
+	}
+	return 1
+}
+
+// shape returns the pixels from x1, y1 to x2, y2 in the form SSHAPE makes:
+// each row of pixels with the leftmost in the highest bit, followed by the
+// width in bits and the height, less one, low byte first. The part of the
+// rectangle off the bitmap is left out, and false is returned if all of it
+// is.
+func (self *BasicBitmap) shape(x1 int, y1 int, x2 int, y2 int) (string, bool) {
+	var bits int = self.pixelBits()
+	var width int
+	var height int
+	var rowBytes int
+	var shape []byte
+	var value byte
+	var bit int
+	var x int
+	var y int
+
+	if ( x1 > x2 ) {
+		x1, x2 = x2, x1
+	}
+	if ( y1 > y2 ) {
+		y1, y2 = y2, y1
+	}
+	x1 = max(x1, 0)
+	y1 = max(y1, 0)
+	x2 = min(x2, self.width() - 1)
+	y2 = min(y2, BITMAP_HEIGHT - 1)
+	if ( x1 > x2 || y1 > y2 ) {
+		return "", false
+	}
+	width = (x2 - x1 + 1) * bits
+	height = y2 - y1 + 1
+	rowBytes = (width + 7) / 8
+	shape = make([]byte, rowBytes * height, (rowBytes * height) + 4)
+	for y = 0; y < height; y++ {
+		for x = 0; x < width / bits; x++ {
+			value = self.point(x1 + x, y1 + y)
+			if ( bits == 1 && value != COLOR_SOURCE_BACKGROUND ) {
+				value = 1
+			}
+			bit = x * bits
+			shape[(y * rowBytes) + (bit / 8)] |= value << (8 - bits - (bit % 8))
+		}
+	}
+	shape = append(shape, byte((width - 1) & 0xFF), byte((width - 1) >> 8),
+		byte((height - 1) & 0xFF), byte((height - 1) >> 8))
+	return bytesString(shape), true
+}
+
+// stamp draws a shape made by shape with its top left corner at x, y,
+// combining it with the pixels already there. It returns false if the
+// string isn't a shape.
+func (self *BasicBitmap) stamp(text string, x int, y int, mode int64) bool {
+	var shape []byte
+	var isShape bool
+	var bits int = self.pixelBits()
+	var mask byte = byte((1 << bits) - 1)
+	var width int
+	var height int
+	var rowBytes int
+	var value byte
+	var current byte
+	var bit int
+	var column int
+	var row int
+
+	shape, isShape = stringBytes(text)
+	if ( !isShape || len(shape) < 4 ) {
+		return false
+	}
+	width = int(shape[len(shape) - 4]) + (int(shape[len(shape) - 3]) << 8) + 1
+	height = int(shape[len(shape) - 2]) + (int(shape[len(shape) - 1]) << 8) + 1
+	rowBytes = (width + 7) / 8
+	if ( len(shape) - 4 < rowBytes * height ) {
+		return false
+	}
+	for row = 0; row < height; row++ {
+		for column = 0; column < width / bits; column++ {
+			bit = column * bits
+			value = (shape[(row * rowBytes) + (bit / 8)] >> (8 - bits - (bit % 8))) & mask
+			current = self.point(x + column, y + row)
+			if ( bits == 1 && current != COLOR_SOURCE_BACKGROUND ) {
+				current = 1
+			}
+			switch ( mode ) {
+			case GSHAPE_INVERT: value = ^value & mask
+			case GSHAPE_OR: value = current | value
+			case GSHAPE_AND: value = current & value
+			case GSHAPE_XOR: value = current ^ value
+			}
+			if ( bits == 1 && value != 0 ) {
+				value = COLOR_SOURCE_FOREGROUND
+			}
+			self.plot(x + column, y + row, value)
+		}
+	}
+	return true
+}
+
+// rotatePoint turns a point clockwise around the origin by angle degrees
+func rotatePoint(x float64, y float64, angle float64) (float64, float64) {
+	var sin float64 = math.Sin(angle * math.Pi / 180)
+	var cos float64 = math.Cos(angle * math.Pi / 180)
+	return (x * cos) - (y * sin), (x * sin) + (y * cos)
+}
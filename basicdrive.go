@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BasicDrive is the directory which the file names used by BASIC programs
+// are relative to. A name can't reach outside of it unless anyPath is set.
+type BasicDrive struct {
+	root string
+	anyPath bool
+}
+
+func (self *BasicDrive) init(root string) {
+	self.root = filepath.Clean(root)
+}
+
+// resolve returns the path of the file called name on the drive. A name
+// which goes through a symlink to somewhere outside of the drive is not
+// on the drive.
+func (self *BasicDrive) resolve(name string) (string, error) {
+	var path string
+
+	if ( len(name) == 0 ) {
+		return "", newBasicRuntimeError(MISSING_FILE_NAME, "Expected a file name")
+	}
+	if ( filepath.IsAbs(name) ) {
+		if ( self.anyPath ) {
+			return filepath.Clean(name), nil
+		}
+		return "", newBasicRuntimeError(IO, "%s is not on the drive", name)
+	}
+	path = filepath.Join(self.root, name)
+	if ( self.anyPath ) {
+		return path, nil
+	}
+	if ( !self.contains(path) ) {
+		return "", newBasicRuntimeError(IO, "%s is not on the drive", name)
+	}
+	return path, nil
+}
+
+// contains reports whether path is inside of the drive once any symlinks
+// along it have been followed
+func (self *BasicDrive) contains(path string) bool {
+	var root string
+	var err error = nil
+
+	if ( !isWithin(self.root, path) ) {
+		return false
+	}
+	root, err = realPath(self.root)
+	if ( err != nil ) {
+		return false
+	}
+	path, err = realPath(path)
+	if ( err != nil ) {
+		return false
+	}
+	return isWithin(root, path)
+}
+
+// isWithin reports whether path is root or is below it
+func isWithin(root string, path string) bool {
+	var rel string
+	var err error = nil
+
+	rel, err = filepath.Rel(root, path)
+	return ( err == nil && rel != ".." && !strings.HasPrefix(rel, ".." + string(filepath.Separator)) )
+}
+
+// realPath returns path with all of its symlinks followed. The end of the
+// path which doesn't exist yet, such as the name of a file about to be
+// written, is kept as it is. A symlink to something which doesn't exist
+// is an error, as creating the file would follow it.
+func realPath(path string) (string, error) {
+	var real string
+	var rest string = ""
+	var parent string
+	var err error = nil
+
+	for {
+		real, err = filepath.EvalSymlinks(path)
+		if ( err == nil ) {
+			// The drive and the symlinks may be relative or absolute
+			return filepath.Abs(filepath.Join(real, rest))
+		}
+		if ( !errors.Is(err, fs.ErrNotExist) ) {
+			return "", err
+		}
+		_, err = os.Lstat(path)
+		if ( !errors.Is(err, fs.ErrNotExist) ) {
+			return "", fs.ErrInvalid
+		}
+		parent = filepath.Dir(path)
+		if ( parent == path ) {
+			return "", fs.ErrNotExist
+		}
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = parent
+	}
+}
+
+// glob returns the paths of the files on the drive which match pattern,
+// which may use * and ?
+func (self *BasicDrive) glob(pattern string) ([]string, error) {
+	var path string
+	var err error = nil
+
+	var matches []string
+	var contained []string
+
+	path, err = self.resolve(pattern)
+	if ( err != nil ) {
+		return nil, err
+	}
+	matches, err = filepath.Glob(path)
+	if ( err != nil || self.anyPath ) {
+		return matches, err
+	}
+	for _, path = range matches {
+		if ( self.contains(path) ) {
+			contained = append(contained, path)
+		}
+	}
+	return contained, nil
+}
+
+// name returns the name a BASIC program uses for the file at path
+func (self *BasicDrive) name(path string) string {
+	var rel string
+	var err error = nil
+
+	rel, err = filepath.Rel(self.root, path)
+	if ( err != nil ) {
+		return path
+	}
+	return rel
+}
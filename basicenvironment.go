@@ -15,6 +15,9 @@ type BasicEnvironment struct {
 	ifThenLine int64
 	ifElseLine int64
 	ifCondition BasicASTLeaf
+	// Set when an IF condition was false and control jumped forward
+	// to an ELSE statement later on the same line
+	ifTakeElse bool
 	
 	
 	// FOR variables
@@ -27,14 +30,18 @@ type BasicEnvironment struct {
 
 	// Loop variables
 	loopFirstLine int64
+	loopFirstStatement int64
 	loopExitLine int64
+	loopExitStatement int64
+	// The command which closes the loop in this environment (NEXT or LOOP)
+	loopEndCommand string
+	// Set by EXIT. The loop ends the next time loopEndCommand is reached.
+	loopExiting bool
+	// The number of nested DO statements skipped while waiting for LOOP
+	doNesting int64
 	
 	gosubReturnLine int64
-
-	// READ command variables
-	readReturnLine int64
-	readIdentifierLeaves [MAX_LEAVES]*BasicASTLeaf
-	readIdentifierIdx int64
+	gosubReturnStatement int64
 
 	// When this is set, no lines are executed until a COMMAND
 	// matching this string is found, then execution resumes.
@@ -47,11 +54,21 @@ type BasicEnvironment struct {
 	parent *BasicEnvironment
 	runtime *BasicRuntime
 
+	// Set on the environment for a call to a multi-line DEF subroutine.
+	// Variable lookups stop here instead of falling through to the
+	// caller, except for names declared GLOBAL or SHARED.
+	localScope bool
+	globals map[string]bool
+
 	// runtime bits
 	lineno int64
-	values [MAX_VALUES]BasicValue
-	nextvalue int
+	// Lines may contain multiple statements separated by colons. These
+	// are the index of the statement being executed on lineno, and of the
+	// next statement to be executed on nextline.
+	statement int64
+	values BasicPool[BasicValue]
 	nextline int64
+	nextstatement int64
 	errno BasicError
 	// The default behavior for evaluate() is to clone any value that comes from
 	// an identifier. This allows expressions like `I# + 1` to return a new value
@@ -62,11 +79,10 @@ type BasicEnvironment struct {
 	returnValue BasicValue
 
 	// parser bits
-	tokens [MAX_TOKENS]BasicToken	
+	tokens []BasicToken
 	nexttoken int
 	curtoken int
-	leaves [MAX_TOKENS]BasicASTLeaf
-	nextleaf int
+	leaves BasicPool[BasicASTLeaf]
 	errorToken *BasicToken
 }
 
@@ -74,53 +90,58 @@ func (self *BasicEnvironment) init(runtime *BasicRuntime, parent *BasicEnvironme
 	self.variables = make(map[string]*BasicVariable)
 	self.functions = make(map[string]*BasicFunctionDef)
 	self.labels = make(map[string]int64)
+	self.globals = make(map[string]bool)
+	self.localScope = false
 	self.parent = parent
 	self.runtime = runtime
 	self.forNextVariable = nil
 	self.forStepLeaf = nil
 	self.forToLeaf = nil
+	self.values.init(VALUE_BLOCK_SIZE)
+	self.leaves.init(LEAF_BLOCK_SIZE)
 	if ( self.parent != nil ) {
 		self.lineno = self.parent.lineno
+		self.statement = self.parent.statement
 		self.nextline = self.parent.nextline
+		self.nextstatement = self.parent.nextstatement
 		self.eval_clone_identifiers = self.parent.eval_clone_identifiers
 	} else {
 		self.lineno = 0
+		self.statement = 0
 		self.nextline = 0
+		self.nextstatement = 0
 		self.eval_clone_identifiers = true
 	}
 	self.zero_parser_variables()
 }
 
 func (self *BasicEnvironment) zero() {
-	for i, _ := range self.values {
-		self.values[i].init()
-	}
-	self.nextvalue = 0
+	self.values.reset()
 	self.errno = 0
 	self.eval_clone_identifiers = true
 }
 
 func (self *BasicEnvironment) zero_parser_variables() {
-	for i, _ := range self.leaves {
-		self.leaves[i].init(LEAF_UNDEFINED)
-	}
-	for i, _ := range self.tokens {
-		self.tokens[i].init()
-	}
+	self.leaves.reset()
+	self.tokens = self.tokens[:0]
 	self.curtoken = 0
 	self.nexttoken = 0
-	self.nextleaf = 0
 }
 
 func (self *BasicEnvironment) newValue() (*BasicValue, error) {
-       var value *BasicValue
-       if ( self.nextvalue < MAX_VALUES ) {
-               value = &self.values[self.nextvalue]
-               self.nextvalue += 1
-               value.runtime = self.runtime
-               return value, nil
-       }
-       return nil, errors.New("Maximum values per line reached")
+	var value *BasicValue = self.values.get()
+	// Values are reused, and arithmetic on mixed types adds both the
+	// integer and float parts, so nothing can be left over
+	value.zero()
+	value.init()
+	value.runtime = self.runtime
+	return value, nil
+}
+
+func (self *BasicEnvironment) newLeaf() (*BasicASTLeaf, error) {
+	var leaf *BasicASTLeaf = self.leaves.get()
+	leaf.init(LEAF_UNDEFINED)
+	return leaf, nil
 }
 
 func (self *BasicEnvironment) waitForCommand(command string) {
@@ -154,6 +175,18 @@ func (self *BasicEnvironment) isWaitingForCommand(command string) bool {
 	return false
 }
 
+// waitingEnvironment returns the environment (this one or a parent) which
+// is waiting for the given command, or nil if there isn't one.
+func (self *BasicEnvironment) waitingEnvironment(command string) *BasicEnvironment {
+	if (strings.Compare(self.waitingForCommand, command) == 0) {
+		return self
+	}
+	if ( self.parent != nil ) {
+		return self.parent.waitingEnvironment(command)
+	}
+	return nil
+}
+
 func (self *BasicEnvironment) stopWaiting(command string) {
 	//fmt.Printf("Environment %p stopped waiting for command %s\n", self, command)
 	self.waitingForCommand = ""
@@ -188,7 +221,7 @@ func (self *BasicEnvironment) getLabel(label string) (int64, error) {
 		}
 		return labelval, nil
 	}
-	return 0, fmt.Errorf("Unable to find or create label %s in environment", label)
+	return 0, newBasicRuntimeError(UNDEFD_STATEMENT, "Unable to find or create label %s in environment", label)
 }
 
 func (self *BasicEnvironment) setLabel(label string, value int64) error {
@@ -205,9 +238,16 @@ func (self *BasicEnvironment) setLabel(label string, value int64) error {
 func (self *BasicEnvironment) get(varname string) *BasicVariable {
 	var variable *BasicVariable
 	var ok bool
- 	sizes := []int64{1}
 	if variable, ok = self.variables[varname]; ok {
 		return variable
+	} else if ( self.localScope == true ) {
+		if ( self.globals[varname] == true ) {
+			variable = self.root().get(varname)
+			if ( variable == nil ) {
+				variable = self.root().create(varname)
+			}
+			return variable
+		}
 	} else if ( self.parent != nil ) {
 		variable = self.parent.get(varname)
 		if ( variable != nil ) {
@@ -215,20 +255,58 @@ func (self *BasicEnvironment) get(varname string) *BasicVariable {
 		}
 	}
 	// Don't automatically create variables unless we are the currently
-	// active environment (parents don't create variables for their children)
+	// active environment (parents don't create variables for their children).
+	// They belong to the scope, not to the loop or GOSUB that happened to
+	// be running, so that they are still there after it ends.
 	if ( self.runtime.environment == self ) {
-		self.variables[varname] = &BasicVariable{
-			name: strings.Clone(varname),
-			valuetype: TYPE_UNDEFINED,
-			runtime: self.runtime,
-			mutable: true,
-		}
-		self.variables[varname].init(self.runtime, sizes)
-		return self.variables[varname]
+		return self.scope().create(varname)
 	}
 	return nil
 }
 
+// scope returns the environment which holds the variables created here:
+// the subroutine with a local scope that is running, or the top level of
+// the program
+func (self *BasicEnvironment) scope() *BasicEnvironment {
+	if ( self.localScope == true || self.parent == nil ) {
+		return self
+	}
+	return self.parent.scope()
+}
+
+// create makes a new variable in this environment, hiding any variable
+// with the same name in a parent environment.
+func (self *BasicEnvironment) create(varname string) *BasicVariable {
+ 	sizes := []int64{1}
+	self.variables[varname] = &BasicVariable{
+		name: strings.Clone(varname),
+		valuetype: TYPE_UNDEFINED,
+		runtime: self.runtime,
+		mutable: true,
+	}
+	self.variables[varname].init(self.runtime, sizes)
+	return self.variables[varname]
+}
+
+func (self *BasicEnvironment) root() *BasicEnvironment {
+	if ( self.parent == nil ) {
+		return self
+	}
+	return self.parent.root()
+}
+
+// declareGlobal makes varname refer to the global variable of the same name
+// inside of the subroutine that is currently running. At the top level of
+// the program every variable is already global, so this does nothing.
+func (self *BasicEnvironment) declareGlobal(varname string) {
+	if ( self.localScope == true ) {
+		self.globals[varname] = true
+		delete(self.variables, varname)
+	} else if ( self.parent != nil ) {
+		self.parent.declareGlobal(varname)
+	}
+}
+
 func (self *BasicEnvironment) set(lval *BasicASTLeaf, rval *BasicValue) {
 	//fmt.Printf("Setting variable in environment: [%s] = %s\n", lval.toString(), rval.toString())
 	self.get(lval.identifier).set(rval, 0)
@@ -294,7 +372,7 @@ func (self *BasicEnvironment) assign(lval *BasicASTLeaf , rval *BasicValue) (*Ba
 		} else if ( rval.valuetype == TYPE_FLOAT ) {
 			variable.setInteger(int64(rval.floatval), subscripts...)
 		} else {
-			return nil, errors.New("Incompatible types in variable assignment")
+			return nil, newBasicRuntimeError(TYPE_MISMATCH, "Incompatible types in variable assignment")
 		}
 	case LEAF_IDENTIFIER_FLOAT:
 		if ( rval.valuetype == TYPE_INTEGER ) {
@@ -302,13 +380,13 @@ func (self *BasicEnvironment) assign(lval *BasicASTLeaf , rval *BasicValue) (*Ba
 		} else if ( rval.valuetype == TYPE_FLOAT ) {
 			variable.setFloat(rval.floatval, subscripts...)
 		} else {
-			return nil, errors.New("Incompatible types in variable assignment")
+			return nil, newBasicRuntimeError(TYPE_MISMATCH, "Incompatible types in variable assignment")
 		}
 	case LEAF_IDENTIFIER_STRING:
 		if ( rval.valuetype == TYPE_STRING ) {
 			variable.setString(strings.Clone(rval.stringval), subscripts...)
 		} else {
-			return nil, errors.New("Incompatible types in variable assignment")
+			return nil, newBasicRuntimeError(TYPE_MISMATCH, "Incompatible types in variable assignment")
 		}
 	default:
 		return nil, errors.New("Invalid assignment")		
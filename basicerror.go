@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Error numbers 1-41 match the Commodore BASIC 7.0 error catalogue so that
+// programs written for the C128 can branch on the same values of ER.
+type BasicError int
+const (
+	NOERROR    BasicError = iota  // 0
+	TOO_MANY_FILES                // 1
+	FILE_OPEN                     // 2
+	FILE_NOT_OPEN                 // 3
+	FILE_NOT_FOUND                // 4
+	DEVICE_NOT_PRESENT            // 5
+	NOT_INPUT_FILE                // 6
+	NOT_OUTPUT_FILE               // 7
+	MISSING_FILE_NAME             // 8
+	ILLEGAL_DEVICE_NUMBER         // 9
+	NEXT_WITHOUT_FOR              // 10
+	SYNTAX                        // 11
+	RETURN_WITHOUT_GOSUB          // 12
+	OUT_OF_DATA                   // 13
+	ILLEGAL_QUANTITY              // 14
+	OVERFLOW                      // 15
+	OUT_OF_MEMORY                 // 16
+	UNDEFD_STATEMENT              // 17
+	BAD_SUBSCRIPT                 // 18
+	REDIMD_ARRAY                  // 19
+	DIVISION_BY_ZERO              // 20
+	ILLEGAL_DIRECT                // 21
+	TYPE_MISMATCH                 // 22
+	STRING_TOO_LONG               // 23
+	FILE_DATA                     // 24
+	FORMULA_TOO_COMPLEX           // 25
+	CANT_CONTINUE                 // 26
+	UNDEFD_FUNCTION               // 27
+	VERIFY                        // 28
+	LOAD                          // 29
+	BREAK                         // 30
+	CANT_RESUME                   // 31
+	LOOP_NOT_FOUND                // 32
+	LOOP_WITHOUT_DO               // 33
+	DIRECT_MODE_ONLY              // 34
+	NO_GRAPHICS_AREA              // 35
+	BAD_DISK                      // 36
+	BEND_NOT_FOUND                // 37
+	LINE_NUMBER_TOO_LARGE         // 38
+	UNRESOLVED_REFERENCE          // 39
+	UNIMPLEMENTED_COMMAND         // 40
+	FILE_READ                     // 41
+	// The rest are specific to this interpreter, for errors that
+	// don't have a more specific entry in the catalogue
+	IO                            // 42
+	PARSE                         // 43
+	RUNTIME                       // 44
+	STACK_OVERFLOW                // 45
+	MAX_BASIC_ERROR               // 46
+)
+
+var basicErrorNames = [MAX_BASIC_ERROR]string{
+	"",
+	"TOO MANY FILES",
+	"FILE OPEN",
+	"FILE NOT OPEN",
+	"FILE NOT FOUND",
+	"DEVICE NOT PRESENT",
+	"NOT INPUT FILE",
+	"NOT OUTPUT FILE",
+	"MISSING FILE NAME",
+	"ILLEGAL DEVICE NUMBER",
+	"NEXT WITHOUT FOR",
+	"SYNTAX",
+	"RETURN WITHOUT GOSUB",
+	"OUT OF DATA",
+	"ILLEGAL QUANTITY",
+	"OVERFLOW",
+	"OUT OF MEMORY",
+	"UNDEF'D STATEMENT",
+	"BAD SUBSCRIPT",
+	"REDIM'D ARRAY",
+	"DIVISION BY ZERO",
+	"ILLEGAL DIRECT",
+	"TYPE MISMATCH",
+	"STRING TOO LONG",
+	"FILE DATA",
+	"FORMULA TOO COMPLEX",
+	"CAN'T CONTINUE",
+	"UNDEF'D FUNCTION",
+	"VERIFY",
+	"LOAD",
+	"BREAK",
+	"CAN'T RESUME",
+	"LOOP NOT FOUND",
+	"LOOP WITHOUT DO",
+	"DIRECT MODE ONLY",
+	"NO GRAPHICS AREA",
+	"BAD DISK",
+	"BEND NOT FOUND",
+	"LINE NUMBER TOO LARGE",
+	"UNRESOLVED REFERENCE",
+	"UNIMPLEMENTED COMMAND",
+	"FILE READ",
+	"IO",
+	"PARSE",
+	"RUNTIME",
+	"STACK OVERFLOW"}
+
+// BasicRuntimeError is returned by commands, functions and values when a
+// failure has a specific entry in the error catalogue. Any other error is
+// reported as a general RUNTIME ERROR.
+type BasicRuntimeError struct {
+	errno BasicError
+	message string
+}
+
+func newBasicRuntimeError(errno BasicError, format string, a ...any) error {
+	return &BasicRuntimeError{
+		errno: errno,
+		message: fmt.Sprintf(format, a...)}
+}
+
+func (self *BasicRuntimeError) Error() string {
+	return self.message
+}
+
+func (self BasicError) name() string {
+	if ( self <= NOERROR || self >= MAX_BASIC_ERROR ) {
+		return "UNDEF"
+	}
+	return basicErrorNames[self]
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+// The bits of the ST variable after a file operation
+const (
+	IO_STATUS_READ_TIMEOUT = 2
+	IO_STATUS_EOF = 64
+)
+
+// BasicFile is a file which a program has opened on a channel with DOPEN
+type BasicFile struct {
+	name string
+	// 'R'ead, 'W'rite, 'A'ppend or re'L'ative
+	mode byte
+	file *os.File
+	reader *bufio.Reader
+	writer *bufio.Writer
+	// Relative files are made of fixed length records, and are read and
+	// written at position, which RECORD moves
+	recordLength int64
+	position int64
+}
+
+// ioError is how an error from the operating system reaches the program
+func ioError(err error) error {
+	return newBasicRuntimeError(IO, "%s", err)
+}
+
+func (self *BasicFile) open(name string, mode byte) error {
+	var err error = nil
+	var flags int
+
+	switch ( mode ) {
+	case 'R': flags = os.O_RDONLY
+	case 'W': flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	case 'A': flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	default:
+		return errors.New("Unknown file mode")
+	}
+	self.file, err = os.OpenFile(name, flags, 0644)
+	if ( err != nil ) {
+		if ( errors.Is(err, os.ErrNotExist) ) {
+			return newBasicRuntimeError(FILE_NOT_FOUND, "%s", name)
+		}
+		return ioError(err)
+	}
+	self.name = name
+	self.mode = mode
+	if ( mode == 'R' ) {
+		self.reader = bufio.NewReader(self.file)
+	} else {
+		self.writer = bufio.NewWriter(self.file)
+	}
+	return nil
+}
+
+// openRelative opens (or creates) a relative file of records which are
+// length bytes long
+func (self *BasicFile) openRelative(name string, length int64) error {
+	var err error = nil
+
+	if ( length < 1 || length > 254 ) {
+		return newBasicRuntimeError(ILLEGAL_QUANTITY, "Record length must be from 1 to 254")
+	}
+	self.file, err = os.OpenFile(name, os.O_RDWR | os.O_CREATE, 0644)
+	if ( err != nil ) {
+		if ( errors.Is(err, os.ErrNotExist) ) {
+			return newBasicRuntimeError(FILE_NOT_FOUND, "%s", name)
+		}
+		return ioError(err)
+	}
+	self.name = name
+	self.mode = 'L'
+	self.recordLength = length
+	self.position = 0
+	return nil
+}
+
+// seek moves to byte offset (from 1) of record recno (from 1)
+func (self *BasicFile) seek(recno int64, offset int64) error {
+	if ( self.mode != 'L' ) {
+		return newBasicRuntimeError(FILE_DATA, "%s is not a relative file", self.name)
+	}
+	if ( recno < 1 || offset < 1 || offset > self.recordLength ) {
+		return newBasicRuntimeError(ILLEGAL_QUANTITY, "No byte %d in record %d of %s", offset, recno, self.name)
+	}
+	self.position = ((recno - 1) * self.recordLength) + (offset - 1)
+	return nil
+}
+
+// recordEnd is the offset of the first byte after the current record
+func (self *BasicFile) recordEnd() int64 {
+	return ((self.position / self.recordLength) + 1) * self.recordLength
+}
+
+// writeRecord writes text into the current record. A newline at the end
+// of the text finishes the record: the rest of it is filled with zeros
+// and the next write goes to the next record.
+func (self *BasicFile) writeRecord(text string) error {
+	var err error = nil
+	var data []byte = []byte(text)
+	var end int64 = self.recordEnd()
+	var finished bool = false
+
+	if ( len(data) > 0 && data[len(data) - 1] == '\n' ) {
+		data = data[:len(data) - 1]
+		finished = true
+	}
+	if ( int64(len(data)) > end - self.position ) {
+		return newBasicRuntimeError(OVERFLOW, "Record %d of %s is only %d bytes long", self.position / self.recordLength + 1, self.name, self.recordLength)
+	}
+	if ( finished ) {
+		data = append(data, make([]byte, end - self.position - int64(len(data)))...)
+	}
+	_, err = self.file.WriteAt(data, self.position)
+	if ( err != nil ) {
+		return ioError(err)
+	}
+	self.position += int64(len(data))
+	return nil
+}
+
+// readRecord reads the rest of the current field of the current record.
+// Fields end at a newline, or where the data in the record ends.
+func (self *BasicFile) readRecord() (string, int64, error) {
+	var err error = nil
+	var data []byte
+	var count int
+	var i int
+
+	data = make([]byte, self.recordEnd() - self.position)
+	count, err = self.file.ReadAt(data, self.position)
+	if ( count == 0 ) {
+		if ( err == io.EOF ) {
+			// The record isn't there
+			return "", IO_STATUS_EOF | IO_STATUS_READ_TIMEOUT, nil
+		}
+		return "", 0, ioError(err)
+	}
+	for i = 0; i < count; i++ {
+		if ( data[i] == '\n' ) {
+			self.position += int64(i + 1)
+			return string(data[:i]), self.recordStatus(), nil
+		} else if ( data[i] == 0 ) {
+			break
+		}
+	}
+	self.position = self.recordEnd()
+	return string(data[:i]), IO_STATUS_EOF, nil
+}
+
+// recordStatus sets the EOF bit when there is no more data to read in the
+// current record
+func (self *BasicFile) recordStatus() int64 {
+	var data []byte = make([]byte, 1)
+	var count int
+
+	if ( (self.position % self.recordLength) == 0 ) {
+		return IO_STATUS_EOF
+	}
+	count, _ = self.file.ReadAt(data, self.position)
+	if ( count == 0 || data[0] == 0 ) {
+		return IO_STATUS_EOF
+	}
+	return 0
+}
+
+func (self *BasicFile) close() error {
+	var err error = nil
+	var closeErr error = nil
+	if ( self.writer != nil ) {
+		err = self.writer.Flush()
+	}
+	if ( self.file != nil ) {
+		closeErr = self.file.Close()
+		if ( err == nil ) {
+			err = closeErr
+		}
+	}
+	self.file = nil
+	self.reader = nil
+	self.writer = nil
+	if ( err != nil ) {
+		return ioError(err)
+	}
+	return nil
+}
+
+func (self *BasicFile) write(text string) error {
+	var err error = nil
+	if ( self.mode == 'L' ) {
+		return self.writeRecord(text)
+	}
+	if ( self.writer == nil ) {
+		return newBasicRuntimeError(NOT_OUTPUT_FILE, "%s was not opened for writing", self.name)
+	}
+	_, err = self.writer.WriteString(text)
+	if ( err != nil ) {
+		return ioError(err)
+	}
+	return nil
+}
+
+// readLine returns the next line of the file without its line ending, and
+// the ST bits describing what happened.
+func (self *BasicFile) readLine() (string, int64, error) {
+	var line string
+	var err error = nil
+
+	if ( self.mode == 'L' ) {
+		return self.readRecord()
+	}
+	if ( self.reader == nil ) {
+		return "", 0, newBasicRuntimeError(NOT_INPUT_FILE, "%s was not opened for reading", self.name)
+	}
+	line, err = self.reader.ReadString('\n')
+	if ( err == io.EOF ) {
+		if ( len(line) == 0 ) {
+			return "", IO_STATUS_EOF | IO_STATUS_READ_TIMEOUT, nil
+		}
+		err = nil
+	} else if ( err != nil ) {
+		return "", 0, ioError(err)
+	}
+	if ( len(line) > 0 && line[len(line) - 1] == '\n' ) {
+		line = line[:len(line) - 1]
+	}
+	if ( len(line) > 0 && line[len(line) - 1] == '\r' ) {
+		line = line[:len(line) - 1]
+	}
+	return line, self.status(), nil
+}
+
+// readCharacter returns the next character of the file, and the ST bits
+// describing what happened. Files are UTF-8, the same as strings, and a
+// byte which isn't part of a UTF-8 character is read as the character
+// with that code.
+func (self *BasicFile) readCharacter() (rune, int64, error) {
+	var c rune
+	var size int
+	var data []byte = make([]byte, utf8.UTFMax)
+	var count int
+	var err error = nil
+
+	if ( self.mode == 'L' ) {
+		count, err = self.file.ReadAt(data[:min(int64(len(data)), self.recordEnd() - self.position)], self.position)
+		if ( count == 0 ) {
+			if ( err == io.EOF || err == nil ) {
+				return 0, IO_STATUS_EOF | IO_STATUS_READ_TIMEOUT, nil
+			}
+			return 0, 0, ioError(err)
+		}
+		c, size = decodeFileCharacter(data[:count])
+		self.position += int64(size)
+		return c, self.recordStatus(), nil
+	}
+	if ( self.reader == nil ) {
+		return 0, 0, newBasicRuntimeError(NOT_INPUT_FILE, "%s was not opened for reading", self.name)
+	}
+	data, err = self.reader.Peek(utf8.UTFMax)
+	if ( len(data) == 0 ) {
+		if ( err == io.EOF ) {
+			return 0, IO_STATUS_EOF | IO_STATUS_READ_TIMEOUT, nil
+		}
+		return 0, 0, ioError(err)
+	}
+	c, size = decodeFileCharacter(data)
+	self.reader.Discard(size)
+	return c, self.status(), nil
+}
+
+// decodeFileCharacter returns the character at the start of data and how
+// many bytes it uses
+func decodeFileCharacter(data []byte) (rune, int) {
+	var c rune
+	var size int
+
+	c, size = utf8.DecodeRune(data)
+	if ( c == utf8.RuneError && size == 1 ) {
+		return rune(data[0]), 1
+	}
+	return c, size
+}
+
+// status sets the EOF bit once the last byte of the file has been read,
+// the same way the Commodore does, so that a loop can stop as soon as ST
+// says there is nothing more to read.
+func (self *BasicFile) status() int64 {
+	var err error = nil
+	_, err = self.reader.Peek(1)
+	if ( err != nil ) {
+		return IO_STATUS_EOF
+	}
+	return 0
+}
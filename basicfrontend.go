@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+	goruntime "runtime"
+)
+
+// The runtime never talks to a display or a keyboard directly. Everything
+// it prints and every line it reads from the user goes through a frontend.
+type BasicFrontend interface {
+	init(runtime *BasicRuntime) error
+	close()
+	// Write text at the cursor without moving to the next line
+	Write(text string)
+	// Write text at the cursor followed by a newline
+	Println(text string)
+	// Flush anything buffered by Write and Println to the display
+	drawPrintBuffer() error
+	drawCursor() error
+	// Show the bitmap the graphics commands draw on, if the graphic mode
+	// shows it and it has changed, and the colours set by COLOR
+	drawGraphics() error
+	startTextInput()
+	// Process pending input. When the user completes a line of input
+	// it is stored in runtime.userline and runtime.lineEntered is set,
+	// even if the line is empty.
+	processEvents() error
+	// Return the next key the user presses without echoing it. When
+	// wait is false and no key has been pressed, 0 is returned.
+	getKey(wait bool) (rune, error)
+}
+
+// displayAvailable makes a best guess at whether or not we can open a
+// window. On X11/Wayland systems an SSH session or a CI box will not have
+// a display set in the environment.
+func displayAvailable() bool {
+	if ( len(os.Getenv("SDL_VIDEODRIVER")) > 0 ) {
+		// The user has told SDL what to do, trust them
+		return true
+	}
+	switch (goruntime.GOOS) {
+	case "windows": fallthrough
+	case "darwin":
+		return true
+	}
+	return ( len(os.Getenv("DISPLAY")) > 0 || len(os.Getenv("WAYLAND_DISPLAY")) > 0 )
+}
+
+// BasicConsoleFrontend is the headless frontend. Output goes to stdout
+// and input is read from stdin. Once the program first asks for input, a
+// goroutine reads stdin one character at a time into keys so that GET
+// can check for a key without waiting.
+type BasicConsoleFrontend struct {
+	runtime *BasicRuntime
+	input io.Reader
+	reading bool
+	keys chan rune
+	// Why keys was closed. Only read once keys is closed.
+	inputErr error
+	// Closed to stop reading from input
+	done chan bool
+	output io.Writer
+}
+
+func (self *BasicConsoleFrontend) init(runtime *BasicRuntime) error {
+	self.runtime = runtime
+	self.input = os.Stdin
+	self.keys = make(chan rune)
+	self.done = make(chan bool)
+	self.output = os.Stdout
+	return nil
+}
+
+// startReading starts reading keys from input, if it hasn't started yet.
+// A program which never asks for input leaves stdin alone.
+func (self *BasicConsoleFrontend) startReading() {
+	if ( !self.reading ) {
+		self.reading = true
+		go self.readKeys()
+	}
+}
+
+// readKeys sends each character of input to keys until the end of the
+// input or until done is closed. Input is read a byte at a time, so that
+// nothing past the last character sent has been taken from it.
+func (self *BasicConsoleFrontend) readKeys() {
+	var data []byte = make([]byte, 0, utf8.UTFMax)
+	var b []byte = make([]byte, 1)
+	var key rune
+	var err error
+
+	for {
+		_, err = io.ReadFull(self.input, b)
+		if ( err != nil ) {
+			self.inputErr = err
+			close(self.keys)
+			return
+		}
+		data = append(data, b[0])
+		if ( !utf8.FullRune(data) && len(data) < utf8.UTFMax ) {
+			continue
+		}
+		key, _ = utf8.DecodeRune(data)
+		data = data[:0]
+		select {
+		case self.keys <- key:
+		case <-self.done:
+			return
+		}
+	}
+}
+
+// inputError is the error to return once stdin has nothing more to give
+func (self *BasicConsoleFrontend) inputError() error {
+	if ( self.inputErr == io.EOF ) {
+		return nil
+	}
+	return self.inputErr
+}
+
+func (self *BasicConsoleFrontend) close() {
+	close(self.done)
+}
+
+func (self *BasicConsoleFrontend) Write(text string) {
+	var lastline int
+	text = stripControlCodes(text)
+	fmt.Fprint(self.output, text)
+	lastline = strings.LastIndex(text, "\n")
+	if ( lastline >= 0 ) {
+		self.runtime.cursorY += int32(strings.Count(text, "\n"))
+		self.runtime.cursorX = int32(utf8.RuneCountInString(text[lastline + 1:]))
+	} else {
+		self.runtime.cursorX += int32(utf8.RuneCountInString(text))
+	}
+}
+
+func (self *BasicConsoleFrontend) Println(text string) {
+	text = stripControlCodes(text)
+	fmt.Fprintln(self.output, text)
+	self.runtime.cursorY += int32(strings.Count(text, "\n")) + 1
+	self.runtime.cursorX = 0
+}
+
+func (self *BasicConsoleFrontend) drawPrintBuffer() error {
+	return nil
+}
+
+func (self *BasicConsoleFrontend) drawCursor() error {
+	return nil
+}
+
+func (self *BasicConsoleFrontend) drawGraphics() error {
+	return nil
+}
+
+func (self *BasicConsoleFrontend) startTextInput() {
+}
+
+func (self *BasicConsoleFrontend) processEvents() error {
+	var line strings.Builder
+	var key rune
+
+	self.startReading()
+	for key = range self.keys {
+		if ( key == '\n' ) {
+			break
+		}
+		line.WriteRune(key)
+	}
+	if ( key == '\n' || line.Len() > 0 ) {
+		self.runtime.userline = strings.TrimRight(line.String(), "\r")
+		self.runtime.lineEntered = true
+		self.runtime.cursorX = 0
+		self.runtime.cursorY += 1
+		return nil
+	}
+	// Nothing more is coming from stdin, so there is nothing left
+	// for the REPL or an INPUT statement to wait for.
+	self.runtime.setMode(MODE_QUIT)
+	return self.inputError()
+}
+
+// getKey reads the next character from stdin. When wait is false and
+// the character hasn't arrived yet, 0 is returned.
+func (self *BasicConsoleFrontend) getKey(wait bool) (rune, error) {
+	var key rune
+	var ok bool
+
+	self.startReading()
+	if ( wait ) {
+		key, ok = <-self.keys
+	} else {
+		select {
+		case key, ok = <-self.keys:
+		default:
+			return 0, nil
+		}
+	}
+	if ( !ok ) {
+		if ( wait ) {
+			self.runtime.setMode(MODE_QUIT)
+		}
+		return 0, self.inputError()
+	}
+	if ( key == '\n' ) {
+		// RETURN is CHR(13) on a Commodore
+		key = '\r'
+	}
+	return key, nil
+}
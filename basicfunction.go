@@ -4,7 +4,7 @@ type BasicFunctionDef struct {
 	arglist *BasicASTLeaf
 	expression *BasicASTLeaf
 	lineno int64
+	statement int64
 	name string
-	environment BasicEnvironment
 	runtime *BasicRuntime
 }
@@ -0,0 +1,79 @@
+package main
+
+// The colour sources COLOR sets. The graphics commands draw with the first
+// four of them.
+const (
+	COLOR_SOURCE_BACKGROUND = 0
+	COLOR_SOURCE_FOREGROUND = 1
+	COLOR_SOURCE_MULTICOLOR_1 = 2
+	COLOR_SOURCE_MULTICOLOR_2 = 3
+	COLOR_SOURCE_BORDER = 4
+	COLOR_SOURCE_CHARACTER = 5
+	COLOR_SOURCE_BACKGROUND_80 = 6
+	COLOR_SOURCES = 7
+
+	// Colours are numbered from 1, as they are on the C128
+	COLOR_BLACK = 1
+	COLOR_WHITE = 2
+	COLOR_RED = 3
+	COLOR_CYAN = 4
+	COLORS = 16
+)
+
+type BasicColor struct {
+	R uint8
+	G uint8
+	B uint8
+}
+
+// The Commodore palette. Colour n is palette[n - 1].
+var palette = [COLORS]BasicColor{
+	BasicColor{R: 0x00, G: 0x00, B: 0x00}, // Black
+	BasicColor{R: 0xFF, G: 0xFF, B: 0xFF}, // White
+	BasicColor{R: 0x88, G: 0x39, B: 0x32}, // Red
+	BasicColor{R: 0x67, G: 0xB6, B: 0xBD}, // Cyan
+	BasicColor{R: 0x8B, G: 0x3F, B: 0x96}, // Purple
+	BasicColor{R: 0x55, G: 0xA0, B: 0x49}, // Green
+	BasicColor{R: 0x40, G: 0x31, B: 0x8D}, // Blue
+	BasicColor{R: 0xBF, G: 0xCE, B: 0x72}, // Yellow
+	BasicColor{R: 0x8B, G: 0x54, B: 0x29}, // Orange
+	BasicColor{R: 0x57, G: 0x42, B: 0x00}, // Brown
+	BasicColor{R: 0xB8, G: 0x69, B: 0x62}, // Light red
+	BasicColor{R: 0x50, G: 0x50, B: 0x50}, // Dark grey
+	BasicColor{R: 0x78, G: 0x78, B: 0x78}, // Medium grey
+	BasicColor{R: 0x94, G: 0xE0, B: 0x89}, // Light green
+	BasicColor{R: 0x78, G: 0x69, B: 0xC4}, // Light blue
+	BasicColor{R: 0x9F, G: 0x9F, B: 0x9F}, // Light grey
+}
+
+// Printing one of these PETSCII control characters changes the character
+// colour instead of printing anything
+var petsciiColorCodes = map[rune]int64{
+	0x90: 1, 0x05: 2, 0x1C: 3, 0x9F: 4,
+	0x9C: 5, 0x1E: 6, 0x1F: 7, 0x9E: 8,
+	0x81: 9, 0x95: 10, 0x96: 11, 0x97: 12,
+	0x98: 13, 0x99: 14, 0x9A: 15, 0x9B: 16,
+}
+
+// defaultColors are the colours of each colour source when the
+// interpreter starts
+var defaultColors = [COLOR_SOURCES]int64{
+	COLOR_BLACK, COLOR_WHITE, COLOR_RED, COLOR_CYAN,
+	COLOR_BLACK, COLOR_WHITE, COLOR_BLACK,
+}
+
+func isColorCode(c rune) bool {
+	var exists bool
+	_, exists = petsciiColorCodes[c]
+	return exists
+}
+
+// colorCode returns the PETSCII control character which selects a colour
+func colorCode(color int64) rune {
+	for code, codeColor := range(petsciiColorCodes) {
+		if ( codeColor == color ) {
+			return code
+		}
+	}
+	return 0
+}
@@ -12,6 +12,8 @@ import (
 type BasicToken struct {
 	tokentype BasicTokenType
 	lineno int64
+	// Where the lexeme starts in the line that was scanned
+	position int
 	literal string
 	lexeme string	
 }
@@ -19,6 +21,7 @@ type BasicToken struct {
 func (self *BasicToken) init() {
 	self.tokentype = UNDEFINED
 	self.lineno = 0
+	self.position = 0
 	self.literal = ""
 	self.lexeme = ""
 }
@@ -74,14 +77,7 @@ func (self *BasicParser) zero() {
 }
 
 func (self *BasicParser) newLeaf() (*BasicASTLeaf, error) {
-	var leaf *BasicASTLeaf
-	if ( self.runtime.environment.nextleaf < MAX_LEAVES ) {
-		leaf = &self.runtime.environment.leaves[self.runtime.environment.nextleaf]
-		self.runtime.environment.nextleaf += 1
-		return leaf, nil
-	} else {
-		return nil, errors.New("No more leaves available")
-	}
+	return self.runtime.environment.newLeaf()
 }
 
 func (self *BasicParser) parse() (*BasicASTLeaf, error) {
@@ -97,7 +93,15 @@ func (self *BasicParser) parse() (*BasicASTLeaf, error) {
 }
 
 func (self *BasicParser) statement() (*BasicASTLeaf, error) {
-	return self.command()
+	var expr *BasicASTLeaf = nil
+	var err error = nil
+	expr, err = self.command()
+	if ( err != nil ) {
+		return nil, err
+	}
+	// Statements on the same line are separated by colons
+	self.match(COLON)
+	return expr, nil
 }
 
 func (self *BasicParser) commandByReflection(root string, command string) (*BasicASTLeaf, error) {
@@ -158,7 +162,9 @@ func (self *BasicParser) command() (*BasicASTLeaf, error) {
 		// some commands don't require an rval. Don't fail if there
 		// isn't one. But fail if there is one and it fails to parse.
 		righttoken = self.peek()
-		if ( righttoken != nil && righttoken.tokentype != UNDEFINED ) {
+		if ( righttoken != nil &&
+			righttoken.tokentype != UNDEFINED &&
+			righttoken.tokentype != COLON ) {
 			right, err = self.expression()
 			if ( err != nil ) {
 				return nil, err
@@ -235,14 +241,14 @@ func (self *BasicParser) argumentList(argListType BasicTokenType, requireParens
 	}
 	arglist.leaftype = LEAF_ARGUMENTLIST
 	arglist.operator = argListType
-	arglist.right, err = self.expression()
+	arglist.right, err = self.argument()
 	if ( err != nil ) {
 		return nil, err
 	}
 	expr = arglist.right
 	//fmt.Printf("Before loop: %+v\n", expr)
 	for ( expr != nil && self.match(COMMA) ) {
-		expr.right, err = self.expression()
+		expr.right, err = self.argument()
 		if ( err != nil ) {
 			return nil, err
 		}
@@ -256,6 +262,26 @@ func (self *BasicParser) argumentList(argListType BasicTokenType, requireParens
 	return arglist, nil
 }
 
+// argument parses one expression in an argument list. The arguments are
+// joined through .right, so an expression which already uses .right (a
+// binary operation, or an array reference) is wrapped in a grouping.
+func (self *BasicParser) argument() (*BasicASTLeaf, error) {
+	var expr *BasicASTLeaf = nil
+	var group *BasicASTLeaf = nil
+	var err error = nil
+
+	expr, err = self.expression()
+	if ( err != nil || expr == nil || expr.right == nil ) {
+		return expr, err
+	}
+	group, err = self.newLeaf()
+	if ( err != nil ) {
+		return nil, err
+	}
+	group.newGrouping(expr)
+	return group, nil
+}
+
 func (self *BasicParser) expression() (*BasicASTLeaf, error) {
 	return self.logicalandor()
 }
@@ -573,7 +599,11 @@ func (self *BasicParser) function() (*BasicASTLeaf, error) {
 			if ( err != nil ) {
 				return nil, err
 			}
-			leafptr = arglist.right
+			// Functions without arguments (like ER) are called without parens
+			leafptr = nil
+			if ( arglist != nil ) {
+				leafptr = arglist.right
+			}
 			for ( leafptr != nil ) {
 				defarglen += 1
 				leafptr = leafptr.right
@@ -713,7 +743,7 @@ func (self *BasicParser) advance() (*BasicToken, error) {
 }
 
 func (self *BasicParser) isAtEnd() bool {
-	if (self.runtime.environment.curtoken >= (MAX_TOKENS - 1) || self.runtime.environment.curtoken >= self.runtime.environment.nexttoken ) {
+	if ( self.runtime.environment.curtoken >= self.runtime.environment.nexttoken ) {
 		return true
 	}
 	return false
@@ -70,6 +70,15 @@ func (self *BasicParser) ParseCommandDEF() (*BasicASTLeaf, error) {
 	if ( err != nil ) {
 		return nil, errors.New("Expected argument list (identifier names)")
 	}
+	if ( arglist == nil ) {
+		// A function with no arguments
+		arglist, err = self.newLeaf()
+		if ( err != nil ) {
+			return nil, err
+		}
+		arglist.leaftype = LEAF_ARGUMENTLIST
+		arglist.operator = FUNCTION_ARGUMENT
+	}
 	expression = arglist
 	for ( expression.right != nil ) {
 		switch (expression.right.leaftype) {
@@ -103,13 +112,43 @@ func (self *BasicParser) ParseCommandDEF() (*BasicASTLeaf, error) {
 	self.runtime.environment.functions[strings.ToUpper(identifier.identifier)] = &BasicFunctionDef{
 		arglist: arglist.clone(),
 		expression: expression,
-		lineno: self.runtime.environment.lineno + 1,
+		lineno: self.runtime.environment.lineno,
+		statement: self.runtime.environment.statement + 1,
 		runtime: self.runtime,
 		name: strings.ToUpper(identifier.identifier)}
 	self.runtime.scanner.functions[strings.ToUpper(identifier.identifier)] = FUNCTION
 	return command, nil
 }
 
+func (self *BasicParser) ParseCommandGLOBAL() (*BasicASTLeaf, error) {
+	// GLOBAL  IDENTIFIER[, ...]
+	// COMMAND ARGUMENTLIST
+	var arglist *BasicASTLeaf = nil
+	var identifier *BasicASTLeaf = nil
+	var command *BasicASTLeaf = nil
+	var err error = nil
+
+	arglist, err = self.argumentList(FUNCTION_ARGUMENT, false)
+	if ( err != nil ) {
+		return nil, err
+	}
+	for identifier = arglist.right; identifier != nil; identifier = identifier.right {
+		if ( identifier.isIdentifier() == false ) {
+			return nil, errors.New("Expected GLOBAL|SHARED IDENTIFIER[, ...]")
+		}
+	}
+	command, err = self.newLeaf()
+	if ( err != nil ) {
+		return nil, err
+	}
+	command.newCommand("GLOBAL", arglist)
+	return command, nil
+}
+
+func (self *BasicParser) ParseCommandSHARED() (*BasicASTLeaf, error) {
+	return self.ParseCommandGLOBAL()
+}
+
 func (self *BasicParser) ParseCommandFOR() (*BasicASTLeaf, error) {
 	// FOR     ...        TO ....        [STEP    ...]
 	// COMMAND ASSIGNMENT    EXPRESSION  [COMMAND EXPRESSION]
@@ -160,7 +199,9 @@ func (self *BasicParser) ParseCommandFOR() (*BasicASTLeaf, error) {
 		newenv.forStepLeaf, err = self.newLeaf()
 		newenv.forStepLeaf.newLiteralInt("1")
 	}
-	newenv.loopFirstLine = (self.runtime.environment.lineno + 1)
+	newenv.loopEndCommand = "NEXT"
+	newenv.loopFirstLine = self.runtime.environment.nextline
+	newenv.loopFirstStatement = self.runtime.environment.nextstatement
 	expr, err = self.newLeaf()
 	if ( err != nil ) {
 		return nil, err
@@ -171,13 +212,79 @@ func (self *BasicParser) ParseCommandFOR() (*BasicASTLeaf, error) {
 	return expr, nil
 }
 
+func (self *BasicParser) ParseCommandDO() (*BasicASTLeaf, error) {
+	// DO      [WHILE|UNTIL EXPRESSION]
+	// COMMAND [COMMAND     EXPRESSION]
+	var condition *BasicASTLeaf = nil
+	var expr *BasicASTLeaf = nil
+	var err error = nil
+
+	condition, err = self.loopCondition()
+	if ( err != nil ) {
+		return nil, err
+	}
+	expr, err = self.newLeaf()
+	if ( err != nil ) {
+		return nil, err
+	}
+	expr.newCommand("DO", condition)
+	return expr, nil
+}
+
+func (self *BasicParser) ParseCommandLOOP() (*BasicASTLeaf, error) {
+	// LOOP    [WHILE|UNTIL EXPRESSION]
+	// COMMAND [COMMAND     EXPRESSION]
+	var condition *BasicASTLeaf = nil
+	var expr *BasicASTLeaf = nil
+	var err error = nil
+
+	condition, err = self.loopCondition()
+	if ( err != nil ) {
+		return nil, err
+	}
+	expr, err = self.newLeaf()
+	if ( err != nil ) {
+		return nil, err
+	}
+	expr.newCommand("LOOP", condition)
+	return expr, nil
+}
+
+// loopCondition parses the optional WHILE or UNTIL clause on a DO or LOOP
+// statement into a WHILE/UNTIL command leaf. Returns nil if there isn't one.
+func (self *BasicParser) loopCondition() (*BasicASTLeaf, error) {
+	var operator *BasicToken = nil
+	var condition *BasicASTLeaf = nil
+	var expr *BasicASTLeaf = nil
+	var err error = nil
+
+	if ( !self.match(COMMAND) ) {
+		return nil, nil
+	}
+	operator, err = self.previous()
+	if ( err != nil ||
+		( strings.Compare(strings.ToUpper(operator.lexeme), "WHILE") != 0 &&
+			strings.Compare(strings.ToUpper(operator.lexeme), "UNTIL") != 0 ) ) {
+		return nil, errors.New("Expected DO|LOOP [WHILE|UNTIL (expression)]")
+	}
+	condition, err = self.expression()
+	if ( err != nil ) {
+		return nil, err
+	}
+	expr, err = self.newLeaf()
+	if ( err != nil ) {
+		return nil, err
+	}
+	expr.newCommand(strings.ToUpper(operator.lexeme), condition)
+	return expr, nil
+}
+
 func (self *BasicParser) ParseCommandREAD() (*BasicASTLeaf, error) {
 	// READ          VARNAME          [, ...]
 	// COMMAND       ARGUMENTLIST
 	var argumentList *BasicASTLeaf
 	var expr *BasicASTLeaf
 	var readCommand *BasicASTLeaf
-	var i int = 0
 	var err error
 
 	argumentList, err = self.argumentList(FUNCTION_ARGUMENT, false)
@@ -187,19 +294,11 @@ func (self *BasicParser) ParseCommandREAD() (*BasicASTLeaf, error) {
 	if ( argumentList.right == nil ) {
 		return nil, errors.New("Expected identifier")
 	}
-	expr = argumentList.right
-	for i = 0; i < MAX_LEAVES ; i++ {
-		if ( expr != nil ) {
-			if ( expr.isIdentifier() == false ) {
-				return nil, errors.New("Expected identifier")
-			}
-			self.runtime.environment.readIdentifierLeaves[i] = expr.clone()
-			expr = expr.right
-		} else {
-			self.runtime.environment.readIdentifierLeaves[i] = nil
+	for expr = argumentList.right; expr != nil; expr = expr.right {
+		if ( expr.isIdentifier() == false ) {
+			return nil, errors.New("Expected identifier")
 		}
 	}
-	self.runtime.environment.readReturnLine = self.runtime.environment.lineno + 1
 	readCommand, err = self.newLeaf()
 	if ( err != nil ) {
 		return nil, err
@@ -238,6 +337,52 @@ func (self *BasicParser) ParseCommandDATA() (*BasicASTLeaf, error) {
 	return dataCommand, nil
 }
 
+func (self *BasicParser) ParseCommandON() (*BasicASTLeaf, error) {
+	// ON      EXPRESSION GOTO|GOSUB TARGET[, ...]
+	// COMMAND EXPRESSION COMMAND    ARGUMENTLIST
+	//
+	// ON(expr=SELECTOR, right=GOTO|GOSUB(right=ARGUMENTLIST))
+	var selector *BasicASTLeaf = nil
+	var targets *BasicASTLeaf = nil
+	var branch *BasicASTLeaf = nil
+	var command *BasicASTLeaf = nil
+	var operator *BasicToken = nil
+	var err error = nil
+
+	selector, err = self.expression()
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( !self.match(COMMAND) ) {
+		return nil, errors.New("Expected ON (expression) GOTO|GOSUB (target)[, ...]")
+	}
+	operator, err = self.previous()
+	if ( err != nil ||
+		( strings.Compare(strings.ToUpper(operator.lexeme), "GOTO") != 0 &&
+			strings.Compare(strings.ToUpper(operator.lexeme), "GOSUB") != 0 ) ) {
+		return nil, errors.New("Expected ON (expression) GOTO|GOSUB (target)[, ...]")
+	}
+	targets, err = self.argumentList(FUNCTION_ARGUMENT, false)
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( targets == nil || targets.right == nil ) {
+		return nil, errors.New("Expected ON (expression) GOTO|GOSUB (target)[, ...]")
+	}
+	branch, err = self.newLeaf()
+	if ( err != nil ) {
+		return nil, err
+	}
+	branch.newCommand(strings.ToUpper(operator.lexeme), targets)
+	command, err = self.newLeaf()
+	if ( err != nil ) {
+		return nil, err
+	}
+	command.newCommand("ON", branch)
+	command.expr = selector
+	return command, nil
+}
+
 func (self *BasicParser) ParseCommandPOKE() (*BasicASTLeaf, error) {
 	var arglist *BasicASTLeaf = nil
 	var expr *BasicASTLeaf = nil
@@ -254,6 +399,106 @@ func (self *BasicParser) ParseCommandPOKE() (*BasicASTLeaf, error) {
 	return expr, nil
 }
 
+func (self *BasicParser) ParseCommandPRINT() (*BasicASTLeaf, error) {
+	// PRINT   [#CHANNEL,] [USING      EXPRESSION ;] [EXPRESSION] [; | ,] ...
+	// COMMAND [CHANNEL  ] [COMMAND    EXPRESSION  ] ARGUMENTLIST
+	//
+	// PRINT(left=CHANNEL, expr=FORMAT, right=ARGUMENTLIST(GROUPING(expr=ITEM, operator=SEPARATOR), ...))
+	var format *BasicASTLeaf = nil
+	var arglist *BasicASTLeaf = nil
+	var item *BasicASTLeaf = nil
+	var last *BasicASTLeaf = nil
+	var command *BasicASTLeaf = nil
+	var operator *BasicToken = nil
+	var channel *BasicASTLeaf = nil
+	var err error = nil
+
+	channel, err = self.channel()
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( self.check(COMMAND) && strings.ToUpper(self.peek().lexeme) == "USING" ) {
+		self.advance()
+		format, err = self.expression()
+		if ( err != nil ) {
+			return nil, err
+		}
+		if ( !self.match(SEMICOLON, COMMA) ) {
+			return nil, errors.New("Expected PRINT USING (format); (expression)")
+		}
+	}
+	arglist, err = self.newLeaf()
+	if ( err != nil ) {
+		return nil, err
+	}
+	arglist.leaftype = LEAF_ARGUMENTLIST
+	arglist.operator = FUNCTION_ARGUMENT
+	last = arglist
+	for ( !self.isAtEnd() && !self.check(COLON) ) {
+		if ( !self.check(SEMICOLON) && !self.check(COMMA) ) {
+			if ( self.check(COMMAND) ) {
+				// ELSE after PRINT in an IF ... THEN
+				break
+			}
+			item, err = self.expression()
+			if ( err != nil ) {
+				return nil, err
+			}
+		} else {
+			item = nil
+		}
+		last.right, err = self.newLeaf()
+		if ( err != nil ) {
+			return nil, err
+		}
+		last = last.right
+		// The item and the separator following it travel together
+		// in a grouping, since .right is used to chain the items.
+		last.init(LEAF_GROUPING)
+		last.expr = item
+		if ( self.match(SEMICOLON, COMMA) ) {
+			operator, err = self.previous()
+			if ( err != nil ) {
+				return nil, err
+			}
+			last.operator = operator.tokentype
+		} else if ( !self.isAtEnd() && !self.check(COLON) && !self.check(COMMAND) ) {
+			// Items with nothing between them, like TAB(5) "X",
+			// are printed as if they were separated by ;
+			last.operator = SEMICOLON
+		}
+	}
+	command, err = self.newLeaf()
+	if ( err != nil ) {
+		return nil, err
+	}
+	command.newCommand("PRINT", arglist)
+	command.expr = format
+	command.left = channel
+	return command, nil
+}
+
+func (self *BasicParser) ParseCommandRENUMBER() (*BasicASTLeaf, error) {
+	// RENUMBER          [NEW START[, INCREMENT[, OLD START]]]
+	// COMMAND_IMMEDIATE [ARGUMENTLIST]
+	var arglist *BasicASTLeaf = nil
+	var expr *BasicASTLeaf = nil
+	var err error = nil
+
+	if ( !self.isAtEnd() && self.peek().tokentype != COLON ) {
+		arglist, err = self.argumentList(FUNCTION_ARGUMENT, false)
+		if ( err != nil ) {
+			return nil, err
+		}
+	}
+	expr, err = self.newLeaf()
+	if ( err != nil ) {
+		return nil, err
+	}
+	expr.newImmediateCommand("RENUMBER", arglist)
+	return expr, nil
+}
+
 func (self *BasicParser) ParseCommandIF() (*BasicASTLeaf, error) {
 	// IF      ...          THEN      ....                [ : ELSE    .... ]
 	// COMMAND RELATION     COMMAND   COMMAND EXPRESSION  [ : COMMAND EXPRESSION ]
@@ -299,32 +544,679 @@ func (self *BasicParser) ParseCommandIF() (*BasicASTLeaf, error) {
 	return branch, nil
 }
 
+func (self *BasicParser) ParseCommandELSE() (*BasicASTLeaf, error) {
+	// IF ... THEN ... : ELSE    ....
+	//                   COMMAND COMMAND
+	var else_command *BasicASTLeaf = nil
+	var expr *BasicASTLeaf = nil
+	var err error = nil
+
+	else_command, err = self.command()
+	if ( err != nil ) {
+		return nil, errors.New("Expected IF ... THEN ... ELSE ...")
+	}
+	expr, err = self.newLeaf()
+	if ( err != nil ) {
+		return nil, err
+	}
+	expr.newCommand("ELSE", else_command)
+	return expr, nil
+}
+
+func (self *BasicParser) ParseCommandRESUME() (*BasicASTLeaf, error) {
+	// RESUME  [NEXT    | EXPRESSION]
+	// COMMAND [COMMAND | EXPRESSION]
+	var target *BasicASTLeaf = nil
+	var expr *BasicASTLeaf = nil
+	var operator *BasicToken = nil
+	var err error = nil
+
+	if ( self.match(COMMAND) ) {
+		operator, err = self.previous()
+		if ( err != nil || strings.Compare(strings.ToUpper(operator.lexeme), "NEXT") != 0 ) {
+			return nil, errors.New("Expected RESUME [NEXT | (line)]")
+		}
+		target, err = self.newLeaf()
+		if ( err != nil ) {
+			return nil, err
+		}
+		target.newCommand("NEXT", nil)
+	} else if ( !self.isAtEnd() && self.peek().tokentype != COLON ) {
+		target, err = self.expression()
+		if ( err != nil ) {
+			return nil, err
+		}
+	}
+	expr, err = self.newLeaf()
+	if ( err != nil ) {
+		return nil, err
+	}
+	expr.newCommand("RESUME", target)
+	return expr, nil
+}
+
 func (self *BasicParser) ParseCommandINPUT() (*BasicASTLeaf, error) {
-	// INPUT             "PROMPT",    VARIABLE
-	// COMMAND           EXPRESSION   IDENTIFIER
-	var identifier *BasicASTLeaf = nil
+	// INPUT   [#CHANNEL, | "PROMPT"[; | ,]] VARIABLE[, ...]
+	// COMMAND [CHANNEL   | EXPRESSION     ] ARGUMENTLIST
+	//
+	// INPUT(left=CHANNEL, expr=PROMPT, right=ARGUMENTLIST(GROUPING(expr=VARIABLE), ...))
 	var promptexpr *BasicASTLeaf = nil
+	var channel *BasicASTLeaf = nil
+	var arglist *BasicASTLeaf = nil
 	var command *BasicASTLeaf = nil
 	var err error = nil
 
-	promptexpr, err = self.expression()
+	channel, err = self.channel()
 	if ( err != nil ) {
 		return nil, err
 	}
-	identifier, err = self.primary()
+	if ( channel == nil && self.check(LITERAL_STRING) ) {
+		promptexpr, err = self.expression()
+		if ( err != nil ) {
+			return nil, err
+		}
+		self.match(SEMICOLON, COMMA)
+	}
+	arglist, err = self.identifierList()
 	if ( err != nil ) {
 		return nil, err
 	}
-	if ( identifier.isIdentifier() == false ) {
-		return nil, errors.New("Expected identifier")
+	command, err = self.newLeaf()
+	if ( err != nil ) {
+		return nil, err
+	}
+	command.newCommand("INPUT", arglist)
+	command.expr = promptexpr
+	command.left = channel
+	return command, nil
+}
+
+func (self *BasicParser) ParseCommandGET() (*BasicASTLeaf, error) {
+	// GET     [#CHANNEL,] VARIABLE[, ...]
+	// COMMAND [CHANNEL  ] ARGUMENTLIST
+	var arglist *BasicASTLeaf = nil
+	var channel *BasicASTLeaf = nil
+	var command *BasicASTLeaf = nil
+	var err error = nil
+
+	channel, err = self.channel()
+	if ( err != nil ) {
+		return nil, err
+	}
+	arglist, err = self.identifierList()
+	if ( err != nil ) {
+		return nil, err
 	}
 	command, err = self.newLeaf()
 	if ( err != nil ) {
 		return nil, err
 	}
+	command.newCommand("GET", arglist)
+	command.left = channel
+	return command, nil
+}
 
-	command.newCommand("INPUT", identifier)
-	identifier.left = promptexpr
+func (self *BasicParser) ParseCommandGETKEY() (*BasicASTLeaf, error) {
+	var command *BasicASTLeaf = nil
+	var err error = nil
+
+	command, err = self.ParseCommandGET()
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( command.left != nil ) {
+		return nil, errors.New("GETKEY can not read from a channel")
+	}
+	command.identifier = "GETKEY"
 	return command, nil
-	
+}
+
+// channel parses the #CHANNEL[,] which PRINT, INPUT, GET and the disk
+// commands use to pick an open file. It returns nil if there isn't one.
+func (self *BasicParser) channel() (*BasicASTLeaf, error) {
+	var expr *BasicASTLeaf = nil
+	var err error = nil
+
+	if ( !self.match(HASH) ) {
+		return nil, nil
+	}
+	expr, err = self.expression()
+	if ( err != nil ) {
+		return nil, err
+	}
+	self.match(COMMA)
+	return expr, nil
+}
+
+func (self *BasicParser) ParseCommandDOPEN() (*BasicASTLeaf, error) {
+	// DOPEN   #CHANNEL, NAME      [, W | A | R]
+	// COMMAND CHANNEL   ARGUMENTLIST
+	//
+	// DOPEN(expr=CHANNEL, right=ARGUMENTLIST(NAME, LITERAL_STRING(OPTION), ...))
+	var channel *BasicASTLeaf = nil
+	var arglist *BasicASTLeaf = nil
+	var last *BasicASTLeaf = nil
+	var command *BasicASTLeaf = nil
+	var option *BasicToken = nil
+	var err error = nil
+
+	channel, err = self.channel()
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( channel == nil ) {
+		return nil, errors.New("Expected DOPEN #(channel), (name)")
+	}
+	arglist, err = self.newLeaf()
+	if ( err != nil ) {
+		return nil, err
+	}
+	arglist.leaftype = LEAF_ARGUMENTLIST
+	arglist.operator = FUNCTION_ARGUMENT
+	arglist.right, err = self.argument()
+	if ( err != nil ) {
+		return nil, err
+	}
+	last = arglist.right
+	for ( self.match(COMMA) ) {
+		// Options are bare words like W, which would otherwise
+		// be taken for variables
+		if ( !self.match(IDENTIFIER) ) {
+			return nil, errors.New("Expected DOPEN option")
+		}
+		option, err = self.previous()
+		if ( err != nil ) {
+			return nil, err
+		}
+		last.right, err = self.newLeaf()
+		if ( err != nil ) {
+			return nil, err
+		}
+		last = last.right
+		last.newLiteralString(strings.ToUpper(option.lexeme))
+	}
+	command, err = self.newLeaf()
+	if ( err != nil ) {
+		return nil, err
+	}
+	command.newCommand("DOPEN", arglist)
+	command.expr = channel
+	return command, nil
+}
+
+func (self *BasicParser) ParseCommandRECORD() (*BasicASTLeaf, error) {
+	// RECORD  #CHANNEL, RECORD NUMBER[, BYTE]
+	// COMMAND CHANNEL   ARGUMENTLIST
+	//
+	// RECORD(expr=CHANNEL, right=ARGUMENTLIST(RECORD NUMBER, BYTE))
+	var channel *BasicASTLeaf = nil
+	var arglist *BasicASTLeaf = nil
+	var command *BasicASTLeaf = nil
+	var err error = nil
+
+	channel, err = self.channel()
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( channel == nil ) {
+		return nil, errors.New("Expected RECORD #(channel), (record number)")
+	}
+	arglist, err = self.argumentList(FUNCTION_ARGUMENT, false)
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( arglist == nil || arglist.right == nil ) {
+		return nil, errors.New("Expected RECORD #(channel), (record number)")
+	}
+	command, err = self.newLeaf()
+	if ( err != nil ) {
+		return nil, err
+	}
+	command.newCommand("RECORD", arglist)
+	command.expr = channel
+	return command, nil
+}
+
+// fileNamePair parses the "SOURCE" TO "DESTINATION" of RENAME, COPY and
+// CONCAT into COMMAND(right=ARGUMENTLIST(SOURCE, DESTINATION))
+func (self *BasicParser) fileNamePair(name string) (*BasicASTLeaf, error) {
+	var arglist *BasicASTLeaf = nil
+	var command *BasicASTLeaf = nil
+	var operator *BasicToken = nil
+	var err error = nil
+
+	arglist, err = self.newLeaf()
+	if ( err != nil ) {
+		return nil, err
+	}
+	arglist.leaftype = LEAF_ARGUMENTLIST
+	arglist.operator = FUNCTION_ARGUMENT
+	arglist.right, err = self.argument()
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( !self.match(COMMAND) ) {
+		return nil, errors.New("Expected " + name + " (source) TO (destination)")
+	}
+	operator, err = self.previous()
+	if ( err != nil || strings.ToUpper(operator.lexeme) != "TO" ) {
+		return nil, errors.New("Expected " + name + " (source) TO (destination)")
+	}
+	arglist.right.right, err = self.argument()
+	if ( err != nil ) {
+		return nil, err
+	}
+	command, err = self.newLeaf()
+	if ( err != nil ) {
+		return nil, err
+	}
+	command.newImmediateCommand(name, arglist)
+	return command, nil
+}
+
+func (self *BasicParser) ParseCommandRENAME() (*BasicASTLeaf, error) {
+	// RENAME  "OLD NAME" TO "NEW NAME"
+	return self.fileNamePair("RENAME")
+}
+
+func (self *BasicParser) ParseCommandCOPY() (*BasicASTLeaf, error) {
+	// COPY    "SOURCE" TO "DESTINATION"
+	return self.fileNamePair("COPY")
+}
+
+func (self *BasicParser) ParseCommandCONCAT() (*BasicASTLeaf, error) {
+	// CONCAT  "SOURCE" TO "DESTINATION"
+	return self.fileNamePair("CONCAT")
+}
+
+func (self *BasicParser) ParseCommandDCLOSE() (*BasicASTLeaf, error) {
+	// DCLOSE  [#CHANNEL]
+	var channel *BasicASTLeaf = nil
+	var command *BasicASTLeaf = nil
+	var err error = nil
+
+	channel, err = self.channel()
+	if ( err != nil ) {
+		return nil, err
+	}
+	command, err = self.newLeaf()
+	if ( err != nil ) {
+		return nil, err
+	}
+	command.newCommand("DCLOSE", nil)
+	command.expr = channel
+	return command, nil
+}
+
+// identifierList parses a comma separated list of variables, which may be
+// array elements. Each one is wrapped in a grouping since .right is used
+// to chain the list together.
+func (self *BasicParser) identifierList() (*BasicASTLeaf, error) {
+	var arglist *BasicASTLeaf = nil
+	var last *BasicASTLeaf = nil
+	var identifier *BasicASTLeaf = nil
+	var err error = nil
+
+	arglist, err = self.newLeaf()
+	if ( err != nil ) {
+		return nil, err
+	}
+	arglist.leaftype = LEAF_ARGUMENTLIST
+	arglist.operator = FUNCTION_ARGUMENT
+	last = arglist
+	for {
+		identifier, err = self.primary()
+		if ( err != nil ) {
+			return nil, err
+		}
+		if ( identifier.isIdentifier() == false ) {
+			return nil, errors.New("Expected identifier")
+		}
+		last.right, err = self.newLeaf()
+		if ( err != nil ) {
+			return nil, err
+		}
+		last = last.right
+		last.newGrouping(identifier)
+		if ( !self.match(COMMA) ) {
+			break
+		}
+	}
+	return arglist, nil
+}
+
+// argumentOmitted returns true when the next argument of a list was left
+// out, as in BOX , 10, 10
+func (self *BasicParser) argumentOmitted() bool {
+	var next *BasicToken = self.peek()
+	return ( next == nil ||
+		next.tokentype == COMMA ||
+		next.tokentype == COLON ||
+		next.tokentype == COMMAND ||
+		next.tokentype == COMMAND_IMMEDIATE )
+}
+
+// optionalArgument parses one argument of a list in which arguments may be
+// left out. An argument which was left out is an undefined leaf.
+func (self *BasicParser) optionalArgument() (*BasicASTLeaf, error) {
+	var expr *BasicASTLeaf = nil
+	var err error = nil
+
+	if ( !self.argumentOmitted() ) {
+		return self.argument()
+	}
+	expr, err = self.newLeaf()
+	if ( err != nil ) {
+		return nil, err
+	}
+	expr.init(LEAF_UNDEFINED)
+	return expr, nil
+}
+
+// optionalArgumentList parses the arguments of commands like BOX and
+// CIRCLE, any of which may be left out, into
+// COMMAND(right=ARGUMENTLIST(ARGUMENT, ...))
+func (self *BasicParser) optionalArgumentList(name string) (*BasicASTLeaf, error) {
+	var arglist *BasicASTLeaf = nil
+	var last *BasicASTLeaf = nil
+	var command *BasicASTLeaf = nil
+	var err error = nil
+
+	arglist, err = self.newLeaf()
+	if ( err != nil ) {
+		return nil, err
+	}
+	arglist.leaftype = LEAF_ARGUMENTLIST
+	arglist.operator = FUNCTION_ARGUMENT
+	arglist.right, err = self.optionalArgument()
+	if ( err != nil ) {
+		return nil, err
+	}
+	last = arglist.right
+	for ( self.match(COMMA) ) {
+		last.right, err = self.optionalArgument()
+		if ( err != nil ) {
+			return nil, err
+		}
+		last = last.right
+	}
+	command, err = self.newLeaf()
+	if ( err != nil ) {
+		return nil, err
+	}
+	command.newCommand(name, arglist)
+	return command, nil
+}
+
+func (self *BasicParser) ParseCommandGRAPHIC() (*BasicASTLeaf, error) {
+	// GRAPHIC MODE[, CLEAR][, SPLIT LINE]
+	// GRAPHIC CLR
+	var next *BasicToken = self.peek()
+	var command *BasicASTLeaf = nil
+	var err error = nil
+
+	if ( next != nil && next.tokentype == IDENTIFIER && strings.ToUpper(next.lexeme) == "CLR" ) {
+		self.advance()
+		command, err = self.newLeaf()
+		if ( err != nil ) {
+			return nil, err
+		}
+		command.newCommand("GRAPHIC", nil)
+		command.expr, err = self.newLeaf()
+		if ( err != nil ) {
+			return nil, err
+		}
+		command.expr.newLiteralString("CLR")
+		return command, nil
+	}
+	return self.optionalArgumentList("GRAPHIC")
+}
+
+func (self *BasicParser) ParseCommandDRAW() (*BasicASTLeaf, error) {
+	// DRAW    [SOURCE][, X1, Y1][ TO X2, Y2 ...]
+	// COMMAND ARGUMENTLIST
+	//
+	// DRAW(right=ARGUMENTLIST(SOURCE, X1, Y1, X2, Y2, ...)), where any of
+	// SOURCE, X1 and Y1 may be undefined
+	var arglist *BasicASTLeaf = nil
+	var last *BasicASTLeaf = nil
+	var command *BasicASTLeaf = nil
+	var next *BasicToken = nil
+	var i int
+	var err error = nil
+
+	arglist, err = self.newLeaf()
+	if ( err != nil ) {
+		return nil, err
+	}
+	arglist.leaftype = LEAF_ARGUMENTLIST
+	arglist.operator = FUNCTION_ARGUMENT
+	arglist.right, err = self.optionalArgument()
+	if ( err != nil ) {
+		return nil, err
+	}
+	last = arglist.right
+	if ( self.match(COMMA) ) {
+		last.right, err = self.argument()
+		if ( err != nil ) {
+			return nil, err
+		}
+		last = last.right
+		if ( last == nil || !self.match(COMMA) ) {
+			return nil, errors.New("Expected DRAW (source), (x), (y)")
+		}
+		last.right, err = self.argument()
+		if ( err != nil ) {
+			return nil, err
+		}
+		last = last.right
+	} else {
+		// Lines start from the pixel cursor
+		for i = 0; i < 2; i++ {
+			last.right, err = self.newLeaf()
+			if ( err != nil ) {
+				return nil, err
+			}
+			last = last.right
+			last.init(LEAF_UNDEFINED)
+		}
+	}
+	for {
+		next = self.peek()
+		if ( next == nil || next.tokentype != COMMAND || strings.ToUpper(next.lexeme) != "TO" ) {
+			break
+		}
+		self.advance()
+		last.right, err = self.argument()
+		if ( err != nil ) {
+			return nil, err
+		}
+		last = last.right
+		if ( last == nil || !self.match(COMMA) ) {
+			return nil, errors.New("Expected DRAW ... TO (x), (y)")
+		}
+		last.right, err = self.argument()
+		if ( err != nil ) {
+			return nil, err
+		}
+		last = last.right
+	}
+	if ( last == nil ) {
+		return nil, errors.New("Expected DRAW (source), (x), (y)")
+	}
+	command, err = self.newLeaf()
+	if ( err != nil ) {
+		return nil, err
+	}
+	command.newCommand("DRAW", arglist)
+	return command, nil
+}
+
+func (self *BasicParser) ParseCommandBOX() (*BasicASTLeaf, error) {
+	// BOX     [SOURCE], X1, Y1[, X2, Y2][, ANGLE][, PAINT]
+	return self.optionalArgumentList("BOX")
+}
+
+func (self *BasicParser) ParseCommandCIRCLE() (*BasicASTLeaf, error) {
+	// CIRCLE  [SOURCE], X, Y, XRADIUS[, YRADIUS][, START][, END][, ANGLE][, INCREMENT]
+	return self.optionalArgumentList("CIRCLE")
+}
+
+func (self *BasicParser) ParseCommandPAINT() (*BasicASTLeaf, error) {
+	// PAINT   [SOURCE], X, Y[, MODE]
+	return self.optionalArgumentList("PAINT")
+}
+
+func (self *BasicParser) ParseCommandLOCATE() (*BasicASTLeaf, error) {
+	// LOCATE  X, Y
+	return self.optionalArgumentList("LOCATE")
+}
+
+func (self *BasicParser) ParseCommandSCALE() (*BasicASTLeaf, error) {
+	// SCALE   ON[, XMAX, YMAX]
+	return self.optionalArgumentList("SCALE")
+}
+
+func (self *BasicParser) ParseCommandSSHAPE() (*BasicASTLeaf, error) {
+	// SSHAPE  STRING VARIABLE, X1, Y1[, X2, Y2]
+	return self.optionalArgumentList("SSHAPE")
+}
+
+func (self *BasicParser) ParseCommandGSHAPE() (*BasicASTLeaf, error) {
+	// GSHAPE  STRING[, X, Y][, MODE]
+	return self.optionalArgumentList("GSHAPE")
+}
+
+func (self *BasicParser) ParseCommandSCNCLR() (*BasicASTLeaf, error) {
+	// SCNCLR  [MODE]
+	return self.optionalArgumentList("SCNCLR")
+}
+
+func (self *BasicParser) ParseCommandCHAR() (*BasicASTLeaf, error) {
+	// CHAR    [SOURCE], X, Y[, STRING]
+	return self.optionalArgumentList("CHAR")
+}
+
+func (self *BasicParser) ParseCommandWINDOW() (*BasicASTLeaf, error) {
+	// WINDOW  LEFT, TOP, RIGHT, BOTTOM[, CLEAR]
+	return self.optionalArgumentList("WINDOW")
+}
+
+func (self *BasicParser) ParseCommandCOLOR() (*BasicASTLeaf, error) {
+	// COLOR   SOURCE, COLOUR
+	return self.optionalArgumentList("COLOR")
+}
+
+func (self *BasicParser) ParseCommandSPRITE() (*BasicASTLeaf, error) {
+	// SPRITE  N[, ON][, COLOUR][, PRIORITY][, X EXPAND][, Y EXPAND][, MODE]
+	return self.optionalArgumentList("SPRITE")
+}
+
+func (self *BasicParser) ParseCommandSPRCOLOR() (*BasicASTLeaf, error) {
+	// SPRCOLOR [MULTICOLOUR 1][, MULTICOLOUR 2]
+	return self.optionalArgumentList("SPRCOLOR")
+}
+
+func (self *BasicParser) ParseCommandSPRDEF() (*BasicASTLeaf, error) {
+	// SPRDEF  N
+	return self.optionalArgumentList("SPRDEF")
+}
+
+func (self *BasicParser) ParseCommandSPRSAV() (*BasicASTLeaf, error) {
+	// SPRSAV  N|STRING, N|STRING VARIABLE
+	return self.optionalArgumentList("SPRSAV")
+}
+
+func (self *BasicParser) ParseCommandCOLLISION() (*BasicASTLeaf, error) {
+	// COLLISION TYPE[, LINE]
+	return self.optionalArgumentList("COLLISION")
+}
+
+func (self *BasicParser) ParseCommandMOVSPR() (*BasicASTLeaf, error) {
+	// MOVSPR  N, X, Y
+	// MOVSPR  N, +X|-X, +Y|-Y
+	// MOVSPR  N, DISTANCE ; ANGLE
+	// MOVSPR  N, ANGLE # SPEED
+	// COMMAND ARGUMENTLIST
+	//
+	// MOVSPR(expr=LITERAL_STRING(FORM), right=ARGUMENTLIST(N, A, B)), where
+	// FORM is one of the MOVSPR_ constants
+	var arglist *BasicASTLeaf = nil
+	var last *BasicASTLeaf = nil
+	var command *BasicASTLeaf = nil
+	var relativeX bool = false
+	var relativeY bool = false
+	var form string = MOVSPR_ABSOLUTE
+	var err error = nil
+
+	arglist, err = self.newLeaf()
+	if ( err != nil ) {
+		return nil, err
+	}
+	arglist.leaftype = LEAF_ARGUMENTLIST
+	arglist.operator = FUNCTION_ARGUMENT
+	arglist.right, err = self.argument()
+	if ( err != nil ) {
+		return nil, err
+	}
+	last = arglist.right
+	if ( last == nil || !self.match(COMMA) ) {
+		return nil, errors.New("Expected MOVSPR (sprite), (x), (y)")
+	}
+	relativeX = self.signedArgument()
+	last.right, err = self.argument()
+	if ( err != nil ) {
+		return nil, err
+	}
+	last = last.right
+	switch {
+	case last == nil:
+		return nil, errors.New("Expected MOVSPR (sprite), (x), (y)")
+	case self.match(SEMICOLON):
+		form = MOVSPR_POLAR
+	case self.match(HASH):
+		form = MOVSPR_VELOCITY
+	case self.match(COMMA):
+		relativeY = self.signedArgument()
+		switch {
+		case relativeX && relativeY: form = MOVSPR_RELATIVE
+		case relativeX: form = MOVSPR_RELATIVE_X
+		case relativeY: form = MOVSPR_RELATIVE_Y
+		}
+	default:
+		return nil, errors.New("Expected MOVSPR (sprite), (x), (y)")
+	}
+	last.right, err = self.argument()
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( last.right == nil ) {
+		return nil, errors.New("Expected MOVSPR (sprite), (x), (y)")
+	}
+	command, err = self.newLeaf()
+	if ( err != nil ) {
+		return nil, err
+	}
+	command.newCommand("MOVSPR", arglist)
+	command.expr, err = self.newLeaf()
+	if ( err != nil ) {
+		return nil, err
+	}
+	command.expr.newLiteralString(form)
+	return command, nil
+}
+
+// signedArgument returns true if the next argument starts with a + or a -,
+// which makes a MOVSPR coordinate relative. The + is skipped, since an
+// expression can't start with one.
+func (self *BasicParser) signedArgument() bool {
+	var next *BasicToken = self.peek()
+	if ( next == nil ) {
+		return false
+	}
+	if ( next.tokentype == PLUS ) {
+		self.advance()
+		return true
+	}
+	return ( next.tokentype == MINUS )
 }
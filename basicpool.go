@@ -0,0 +1,35 @@
+package main
+
+// BasicPool hands out pointers to objects which stay valid until the pool
+// is reset. Objects are allocated in fixed size blocks as they are needed,
+// and growing the pool never moves an object that has already been handed
+// out, so leaves can safely point at other leaves from the same pool.
+type BasicPool[T any] struct {
+	blocks [][]T
+	blocksize int
+	next int
+}
+
+func (self *BasicPool[T]) init(blocksize int) {
+	self.blocks = nil
+	self.blocksize = blocksize
+	self.next = 0
+}
+
+// get returns the next unused object in the pool. The object may have been
+// used before the last reset(), it is up to the caller to initialize it.
+func (self *BasicPool[T]) get() *T {
+	var block int = self.next / self.blocksize
+	var index int = self.next % self.blocksize
+	if ( block >= len(self.blocks) ) {
+		self.blocks = append(self.blocks, make([]T, self.blocksize))
+	}
+	self.next += 1
+	return &self.blocks[block][index]
+}
+
+// reset makes every object in the pool available again. Memory that has
+// already been allocated is kept for reuse.
+func (self *BasicPool[T]) reset() {
+	self.next = 0
+}
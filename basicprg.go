@@ -0,0 +1,527 @@
+package main
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Commodore PRG files start with the address the program loads at, and
+// then each line is the address of the next line, the line number (both
+// 2 bytes, low byte first), the tokenized code, and a 0. The program ends
+// where the address of the next line is 0.
+const (
+	PRG_ADDRESS_PET = 0x0401
+	PRG_ADDRESS_VIC20 = 0x1001
+	PRG_ADDRESS_C64 = 0x0801
+	PRG_ADDRESS_C128 = 0x1C01
+	// PRG files are written for the C128, which has BASIC 7.0
+	PRG_ADDRESS_DEFAULT = PRG_ADDRESS_C128
+	// Tokens which are followed by a second byte
+	PRG_TOKEN_FUNCTION = 0xCE
+	PRG_TOKEN_COMMAND = 0xFE
+	PRG_TOKEN_PI = 0xFF
+)
+
+// The keywords of Commodore BASIC 2.0 (0x80 - 0xCB) and BASIC 7.0, by
+// their token bytes
+var prgTokens = map[string]string{
+	"\x80": "END", "\x81": "FOR", "\x82": "NEXT", "\x83": "DATA",
+	"\x84": "INPUT#", "\x85": "INPUT", "\x86": "DIM", "\x87": "READ",
+	"\x88": "LET", "\x89": "GOTO", "\x8a": "RUN", "\x8b": "IF",
+	"\x8c": "RESTORE", "\x8d": "GOSUB", "\x8e": "RETURN", "\x8f": "REM",
+	"\x90": "STOP", "\x91": "ON", "\x92": "WAIT", "\x93": "LOAD",
+	"\x94": "SAVE", "\x95": "VERIFY", "\x96": "DEF", "\x97": "POKE",
+	"\x98": "PRINT#", "\x99": "PRINT", "\x9a": "CONT", "\x9b": "LIST",
+	"\x9c": "CLR", "\x9d": "CMD", "\x9e": "SYS", "\x9f": "OPEN",
+	"\xa0": "CLOSE", "\xa1": "GET", "\xa2": "NEW", "\xa3": "TAB(",
+	"\xa4": "TO", "\xa5": "FN", "\xa6": "SPC(", "\xa7": "THEN",
+	"\xa8": "NOT", "\xa9": "STEP", "\xaa": "+", "\xab": "-",
+	"\xac": "*", "\xad": "/", "\xae": "^", "\xaf": "AND",
+	"\xb0": "OR", "\xb1": ">", "\xb2": "=", "\xb3": "<",
+	"\xb4": "SGN", "\xb5": "INT", "\xb6": "ABS", "\xb7": "USR",
+	"\xb8": "FRE", "\xb9": "POS", "\xba": "SQR", "\xbb": "RND",
+	"\xbc": "LOG", "\xbd": "EXP", "\xbe": "COS", "\xbf": "SIN",
+	"\xc0": "TAN", "\xc1": "ATN", "\xc2": "PEEK", "\xc3": "LEN",
+	"\xc4": "STR$", "\xc5": "VAL", "\xc6": "ASC", "\xc7": "CHR$",
+	"\xc8": "LEFT$", "\xc9": "RIGHT$", "\xca": "MID$", "\xcb": "GO",
+	"\xcc": "RGR", "\xcd": "RCLR", "\xcf": "JOY",
+	"\xd0": "RDOT", "\xd1": "DEC", "\xd2": "HEX$", "\xd3": "ERR$",
+	"\xd4": "INSTR", "\xd5": "ELSE", "\xd6": "RESUME", "\xd7": "TRAP",
+	"\xd8": "TRON", "\xd9": "TROFF", "\xda": "SOUND", "\xdb": "VOL",
+	"\xdc": "AUTO", "\xdd": "PUDEF", "\xde": "GRAPHIC", "\xdf": "PAINT",
+	"\xe0": "CHAR", "\xe1": "BOX", "\xe2": "CIRCLE", "\xe3": "GSHAPE",
+	"\xe4": "SSHAPE", "\xe5": "DRAW", "\xe6": "LOCATE", "\xe7": "COLOR",
+	"\xe8": "SCNCLR", "\xe9": "SCALE", "\xea": "HELP", "\xeb": "DO",
+	"\xec": "LOOP", "\xed": "EXIT", "\xee": "DIRECTORY", "\xef": "DSAVE",
+	"\xf0": "DLOAD", "\xf1": "HEADER", "\xf2": "SCRATCH", "\xf3": "COLLECT",
+	"\xf4": "COPY", "\xf5": "RENAME", "\xf6": "BACKUP", "\xf7": "DELETE",
+	"\xf8": "RENUMBER", "\xf9": "KEY", "\xfa": "MONITOR", "\xfb": "USING",
+	"\xfc": "UNTIL", "\xfd": "WHILE",
+	"\xce\x02": "POT", "\xce\x03": "BUMP", "\xce\x04": "PEN", "\xce\x05": "RSPPOS",
+	"\xce\x06": "RSPRITE", "\xce\x07": "RSPCOLOR", "\xce\x08": "XOR", "\xce\x09": "RWINDOW",
+	"\xce\x0a": "POINTER",
+	"\xfe\x02": "BANK", "\xfe\x03": "FILTER", "\xfe\x04": "PLAY", "\xfe\x05": "TEMPO",
+	"\xfe\x06": "MOVSPR", "\xfe\x07": "SPRITE", "\xfe\x08": "SPRCOLOR", "\xfe\x09": "RREG",
+	"\xfe\x0a": "ENVELOPE", "\xfe\x0b": "SLEEP", "\xfe\x0c": "CATALOG", "\xfe\x0d": "DOPEN",
+	"\xfe\x0e": "APPEND", "\xfe\x0f": "DCLOSE", "\xfe\x10": "BSAVE", "\xfe\x11": "BLOAD",
+	"\xfe\x12": "RECORD", "\xfe\x13": "CONCAT", "\xfe\x14": "DVERIFY", "\xfe\x15": "DCLEAR",
+	"\xfe\x16": "SPRSAV", "\xfe\x17": "COLLISION", "\xfe\x18": "BEGIN", "\xfe\x19": "BEND",
+	"\xfe\x1a": "WINDOW", "\xfe\x1b": "BOOT", "\xfe\x1c": "WIDTH", "\xfe\x1d": "SPRDEF",
+	"\xfe\x1e": "QUIT", "\xfe\x1f": "STASH", "\xfe\x21": "FETCH", "\xfe\x23": "SWAP",
+	"\xfe\x24": "OFF", "\xfe\x25": "FAST", "\xfe\x26": "SLOW",
+}
+
+// Commodore keywords which have a different name here
+var prgKeywordNames = map[string]string{
+	"STR$": "STR",
+	"CHR$": "CHR",
+	"LEFT$": "LEFT",
+	"RIGHT$": "RIGHT",
+	"MID$": "MID",
+	"HEX$": "HEX",
+	"ERR$": "ERR",
+}
+
+// Commodore variables which are set by BASIC itself. They have no suffix
+// to translate.
+var prgSystemVariables = []string{"DS", "EL", "ER", "ST", "TI"}
+
+// LIST writes PETSCII control characters as {NAME}, the same way as in
+// Commodore magazine listings
+var petsciiControlNames = map[byte]string{
+	0x05: "WHT", 0x0E: "SWLC", 0x11: "DOWN", 0x12: "RVS ON",
+	0x13: "HOME", 0x14: "DEL", 0x1C: "RED", 0x1D: "RIGHT",
+	0x1E: "GRN", 0x1F: "BLU", 0x81: "ORNG", 0x85: "F1",
+	0x86: "F3", 0x87: "F5", 0x88: "F7", 0x89: "F2",
+	0x8A: "F4", 0x8B: "F6", 0x8C: "F8", 0x8E: "SWUC",
+	0x90: "BLK", 0x91: "UP", 0x92: "RVS OFF", 0x93: "CLR",
+	0x94: "INST", 0x95: "BRN", 0x96: "LRED", 0x97: "GRY1",
+	0x98: "GRY2", 0x99: "LGRN", 0x9A: "LBLU", 0x9B: "GRY3",
+	0x9C: "PUR", 0x9D: "LEFT", 0x9E: "YEL", 0x9F: "CYN",
+}
+
+// The graphics characters of the upper case PETSCII character set from
+// 0xA0 to 0xDF. 0x60 - 0x7F are the same as 0xC0 - 0xDF, and 0xE0 - 0xFE
+// are the same as 0xA0 - 0xBE.
+var petsciiGraphics = [64]rune{
+	0x00A0, 0x258C, 0x2584, 0x2594, 0x2581, 0x258F, 0x2592, 0x2595,
+	0x1FB8F, 0x25E4, 0x1FB87, 0x251C, 0x2597, 0x2514, 0x2510, 0x2582,
+	0x250C, 0x2534, 0x252C, 0x2524, 0x258E, 0x258D, 0x1FB88, 0x1FB82,
+	0x1FB83, 0x2583, 0x1FB7F, 0x2596, 0x259D, 0x2518, 0x2598, 0x259A,
+	0x2500, 0x2660, 0x1FB72, 0x1FB78, 0x1FB77, 0x1FB76, 0x1FB7A, 0x1FB71,
+	0x1FB74, 0x256E, 0x2570, 0x256F, 0x1FB7C, 0x2572, 0x2571, 0x1FB7D,
+	0x1FB7E, 0x25CF, 0x1FB7B, 0x2665, 0x1FB70, 0x256D, 0x2573, 0x25CB,
+	0x2663, 0x1FB75, 0x2666, 0x253C, 0x1FB8C, 0x2502, 0x03C0, 0x25E5,
+}
+
+func isCommodorePRG(data []byte) bool {
+	var address int
+
+	if ( len(data) < 4 ) {
+		return false
+	}
+	address = int(data[0]) | (int(data[1]) << 8)
+	return ( address == PRG_ADDRESS_PET ||
+		address == PRG_ADDRESS_VIC20 ||
+		address == PRG_ADDRESS_C64 ||
+		address == PRG_ADDRESS_C128 )
+}
+
+// petsciiToText returns the text for a PETSCII character in a string.
+// Control characters are the characters with the same codes, which do
+// the same things when they are printed.
+func petsciiToText(c byte) string {
+	switch {
+	case isPetsciiControl(rune(c)):
+		return characterString(rune(c))
+	case c == 0x5C:
+		return "£"
+	case c == 0x5E:
+		return "↑"
+	case c == 0x5F:
+		return "←"
+	case c < 0x60:
+		return string(rune(c))
+	case c < 0x80:
+		return string(petsciiGraphics[c - 0x60 + 0x20])
+	case c == PRG_TOKEN_PI:
+		return "π"
+	case c >= 0xE0:
+		return string(petsciiGraphics[c - 0xE0])
+	}
+	return string(petsciiGraphics[c - 0xA0])
+}
+
+// textToPetscii returns the PETSCII for the character at the start of
+// text, and how many bytes of text it used
+func textToPetscii(text string) (byte, int) {
+	var r rune
+	var size int
+
+	r, size = utf8.DecodeRuneInString(text)
+	switch {
+	case isPetsciiControl(r):
+		return byte(r), size
+	case r >= 'a' && r <= 'z':
+		return byte(r - 'a' + 'A'), size
+	case r >= 0x20 && r < 0x5C, r == ']':
+		return byte(r), size
+	case r == '£':
+		return 0x5C, size
+	case r == '↑':
+		return 0x5E, size
+	case r == '←':
+		return 0x5F, size
+	case r == 'π':
+		return PRG_TOKEN_PI, size
+	}
+	for i, graphic := range(petsciiGraphics) {
+		if ( graphic == r ) {
+			return byte(0xA0 + i), size
+		}
+	}
+	return '?', size
+}
+
+// isPetsciiControl returns true for the codes of the PETSCII control
+// characters
+func isPetsciiControl(c rune) bool {
+	return ( (c >= 0 && c < 0x20) || (c >= 0x80 && c < 0xA0) )
+}
+
+// listingText returns a line of code with its PETSCII control characters
+// written as {NAME}, so that listing it shows them instead of doing what
+// they do
+func listingText(code string) string {
+	var text strings.Builder
+	var name string
+	var exists bool
+
+	for _, c := range(code) {
+		name, exists = "", false
+		if ( isPetsciiControl(c) ) {
+			name, exists = petsciiControlNames[byte(c)]
+		}
+		if ( exists ) {
+			text.WriteString("{" + name + "}")
+		} else {
+			text.WriteRune(c)
+		}
+	}
+	return text.String()
+}
+
+// isPrgDigit returns true for the characters of a number in a PRG file
+func isPrgDigit(c byte) bool {
+	return ( (c >= '0' && c <= '9') || c == '.' )
+}
+
+// isPrgNameCharacter returns true for the characters of a variable name in
+// a PRG file
+func isPrgNameCharacter(c byte) bool {
+	return ( (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') )
+}
+
+// prgNeedsSpace returns true if a keyword next to c needs a space between
+// them
+func prgNeedsSpace(c byte) bool {
+	return ( isPrgNameCharacter(c) || c == '"' || c == '$' || c == '%' || c == '#' || c == ')' )
+}
+
+func lastByte(text string) byte {
+	if ( len(text) == 0 ) {
+		return ' '
+	}
+	return text[len(text) - 1]
+}
+
+// prgVariable returns the name of the Commodore variable at data[i]
+// written the way it is here, and the number of bytes it used. Commodore
+// variables without a suffix are floats and ones ending in % are
+// integers, where here floats end in % and integers in #. Labels and the
+// keywords that are only used here are left alone.
+func prgVariable(data []byte, i int, label bool) (string, int) {
+	var end int = i
+	var name string
+
+	for ( end < len(data) && isPrgNameCharacter(data[end]) ) {
+		end += 1
+	}
+	name = string(data[i:end])
+	switch {
+	case end < len(data) && data[end] == '$':
+		return name + "$", end + 1 - i
+	case end < len(data) && data[end] == '%':
+		return name + "#", end + 1 - i
+	case label || slices.Contains(prgSystemVariables, name) || slices.Contains(tokenizedKeywords, name):
+		return name, end - i
+	}
+	return name + "%", end - i
+}
+
+// decodePRG returns the lines of the program in the Commodore PRG file in
+// data, and the Commodore keywords used on each line so that the ones
+// which aren't supported here can be reported. Variable suffixes are
+// translated, and = is written == where it compares instead of assigns.
+func decodePRG(data []byte) ([]BasicSourceLine, map[int64][]string, error) {
+	var keywords map[int64][]string = make(map[int64][]string)
+	var lines []BasicSourceLine
+	var code strings.Builder
+	var lineno int64
+	var keyword string
+	var previous string
+	var name string
+	var length int
+	var exists bool
+	var renamed bool
+	var inString bool
+	var inComment bool
+	var inData bool
+	// The next = assigns, since nothing but a variable has been seen in
+	// the statement so far
+	var assignment bool
+	// The next name is a label, after GOTO, GOSUB or LABEL
+	var label bool
+	var depth int
+	var i int = 2
+
+	if ( !isCommodorePRG(data) ) {
+		return nil, nil, newBasicRuntimeError(LOAD, "Not a Commodore PRG file")
+	}
+	for ( i + 2 <= len(data) && (data[i] != 0 || data[i + 1] != 0) ) {
+		if ( i + 4 > len(data) ) {
+			return nil, nil, newBasicRuntimeError(LOAD, "PRG file is truncated")
+		}
+		lineno = int64(data[i + 2]) | (int64(data[i + 3]) << 8)
+		i += 4
+		code.Reset()
+		inString = false
+		inComment = false
+		inData = false
+		assignment = true
+		label = false
+		depth = 0
+		previous = ""
+		for ( i < len(data) && data[i] != 0 ) {
+			if ( data[i] == '"' ) {
+				inString = !inString
+			}
+			if ( !inString && !inComment ) {
+				switch ( data[i] ) {
+				case ':':
+					inData = false
+					assignment = true
+					depth = 0
+				case '(':
+					depth += 1
+				case ')':
+					depth -= 1
+				}
+			}
+			if ( !inString && !inComment && !inData && data[i] >= 'A' && data[i] <= 'Z' &&
+				( i == 0 || !isPrgNameCharacter(data[i - 1]) ) &&
+				!( data[i] == 'E' && i > 0 && isPrgDigit(data[i - 1]) ) ) {
+				name, length = prgVariable(data, i, label)
+				if ( slices.Contains(prgSystemVariables, strings.TrimRight(name, "$")) ) {
+					keywords[lineno] = append(keywords[lineno], name)
+				}
+				code.WriteString(name)
+				label = ( name == "LABEL" )
+				previous = ""
+				i += length
+				continue
+			}
+			if ( data[i] != ' ' ) {
+				label = false
+			}
+			if ( inString || inComment || data[i] < 0x80 || data[i] == PRG_TOKEN_PI ) {
+				previous = ""
+				code.WriteString(petsciiToText(data[i]))
+				if ( data[i] == PRG_TOKEN_PI && !inString && !inComment ) {
+					keywords[lineno] = append(keywords[lineno], "π")
+				}
+				i += 1
+				continue
+			}
+			if ( (data[i] == PRG_TOKEN_FUNCTION || data[i] == PRG_TOKEN_COMMAND) && i + 1 < len(data) ) {
+				keyword, exists = prgTokens[string(data[i:i + 2])]
+				i += 2
+			} else {
+				keyword, exists = prgTokens[string(data[i:i + 1])]
+				i += 1
+			}
+			if ( !exists ) {
+				return nil, nil, newBasicRuntimeError(LOAD, "Unknown token in line %d", lineno)
+			}
+			keywords[lineno] = append(keywords[lineno], keyword)
+			inComment = ( keyword == "REM" )
+			inData = ( keyword == "DATA" )
+			label = ( keyword == "GOTO" || keyword == "GOSUB" )
+			switch ( keyword ) {
+			case "THEN", "ELSE", "LET", "FOR", "DEF":
+				assignment = true
+				depth = 0
+			case "TAB(", "SPC(":
+				depth += 1
+			case "FN":
+				// DEF FN is still assigning
+			case "=":
+				switch {
+				case previous == "<" || previous == ">":
+					// The end of <= or >=
+				case i < len(data) && (data[i] == 0xB1 || data[i] == 0xB3):
+					// => and =< are written >= and <= here
+					keyword = prgTokens[string(data[i:i + 1])] + "="
+					i += 1
+				case assignment && depth == 0:
+					assignment = false
+				default:
+					keyword = "=="
+				}
+			default:
+				if ( depth == 0 ) {
+					assignment = false
+				}
+			}
+			previous = keyword
+			name, renamed = prgKeywordNames[keyword]
+			if ( renamed ) {
+				keyword = name
+			}
+			// Commodore BASIC doesn't need spaces between keywords
+			// and the rest of the code, but words do here
+			if ( isKeywordCharacter(keyword[0]) && prgNeedsSpace(lastByte(code.String())) ) {
+				code.WriteByte(' ')
+			}
+			code.WriteString(keyword)
+			if ( isKeywordCharacter(keyword[len(keyword) - 1]) && i < len(data) && prgNeedsSpace(data[i]) ) {
+				code.WriteByte(' ')
+			}
+		}
+		if ( i >= len(data) ) {
+			return nil, nil, newBasicRuntimeError(LOAD, "PRG file is truncated")
+		}
+		i += 1
+		lines = append(lines, BasicSourceLine{
+			code: code.String(),
+			lineno: lineno})
+	}
+	return lines, keywords, nil
+}
+
+// prgKeywordAt returns the token for the longest Commodore keyword at the
+// start of code, and the number of bytes of code it replaces
+func prgKeywordAt(code string, previous byte) (string, int) {
+	var token string = ""
+	var length int = 0
+	var name string
+	var renamed bool
+	var end int
+
+	if ( strings.HasPrefix(code, "==") ) {
+		return "\xb2", 2
+	}
+	for key, keyword := range(prgTokens) {
+		name, renamed = prgKeywordNames[keyword]
+		if ( !renamed ) {
+			name = keyword
+		}
+		end = len(name)
+		if ( end <= length || end > len(code) || !strings.EqualFold(code[:end], name) ) {
+			continue
+		}
+		// Words are only keywords when they aren't part of a longer name
+		if ( isKeywordCharacter(name[0]) && isKeywordCharacter(previous) ) {
+			continue
+		}
+		if ( isKeywordCharacter(name[end - 1]) && end < len(code) && isKeywordCharacter(code[end]) ) {
+			continue
+		}
+		token = key
+		length = end
+	}
+	return token, length
+}
+
+// prg returns the program as a Commodore PRG file which loads at address
+func (self *BasicSource) prg(address int) []byte {
+	var buffer bytes.Buffer
+	var line bytes.Buffer
+	var next int = address
+	var token string
+	var length int
+	var c byte
+	var previous byte
+	var inString bool
+	var inComment bool
+	var inData bool
+	var end int
+	var i int
+
+	buffer.WriteByte(byte(address & 0xFF))
+	buffer.WriteByte(byte(address >> 8))
+	for _, sourceline := range(self.all()) {
+		line.Reset()
+		inString = false
+		inComment = false
+		inData = false
+		previous = ' '
+		i = 0
+		for ( i < len(sourceline.code) ) {
+			if ( inData && !inString && sourceline.code[i] == ':' ) {
+				inData = false
+			}
+			// Commodore BASIC doesn't tokenize comments or DATA
+			if ( !inString && !inComment && !inData ) {
+				token, length = prgKeywordAt(sourceline.code[i:], previous)
+				if ( length > 0 ) {
+					line.WriteString(token)
+					inComment = ( token == "\x8f" )
+					inData = ( token == "\x83" )
+					previous = sourceline.code[i + length - 1]
+					i += length
+					continue
+				}
+				if ( isKeywordCharacter(sourceline.code[i]) && !isKeywordCharacter(previous) &&
+					!( sourceline.code[i] >= '0' && sourceline.code[i] <= '9' ) ) {
+					// A variable. Integers end in % on a Commodore and
+					// floats have no suffix.
+					for end = i; end < len(sourceline.code) && isKeywordCharacter(sourceline.code[end]); end++ {
+						c, _ = textToPetscii(sourceline.code[end:])
+						line.WriteByte(c)
+					}
+					previous = sourceline.code[end - 1]
+					i = end
+					if ( i < len(sourceline.code) && sourceline.code[i] == '#' ) {
+						line.WriteByte('%')
+						i += 1
+					} else if ( i < len(sourceline.code) && sourceline.code[i] == '%' ) {
+						i += 1
+					}
+					continue
+				}
+			}
+			c, length = textToPetscii(sourceline.code[i:])
+			if ( c == '"' ) {
+				inString = !inString
+			}
+			line.WriteByte(c)
+			previous = sourceline.code[i]
+			i += length
+		}
+		// Each line is the address of the next one, the line number, the
+		// code and a 0
+		next += 4 + line.Len() + 1
+		buffer.WriteByte(byte(next & 0xFF))
+		buffer.WriteByte(byte(next >> 8))
+		buffer.WriteByte(byte(sourceline.lineno & 0xFF))
+		buffer.WriteByte(byte(sourceline.lineno >> 8))
+		buffer.Write(line.Bytes())
+		buffer.WriteByte(0)
+	}
+	buffer.WriteByte(0)
+	buffer.WriteByte(0)
+	return buffer.Bytes()
+}
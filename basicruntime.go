@@ -7,39 +7,27 @@ import (
 	"bufio"
 	//"os"
 	"slices"
-	"unicode"
 	"strings"
 	"reflect"
-	"github.com/veandco/go-sdl2/sdl"
-	"github.com/veandco/go-sdl2/ttf"	
 )
 
-type BasicError int
-const (
-	NOERROR    BasicError = iota
-	IO
-	PARSE
-	SYNTAX
-	RUNTIME
-)
-
-type BasicSourceLine struct {
-	code string
+// A value from a DATA statement, and the line it came from
+type BasicDataItem struct {
+	leaf *BasicASTLeaf
 	lineno int64
 }
 
 type BasicRuntime struct {
-	source [MAX_SOURCE_LINES]BasicSourceLine
+	source BasicSource
 	readbuff *bufio.Scanner
 	
-	lineInProgress [MAX_LINE_LENGTH]rune
-	userlineIndex int
 	userline string
+	// Set by the frontend when a line of input is completed, which
+	// may be an empty line
+	lineEntered bool
 
-	variables [MAX_VARIABLES]BasicVariable
 	staticTrueValue BasicValue
 	staticFalseValue BasicValue
-	nextvariable int
 	mode int
 	errno BasicError
 	run_finished_mode int
@@ -53,35 +41,67 @@ type BasicRuntime struct {
 	// evaluating an identifier, do not want the cloned value, they want the raw
 	// source value. Those commands will temporarily set this to `false`.
 	eval_clone_identifiers bool
-	window *sdl.Window
-	printSurface *sdl.Surface
+	frontend BasicFrontend
+	// Files opened with DOPEN, by channel, and the ST of the last
+	// operation on one of them
+	files map[int64]*BasicFile
+	// The directory that file names are relative to
+	drive BasicDrive
+	ioStatus int64
+	// Every DATA value in the program, and the next one to READ
+	data []BasicDataItem
+	dataIdx int
+	// How many user defined function calls are in progress, and the
+	// environment that was running when the outermost one was called
+	callDepth int64
+	maxCallDepth int64
+	callerEnvironment *BasicEnvironment
 	cursorX int32
 	cursorY int32
-	
-	font *ttf.Font
-	fontWidth int
-	fontHeight int
-	maxCharsW int32
-	maxCharsH int32
-
-	printBuffer string
+	// The text screen everything is printed on, and the screen drawn on
+	// by the graphics commands
+	screen BasicScreen
+	bitmap BasicBitmap
+	sprites BasicSprites
+	// The colour of each colour source, set by COLOR
+	colors [COLOR_SOURCES]int64
+
+	// Error trapping. When trapEnabled is set, errors in a running
+	// program GOTO trapLine instead of stopping the program.
+	trapEnabled bool
+	trapLine int64
+	inTrap bool
+	// An error was trapped inside a user defined function, and the calls
+	// in progress are returning to the statement that made the outermost
+	// one
+	trapUnwinding bool
+	// ER, EL and the message for the last trapped error
+	errorNumber BasicError
+	errorLine int64
+	errorMessage string
+	// Where RESUME and RESUME NEXT go back to
+	errorStatement int64
+	resumeNextLine int64
+	resumeNextStatement int64
 }
 
 func (self *BasicRuntime) zero() {
-	for i, _ := range self.environment.values {
-		self.environment.values[i].init()
-	}
 	self.environment.zero()
-	self.printBuffer = ""
 	self.userline = ""
 }
 
-func (self *BasicRuntime) init(window *sdl.Window, font *ttf.Font) {
-	var err error = nil
-	var windowSurface *sdl.Surface = nil
-	
+func (self *BasicRuntime) init(frontend BasicFrontend) {
 	self.environment = nil
 	self.autoLineNumber = 0
+	self.callDepth = 0
+	self.source.init()
+	self.files = make(map[int64]*BasicFile)
+	self.drive.init(".")
+	self.colors = defaultColors
+	self.screen.init(&self.colors)
+	self.bitmap.init(&self.colors)
+	self.sprites.init(&self.screen, &self.bitmap)
+	self.maxCallDepth = DEFAULT_MAX_CALL_DEPTH
 	self.staticTrueValue.basicBoolValue(true)
 	self.staticFalseValue.basicBoolValue(false)
 
@@ -90,26 +110,8 @@ func (self *BasicRuntime) init(window *sdl.Window, font *ttf.Font) {
 	self.scanner.init(self)
 
 	self.eval_clone_identifiers = true
-	self.window = window
-	self.font = font
+	self.frontend = frontend
 
-	self.fontWidth, self.fontHeight, err = self.font.SizeUTF8("A")
-	if ( err != nil ) {
-		self.basicError(RUNTIME, "Could not get the height and width of the font")
-	} else {
-		windowSurface, err = self.window.GetSurface()
-		if ( err != nil ) {
-			self.basicError(RUNTIME, "Could not get SDL window surface")
-		} else {
-			self.maxCharsW = (windowSurface.W / int32(self.fontWidth))
-			self.maxCharsH = (windowSurface.H / int32(self.fontHeight))-1
-		}
-	}
-	self.printSurface, err = sdl.CreateRGBSurface(0, windowSurface.W, windowSurface.H, int32(windowSurface.Format.BitsPerPixel), 0, 0, 0, 0)
-	if ( err != nil ) {
-		self.basicError(RUNTIME, "Could not create the print buffer surface")
-	}
-	
 	self.zero()
 	self.parser.zero()
 	self.scanner.zero()
@@ -132,29 +134,59 @@ func (self *BasicRuntime) prevEnvironment() {
 }
 
 func (self *BasicRuntime) errorCodeToString(errno BasicError) string {
-	switch (errno) {
-	case IO: return "IO ERROR"
-	case PARSE: return "PARSE ERROR"
-	case RUNTIME: return "RUNTIME ERROR"
-	case SYNTAX: return "SYNTAX ERROR"
+	if ( errno <= NOERROR || errno >= MAX_BASIC_ERROR ) {
+		return "UNDEF"
 	}
-	return "UNDEF"
+	return fmt.Sprintf("%s ERROR", errno.name())
 }
 
-func (self *BasicRuntime) basicError(errno BasicError, message string) {
-	self.errno = errno
-	self.Println(fmt.Sprintf("? %d : %s %s\n", self.environment.lineno, self.errorCodeToString(errno), message))
+// errnoFor returns the catalogue number for an error returned from a
+// command, function or value, or the fallback if it doesn't have one.
+func (self *BasicRuntime) errnoFor(err error, fallback BasicError) BasicError {
+	var rterr *BasicRuntimeError = nil
+	if ( errors.As(err, &rterr) ) {
+		return rterr.errno
+	}
+	return fallback
 }
 
-func (self *BasicRuntime) newVariable() (*BasicVariable, error) {
-	var variable *BasicVariable
-	if ( self.nextvariable < MAX_VARIABLES ) {
-		variable = &self.variables[self.nextvariable]
-		self.nextvariable += 1
-		variable.runtime = self
-		return variable, nil
+func (self *BasicRuntime) basicError(errno BasicError, message string) {
+	var trapEnvironment *BasicEnvironment = self.environment
+
+	if ( self.errno != NOERROR ) {
+		// Only the first error in a statement is reported. Anything
+		// after that is fallout from unwinding the first one.
+		return
+	}
+	if ( self.trapUnwinding ) {
+		// Fallout from a trapped error in a function, which is finished
+		// with once the statement that called the function has it
+		if ( self.callDepth == 0 ) {
+			self.trapUnwinding = false
+		}
+		return
+	}
+	if ( self.mode == MODE_RUN && self.trapEnabled && self.inTrap == false ) {
+		// The program has asked to handle errors itself. An error in a
+		// function is handled as an error in the statement that called
+		// it, since the function's environment is about to go away.
+		if ( self.callDepth > 0 ) {
+			trapEnvironment = self.callerEnvironment
+			self.trapUnwinding = true
+		}
+		self.errorNumber = errno
+		self.errorLine = trapEnvironment.lineno
+		self.errorStatement = trapEnvironment.statement
+		self.errorMessage = strings.TrimSpace(message)
+		self.resumeNextLine = trapEnvironment.nextline
+		self.resumeNextStatement = trapEnvironment.nextstatement
+		self.inTrap = true
+		trapEnvironment.nextline = self.trapLine
+		trapEnvironment.nextstatement = 0
+		return
 	}
-	return nil, errors.New("Maximum runtime variables reached")
+	self.errno = errno
+	self.Println(fmt.Sprintf("? %d : %s %s\n", self.environment.lineno, self.errorCodeToString(errno), message))
 }
 
 
@@ -185,9 +217,7 @@ func (self *BasicRuntime) evaluate(expr *BasicASTLeaf, leaftypes ...BasicASTLeaf
 	case LEAF_BRANCH:
 		rval, err = self.evaluate(expr.expr)
 		if ( err != nil ) {
-			self.basicError(RUNTIME, err.Error())
 			return nil, err
-			
 		}
 		if ( rval.boolvalue == BASIC_TRUE ) {
 			return self.evaluate(expr.left)
@@ -197,6 +227,10 @@ func (self *BasicRuntime) evaluate(expr *BasicASTLeaf, leaftypes ...BasicASTLeaf
 			// branch is optional.
 			return self.evaluate(expr.right)
 		}
+		if ( self.mode == MODE_RUN ) {
+			// The rest of the line belongs to the IF
+			self.skipToElse()
+		}
 	case LEAF_IDENTIFIER_INT: fallthrough
 	case LEAF_IDENTIFIER_FLOAT: fallthrough
 	case LEAF_IDENTIFIER_STRING:
@@ -347,6 +381,7 @@ func (self *BasicRuntime) evaluate(expr *BasicASTLeaf, leaftypes ...BasicASTLeaf
 
 func (self *BasicRuntime) userFunction(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
 	var fndef *BasicFunctionDef = nil
+	var fnenv *BasicEnvironment = nil
 	var leafptr *BasicASTLeaf = nil
 	var argptr *BasicASTLeaf = nil
 	var leafvalue *BasicValue = nil
@@ -358,9 +393,22 @@ func (self *BasicRuntime) userFunction(expr *BasicASTLeaf, lval *BasicValue, rva
 	if ( fndef == nil ) {
 		return nil, nil
 	} else {
-		fndef.environment.init(self, self.environment)
-		leafptr = expr.right
-		argptr = fndef.arglist
+		if ( self.callDepth >= self.maxCallDepth ) {
+			return nil, newBasicRuntimeError(STACK_OVERFLOW, "Maximum call depth of %d reached calling %s", self.maxCallDepth, fndef.name)
+		}
+		if ( self.callDepth == 0 ) {
+			self.callerEnvironment = self.environment
+		}
+		self.callDepth += 1
+		defer func() { self.callDepth -= 1 }()
+		// Every call gets its own environment so that subroutines can
+		// call themselves. Only multi-line subroutines get a local scope,
+		// expression functions can still see the caller's variables.
+		fnenv = new(BasicEnvironment)
+		fnenv.init(self, self.environment)
+		fnenv.localScope = ( fndef.expression == nil )
+		leafptr = expr.firstArgument()
+		argptr = fndef.arglist.right
 		//fmt.Printf("Function arglist leaf: %s (%+v)\n", argptr.toString(), argptr)
 		//fmt.Printf("Calling user function %s(", fndef.name)
 		for ( leafptr != nil && argptr != nil) {
@@ -370,12 +418,12 @@ func (self *BasicRuntime) userFunction(expr *BasicASTLeaf, lval *BasicValue, rva
 				return nil, err
 			}
 			//fmt.Printf("%s = %s, \n", argptr.toString(), leafvalue.toString())
-			fndef.environment.set(argptr, leafvalue)
+			fnenv.create(argptr.identifier).set(leafvalue, 0)
 			leafptr = leafptr.right
 			argptr = argptr.right
 		}
 		//fmt.Printf(")\n")
-		self.environment = &fndef.environment
+		self.environment = fnenv
 		//self.environment.dumpVariables()
 		if ( fndef.expression != nil ) {
 			leafvalue, err = self.evaluate(fndef.expression)
@@ -384,16 +432,28 @@ func (self *BasicRuntime) userFunction(expr *BasicASTLeaf, lval *BasicValue, rva
 			return leafvalue, err
 		} else {
 			//fmt.Printf("Environment prepped, GOSUB to %d\n", fndef.lineno)
-			self.environment.gosubReturnLine = self.environment.lineno + 1
+			self.environment.gosubReturnLine = self.environment.nextline
+			self.environment.gosubReturnStatement = self.environment.nextstatement
 			self.environment.nextline = fndef.lineno
+			self.environment.nextstatement = fndef.statement
 
 			// pass control to the new environment and let it run until it terminates
 			for ( self.environment != targetenv && self.mode == MODE_RUN ) {
 				self.processLineRun(self.readbuff)
+				if ( self.errno != NOERROR ) {
+					// The error has already been reported, unwind
+					// back to the caller
+					self.environment = targetenv
+					return nil, errors.New(self.errorCodeToString(self.errno))
+				}
+				if ( self.trapUnwinding ) {
+					self.environment = targetenv
+					return nil, errors.New(self.errorCodeToString(self.errorNumber))
+				}
 			}
 			// collect the result from the child environment
-			//fmt.Printf("Subroutine returning %s\n", fndef.environment.returnValue.toString())
-			return &fndef.environment.returnValue, nil
+			//fmt.Printf("Subroutine returning %s\n", fnenv.returnValue.toString())
+			return &fnenv.returnValue, nil
 		}
 	}
 }
@@ -433,6 +493,12 @@ func (self *BasicRuntime) interpret(expr *BasicASTLeaf) (*BasicValue, error) {
 	var value *BasicValue
 	var err error
 	if ( self.environment.isWaitingForAnyCommand() ) {
+		if ( expr.leaftype == LEAF_COMMAND &&
+			strings.Compare(strings.ToUpper(expr.identifier), "DO") == 0 &&
+			self.environment.isWaitingForCommand("LOOP") ) {
+			// We are skipping over a nested DO, so we must skip its LOOP too
+			self.environment.waitingEnvironment("LOOP").doNesting += 1
+		}
 		if ( expr.leaftype != LEAF_COMMAND || !self.environment.isWaitingForCommand(expr.identifier) ) {
 			//fmt.Printf("I am not waiting for %+v\n", expr)
 			return &self.staticTrueValue, nil
@@ -441,7 +507,7 @@ func (self *BasicRuntime) interpret(expr *BasicASTLeaf) (*BasicValue, error) {
 	//fmt.Printf("Interpreting %d : %+v\n", self.environment.lineno, expr)
 	value, err = self.evaluate(expr)
 	if ( err != nil ) {
-		self.basicError(RUNTIME, err.Error())
+		self.basicError(self.errnoFor(err, RUNTIME), err.Error())
 		return nil, err
 	}
 	return value, nil
@@ -460,37 +526,39 @@ func (self *BasicRuntime) interpretImmediate(expr *BasicASTLeaf) (*BasicValue, e
 }
 
 func (self *BasicRuntime) findPreviousLineNumber() int64 {
-	var i int64
-	for i = self.environment.lineno - 1; i > 0 ; i-- {
-		if ( len(self.source[i].code) > 0 ) {
-			return i
-		}
+	var lineno int64
+	var found bool
+	lineno, found = self.source.previous(self.environment.lineno)
+	if ( found && lineno > 0 ) {
+		return lineno
 	}
 	return self.environment.lineno
 }
 
 func (self *BasicRuntime) processLineRunStream(readbuff *bufio.Scanner) {
 	var line string
+	var err error = nil
 	// All we're doing is getting the line #
 	// and storing the source line in this mode.
 	if ( readbuff.Scan() ) {
 		line = readbuff.Text()
 		//fmt.Printf("processLineRunStream loaded %s\n", line)
-		if ( self.mode == MODE_REPL ) {
-			// DLOAD calls this method from inside of
-			// MODE_REPL. In that case we want to strip the
-			// line numbers off the beginning of the lines
-			// the same way we do in the repl.
-			line = self.scanner.scanTokens(line)
-		} else {
-			self.scanner.scanTokens(line)
+		// Strip the line number off the beginning of the line
+		// the same way we do in the repl, so that the stored code
+		// is the same however the line was entered.
+		line = self.scanner.scanTokens(line)
+		if ( self.scanner.hasError ) {
+			return
 		}
-		self.source[self.environment.lineno] = BasicSourceLine{
-			code:   line,
-			lineno: self.environment.lineno}
+		self.source.set(self.environment.lineno, line)
 	} else {
 		//fmt.Printf("processLineRunStream exiting\n")
 		self.environment.nextline = 0
+		self.environment.nextstatement = 0
+		err = self.scanData()
+		if ( err != nil ) {
+			self.basicError(self.errnoFor(err, SYNTAX), err.Error())
+		}
 		self.setMode(MODE_RUN)
 	}
 }
@@ -506,6 +574,9 @@ func (self *BasicRuntime) processLineRepl(readbuff *bufio.Scanner) {
 	if ( len(self.userline) > 0 ) {
 		self.environment.lineno += self.autoLineNumber
 		self.userline = self.scanner.scanTokens(self.userline)
+		if ( self.scanner.hasError ) {
+			return
+		}
 		for ( !self.parser.isAtEnd() ) {
 			leaf, err = self.parser.parse()
 			if ( err != nil ) {
@@ -515,11 +586,12 @@ func (self *BasicRuntime) processLineRepl(readbuff *bufio.Scanner) {
 			//fmt.Printf("%+v\n", leaf)
 			//fmt.Printf("%+v\n", leaf.right)
 			value, err = self.interpretImmediate(leaf)
-			if ( value == nil ) {
+			if ( err != nil ) {
+				self.basicError(self.errnoFor(err, RUNTIME), err.Error())
+				return
+			} else if ( value == nil ) {
 				// Only store the line and increment the line number if we didn't run an immediate command
-				self.source[self.environment.lineno] = BasicSourceLine{
-					code:   self.userline,
-					lineno: self.environment.lineno}
+				self.source.set(self.environment.lineno, self.userline)
 			} else if ( self.autoLineNumber > 0 ) {
 				self.environment.lineno = self.findPreviousLineNumber()
 				//fmt.Printf("Reset line number to %d\n", self.environment.lineno)
@@ -531,152 +603,168 @@ func (self *BasicRuntime) processLineRepl(readbuff *bufio.Scanner) {
 
 func (self *BasicRuntime) processLineRun(readbuff *bufio.Scanner) {
 	var line string
+	var statements []string
 	var leaf *BasicASTLeaf = nil
+	var lineno int64
+	var found bool
 	var err error = nil
-	//fmt.Printf("RUN line %d\n", self.environment.nextline)
-	if ( self.environment.nextline >= MAX_SOURCE_LINES ) {
+	//fmt.Printf("RUN line %d:%d\n", self.environment.nextline, self.environment.nextstatement)
+	lineno, found = self.source.next(self.environment.nextline)
+	if ( !found ) {
 		self.setMode(self.run_finished_mode)
 		return
 	}
-	line = self.source[self.environment.nextline].code
+	if ( lineno != self.environment.nextline ) {
+		// Skip straight to the next line that exists
+		self.environment.nextline = lineno
+		self.environment.nextstatement = 0
+	}
+	line = self.source.get(lineno)
 	self.environment.lineno = self.environment.nextline
-	self.environment.nextline += 1
-	if ( line == "" ) {
+	self.environment.statement = self.environment.nextstatement
+	// Only one statement is executed per call. Work out where we go
+	// next before parsing, since commands like FOR copy it into the
+	// environment they create and commands like GOTO overwrite it.
+	statements = self.scanner.splitStatements(line)
+	if ( self.environment.statement + 1 < int64(len(statements)) ) {
+		self.environment.nextstatement = self.environment.statement + 1
+	} else {
+		self.environment.nextline += 1
+		self.environment.nextstatement = 0
+	}
+	if ( self.environment.statement >= int64(len(statements)) ) {
+		return
+	}
+	//fmt.Println(statements[self.environment.statement])
+	self.scanner.scanTokens(statements[self.environment.statement])
+	if ( self.scanner.hasError ) {
 		return
 	}
-	//fmt.Println(line)
-	self.scanner.scanTokens(line)
 	for ( !self.parser.isAtEnd() ) {
 		leaf, err = self.parser.parse()
 		if ( err != nil ) {
-			self.basicError(PARSE, err.Error())
-			self.setMode(self.run_finished_mode)
+			self.basicError(self.errnoFor(err, PARSE), err.Error())
+			if ( self.errno != 0 ) {
+				self.setMode(self.run_finished_mode)
+			}
 			return
 		}
 		_, _ = self.interpret(leaf)
 	}
 }
 
-func (self *BasicRuntime) setMode(mode int) {
-	self.mode = mode
-	if ( self.mode == MODE_REPL ) {
-		self.Println("READY")
+// skipToElse is called when an IF condition is false. Control passes to
+// the first ELSE statement later on the same line, or to the next line
+// if there isn't one.
+func (self *BasicRuntime) skipToElse() {
+	var statements []string
+	var i int64
+
+	statements = self.scanner.splitStatements(self.source.get(self.environment.lineno))
+	for i = self.environment.statement + 1; i < int64(len(statements)); i++ {
+		if ( self.scanner.isElseStatement(statements[i]) ) {
+			self.environment.nextline = self.environment.lineno
+			self.environment.nextstatement = i
+			self.environment.ifTakeElse = true
+			return
+		}
 	}
+	self.environment.nextline = self.environment.lineno + 1
+	self.environment.nextstatement = 0
 }
 
-func (self *BasicRuntime) sdlEvents() error {
-	var ir rune
-	var sb strings.Builder
-	var i int
-	var err error
-	for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
-		switch t := event.(type) {
-		case *sdl.QuitEvent:
-			self.setMode(MODE_QUIT)
-		case *sdl.TextInputEvent:
-			// This is LAZY but it works on US ASCII keyboards so I guess
-			// international users go EFF themselves? It's how we did it in the old days...
-			ir = rune(t.Text[0])
-			if ( unicode.IsPrint(ir) ) {
-				self.lineInProgress[self.userlineIndex] = ir
-				self.userlineIndex += 1
-				err = self.drawText(
-					(self.cursorX * int32(self.fontWidth)),
-					(self.cursorY * int32(self.fontHeight)),
-					string(ir),
-					true)
-				if ( err != nil ) {
-					fmt.Println(err)
-					return err
-				}
-				self.advanceCursor(1, 0)
+// scanData collects the values of every DATA statement in the program, in
+// line order, so that READ doesn't depend on the order the program runs in.
+func (self *BasicRuntime) scanData() error {
+	var statements []string
+	var leaf *BasicASTLeaf = nil
+	var item *BasicASTLeaf = nil
+	var next *BasicASTLeaf = nil
+	var err error = nil
+
+	self.data = nil
+	self.dataIdx = 0
+	// Scanning replaces the tokens of the line we are running from,
+	// so do it in an environment of its own.
+	self.newEnvironment()
+	defer self.prevEnvironment()
+	for _, sourceline := range(self.source.all()) {
+		statements = self.scanner.splitStatements(sourceline.code)
+		for _, statement := range(statements) {
+			if ( !self.scanner.isCommandStatement(statement, "DATA") ) {
+				continue
 			}
-		case *sdl.KeyboardEvent:
-			err = self.drawText(
-				(self.cursorX * int32(self.fontWidth)),
-				(self.cursorY * int32(self.fontHeight)),
-				" ",
-				true)
-			if ( t.Type == sdl.KEYUP ) {
-				//fmt.Printf("Key released: %s (Scancode: %d, Keycode: %d)\n", sdl.GetKeyName(t.Keysym.Sym), t.Keysym.Scancode, t.Keysym.Sym)
-				ir = self.runeForSDLScancode(t.Keysym)
-				//fmt.Printf("Rune: %c", ir)
-				if ( ir == sdl.K_LEFT ) {
-					if ( self.userlineIndex == 0 ) {
-						return nil
-					}
-					err = self.drawText(
-						(self.cursorX * int32(self.fontWidth)),
-						(self.cursorY * int32(self.fontHeight)),
-						string(self.lineInProgress[self.userlineIndex]),
-						true)
-					self.userlineIndex -= 1
-					self.advanceCursor(-1, 0)
-				} else if ( ir == sdl.K_RIGHT ) {
-					if ( self.userlineIndex >= MAX_LINE_LENGTH ||
-						self.lineInProgress[self.userlineIndex] == 0 ) {
-						return nil
-					}
-					err = self.drawText(
-						(self.cursorX * int32(self.fontWidth)),
-						(self.cursorY * int32(self.fontHeight)),
-						string(self.lineInProgress[self.userlineIndex]),
-						true)
-					self.userlineIndex += 1
-					self.advanceCursor(+1, 0)
-				} else if ( ir == sdl.K_BACKSPACE ) {
-					if ( self.userlineIndex == 0 ) {
-						return nil
-					}
-					self.lineInProgress[self.userlineIndex-1] = 0
-					self.userlineIndex -= 1
-					if ( err != nil ) {
-						return err
-					}
-					self.advanceCursor(-1, 0)
-					err = self.drawText(
-						(self.cursorX * int32(self.fontWidth)),
-						(self.cursorY * int32(self.fontHeight)),
-						" ",
-						true)
-					if ( err != nil ) {
-						return err
-					}
-				} else if ( ir == sdl.K_RETURN || ir == '\n' ) {
-					self.userline = ""
-					for i = 0; i <= self.userlineIndex; i++  {
-						if ( self.lineInProgress[i] == 0 ) {
-							break
-						}
-						sb.WriteRune(self.lineInProgress[i])
-						self.lineInProgress[i] = 0
-					}
-					//fmt.Printf("\n")
-					self.userline = sb.String()
-					self.userlineIndex = 0
-					//fmt.Println(self.userline)
-					//self.Println(self.userline)
-					self.advanceCursor(-(self.cursorX), 1)
-				}
+			self.environment.lineno = sourceline.lineno
+			self.scanner.scanTokens(statement)
+			if ( self.scanner.hasError ) {
+				return newBasicRuntimeError(SYNTAX, "Unable to scan DATA on line %d", sourceline.lineno)
+			}
+			leaf, err = self.parser.parse()
+			if ( err != nil ) {
+				return newBasicRuntimeError(SYNTAX, "%s on line %d", err.Error(), sourceline.lineno)
+			}
+			for item = leaf.firstArgument(); item != nil; item = next {
+				// Items are chained through .right, which we
+				// don't want to clone along with each one
+				next = item.right
+				item.right = nil
+				self.data = append(self.data, BasicDataItem{
+					leaf: item.clone(),
+					lineno: sourceline.lineno})
 			}
 		}
 	}
 	return nil
 }
 
-func (self *BasicRuntime) runeForSDLScancode(keysym sdl.Keysym) rune {
-	var rc rune = 0
-	var keyboardstate []uint8
-	rc = rune(keysym.Sym)
-	keyboardstate = sdl.GetKeyboardState()
-	if ( keyboardstate[sdl.SCANCODE_LSHIFT] != 0 ||
-		keyboardstate[sdl.SCANCODE_RSHIFT] != 0 ) {
-		if ( unicode.IsUpper(rc) ) {
-			return unicode.ToLower(rc)
+// Write and Println put text on the screen and then hand it to the
+// frontend, which shows it
+func (self *BasicRuntime) Write(text string) {
+	self.screen.print(text)
+	self.frontend.Write(text)
+}
+
+func (self *BasicRuntime) Println(text string) {
+	self.screen.print(text + "\n")
+	self.frontend.Println(text)
+}
+
+// updateSprites moves the sprites along, and GOSUBs to the line set by
+// COLLISION when sprites start colliding in a running program
+func (self *BasicRuntime) updateSprites() {
+	var started [COLLISION_TYPES]int64
+	var env *BasicEnvironment = nil
+	var i int
+
+	started = self.sprites.update()
+	if ( self.mode != MODE_RUN ) {
+		return
+	}
+	for env = self.environment; env != nil; env = env.parent {
+		if ( env == self.sprites.collisionEnvironment ) {
+			// Collisions wait until the last one's subroutine returns
+			return
+		}
+	}
+	for i = 0; i < COLLISION_TYPES; i++ {
+		if ( started[i] == 0 || self.sprites.collisionLines[i] == 0 ) {
+			continue
 		}
-		return unicode.ToUpper(rc)
+		self.newEnvironment()
+		self.environment.gosubReturnLine = self.environment.nextline
+		self.environment.gosubReturnStatement = self.environment.nextstatement
+		self.environment.nextline = self.sprites.collisionLines[i]
+		self.environment.nextstatement = 0
+		self.sprites.collisionEnvironment = self.environment
+		return
+	}
+}
+
+func (self *BasicRuntime) setMode(mode int) {
+	self.mode = mode
+	if ( self.mode == MODE_REPL ) {
+		self.Println("READY")
 	}
-	return rc
 }
 
 func (self *BasicRuntime) run(fileobj io.Reader, mode int) {
@@ -686,27 +774,30 @@ func (self *BasicRuntime) run(fileobj io.Reader, mode int) {
 	self.setMode(mode)
 	if ( self.mode == MODE_REPL ) {
 		self.run_finished_mode = MODE_REPL
-		sdl.StartTextInput()
+		self.frontend.startTextInput()
 	} else {
 		self.run_finished_mode = MODE_QUIT
 	}
 	for {
 		//fmt.Printf("Starting in mode %d\n", self.mode)
-		self.drawPrintBuffer()
+		self.frontend.drawPrintBuffer()
+		self.frontend.drawGraphics()
+		self.updateSprites()
 		self.zero()
 		self.parser.zero()
 		self.scanner.zero()
 		switch (self.mode) {
 		case MODE_QUIT:
+			self.closeFiles()
 			return
 		case MODE_RUNSTREAM:
 			self.processLineRunStream(self.readbuff)
 		case MODE_REPL:
-			err = self.sdlEvents()
+			err = self.frontend.processEvents()
 			if ( err != nil ) {
 				self.basicError(RUNTIME, err.Error())
 			}
-			err = self.drawCursor()
+			err = self.frontend.drawCursor()
 			if ( err != nil ) {
 				self.basicError(RUNTIME, err.Error())
 			}
@@ -716,6 +807,7 @@ func (self *BasicRuntime) run(fileobj io.Reader, mode int) {
 		}
 		if ( self.errno != 0 ) {
 			self.setMode(self.run_finished_mode)
+			self.errno = 0
 		}
 		//fmt.Printf("Finishing in mode %d\n", self.mode)
 	}
@@ -5,17 +5,42 @@ import (
 	"errors"
 	"strings"
 	"unsafe"
-	//"os"
+	"os"
 	"io"
-	"github.com/veandco/go-sdl2/sdl"
 	"bufio"
+	"bytes"
+	"math"
+	"slices"
 	"strconv"
+	"unicode"
+	"unicode/utf8"
 )
 
+// Commands which may be followed by the line number(s) they refer to
+var lineReferenceCommands = []string{
+	"ELSE",
+	"GOSUB",
+	"GOTO",
+	"RESTORE",
+	"RESUME",
+	"THEN",
+	"TRAP"}
+
 func (self *BasicRuntime) CommandDEF(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
 	return &self.staticTrueValue, nil
 }
 
+func (self *BasicRuntime) CommandGLOBAL(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var identifier *BasicASTLeaf = nil
+	if ( expr.right == nil || expr.right.leaftype != LEAF_ARGUMENTLIST ) {
+		return nil, errors.New("Expected GLOBAL|SHARED IDENTIFIER[, ...]")
+	}
+	for identifier = expr.right.right; identifier != nil; identifier = identifier.right {
+		self.environment.declareGlobal(identifier.identifier)
+	}
+	return &self.staticTrueValue, nil
+}
+
 func (self *BasicRuntime) CommandDIM(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
 	var varref *BasicVariable
 	var sizes []int64
@@ -59,48 +84,104 @@ func (self *BasicRuntime) CommandDIM(expr *BasicASTLeaf, lval *BasicValue, rval
 
 func (self *BasicRuntime) CommandDLOAD(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
 	var err error = nil
-	var scanner *bufio.Scanner = nil
-	var runtimemode int = self.mode
-	if ( expr.right == nil ) {
-		return nil, errors.New("Expected expression")
+	var path string
+	path, err = self.programFileName(expr)
+	if ( err != nil ) {
+		return nil, err
 	}
-	rval, err = self.evaluate(expr.right)
+	return self.loadProgram(path, false)
+}
+
+func (self *BasicRuntime) CommandAPPEND(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	return self.CommandMERGE(expr, lval, rval)
+}
+
+func (self *BasicRuntime) CommandMERGE(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var err error = nil
+	var path string
+	path, err = self.programFileName(expr)
 	if ( err != nil ) {
 		return nil, err
 	}
-	if ( rval.valuetype != TYPE_STRING ) {
-		return nil, errors.New("Expected STRING")
+	return self.loadProgram(path, true)
+}
+
+// loadProgram reads the program in path, in any of the formats DLOAD
+// understands. Unless merge is set the current program is replaced by it,
+// otherwise its lines are added to the current program, replacing any
+// lines which have the same numbers.
+func (self *BasicRuntime) loadProgram(path string, merge bool) (*BasicValue, error) {
+	var err error = nil
+	var data []byte
+	var lines []BasicSourceLine
+	var keywords map[int64][]string = nil
+	var ok bool
+	data, err = self.readProgramFile(path)
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( isTokenizedProgram(data) ) {
+		// Programs written by SAVE don't have to be scanned
+		lines, err = detokenizeProgram(data)
+	} else if ( isCommodorePRG(data) ) {
+		lines, keywords, err = decodePRG(data)
+	} else {
+		lines, ok = self.scanProgramText(data)
+		if ( !ok ) {
+			// The scanner has already reported the error
+			return &self.staticFalseValue, nil
+		}
+	}
+	if ( err != nil ) {
+		return nil, err
 	}
-	f := sdl.RWFromFile(rval.stringval, "r")
-	if ( f == nil ) {
-		return nil, sdl.GetError()
+	if ( !merge ) {
+		self.source.clear()
+		self.environment.lineno = 0
+		self.environment.nextline = 0
+		self.environment.nextstatement = 0
 	}
-	defer io.Closer.Close(f)
-	scanner = bufio.NewScanner(f)
-	for _, sourceline := range(self.source) {
-		sourceline.code = ""
-		sourceline.lineno = 0
+	for _, sourceline := range(lines) {
+		self.source.set(sourceline.lineno, sourceline.code)
 	}
-	self.environment.lineno = 0
-	self.environment.nextline = 0
-	// Not sure how it will work resetting the runtime's state
-	// from within this function....
-	
-	for {
-		self.zero()
-		self.parser.zero()
+	if ( keywords != nil ) {
+		self.warnUnsupportedKeywords(keywords)
+	}
+	return &self.staticTrueValue, nil
+}
+
+// scanProgramText returns the lines of a program written by DSAVE. It
+// returns false if a line can't be scanned.
+func (self *BasicRuntime) scanProgramText(data []byte) ([]BasicSourceLine, bool) {
+	var scanner *bufio.Scanner = bufio.NewScanner(bytes.NewReader(data))
+	var lines []BasicSourceLine
+	var code string
+	// Scanning replaces the tokens of the line we are running from,
+	// so do it in an environment of its own.
+	self.newEnvironment()
+	defer self.prevEnvironment()
+	for ( scanner.Scan() ) {
+		if ( len(strings.TrimSpace(scanner.Text())) == 0 ) {
+			continue
+		}
 		self.scanner.zero()
-		self.processLineRunStream(scanner)
-		if ( self.environment.nextline == 0 && self.mode == MODE_RUN ) {
-			break
+		// Strip the line number off the beginning of the line the same
+		// way we do in the repl, so that the stored code is the same
+		// however the line was entered.
+		code = self.scanner.scanTokens(scanner.Text())
+		if ( self.scanner.hasError ) {
+			return nil, false
 		}
+		lines = append(lines, BasicSourceLine{
+			code: code,
+			lineno: self.environment.lineno})
 	}
-	self.setMode(runtimemode)
-	return &self.staticTrueValue, nil
+	return lines, true
 }
 
 func (self *BasicRuntime) CommandDSAVE(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
 	var err error = nil
+	var path string
 	if ( expr.right == nil ) {
 		return nil, errors.New("Expected expression")
 	}
@@ -111,216 +192,812 @@ func (self *BasicRuntime) CommandDSAVE(expr *BasicASTLeaf, lval *BasicValue, rva
 	if ( rval.valuetype != TYPE_STRING ) {
 		return nil, errors.New("Expected STRING")
 	}
-	f := sdl.RWFromFile(rval.stringval, "w")
-	if ( f == nil ) {
-		return nil, sdl.GetError()
+	path, err = self.drive.resolve(rval.stringval)
+	if ( err != nil ) {
+		return nil, err
 	}
-	defer io.Closer.Close(f)
-	for _, sourceline := range(self.source) {
-		if ( len(sourceline.code) == 0 ) {
-			continue
-		}
-		f.Write([]byte(fmt.Sprintf("%d %s\n", sourceline.lineno, sourceline.code)))
+	err = self.writeProgramFile(path, self.source.text())
+	if ( err != nil ) {
+		return nil, err
 	}
 	return &self.staticTrueValue, nil
 }
 
-func (self *BasicRuntime) CommandLABEL(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
-	var err error
-	// LABEL IDENTIFIER
-	// expr.right should be an identifier
-	if ( expr == nil ||
-		expr.right == nil ||
-		expr.right.isIdentifier() == false ) {
-		return nil, errors.New("Expected LABEL IDENTIFIER")
+// warnUnsupportedKeywords prints a warning for each of the Commodore
+// keywords used on each line of a PRG file which can't be used here
+func (self *BasicRuntime) warnUnsupportedKeywords(keywords map[int64][]string) {
+	var lines []int64
+	var warned map[string]bool
+	var name string
+	var renamed bool
+	var supported bool
+
+	for lineno, _ := range(keywords) {
+		lines = append(lines, lineno)
+	}
+	slices.Sort(lines)
+	for _, lineno := range(lines) {
+		warned = make(map[string]bool)
+		for _, keyword := range(keywords[lineno]) {
+			name, renamed = prgKeywordNames[keyword]
+			if ( !renamed ) {
+				name = strings.TrimRight(keyword, "(#")
+			}
+			if ( !isKeywordCharacter(name[0]) && name != "π" ) {
+				// Operators
+				continue
+			}
+			_, supported = self.scanner.commands[name]
+			if ( !supported ) {
+				_, supported = self.scanner.reservedwords[name]
+			}
+			if ( !supported ) {
+				supported = ( self.environment.getFunction(name) != nil )
+			}
+			if ( !supported && !warned[name] ) {
+				self.Println(fmt.Sprintf("? %d : WARNING %s is not supported", lineno, name))
+				warned[name] = true
+			}
+		}
 	}
-	err = self.environment.setLabel(expr.right.identifier, self.environment.lineno)
+}
+
+func (self *BasicRuntime) CommandLOAD(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	return self.CommandDLOAD(expr, lval, rval)
+}
+
+func (self *BasicRuntime) writeProgramFile(path string, data []byte) error {
+	var err error = os.WriteFile(path, data, 0644)
 	if ( err != nil ) {
-		return &self.staticFalseValue, err
+		return newBasicRuntimeError(IO, "%s", err)
 	}
-	return &self.staticTrueValue, nil
+	return nil
 }
 
-func (self *BasicRuntime) CommandPRINT(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+func (self *BasicRuntime) readProgramFile(path string) ([]byte, error) {
+	var data []byte
+	var err error = nil
+
+	data, err = os.ReadFile(path)
+	if ( errors.Is(err, os.ErrNotExist) ) {
+		return nil, newBasicRuntimeError(FILE_NOT_FOUND, "%s", self.drive.name(path))
+	} else if ( err != nil ) {
+		return nil, newBasicRuntimeError(IO, "%s", err)
+	}
+	return data, nil
+}
+
+// programFileName returns where the file named by the argument of SAVE or
+// VERIFY is on the drive
+func (self *BasicRuntime) programFileName(expr *BasicASTLeaf) (string, error) {
 	var err error = nil
+	var rval *BasicValue = nil
+
 	if ( expr.right == nil ) {
-		return nil, errors.New("Expected expression")
+		return "", newBasicRuntimeError(MISSING_FILE_NAME, "Expected a file name")
 	}
 	rval, err = self.evaluate(expr.right)
+	if ( err != nil ) {
+		return "", err
+	}
+	if ( rval.valuetype != TYPE_STRING ) {
+		return "", newBasicRuntimeError(MISSING_FILE_NAME, "Expected STRING")
+	}
+	return self.drive.resolve(rval.stringval)
+}
+
+func (self *BasicRuntime) CommandSAVE(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// SAVE "NAME"
+	var err error = nil
+	var path string
+
+	path, err = self.programFileName(expr)
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( strings.HasSuffix(strings.ToUpper(path), ".PRG") ) {
+		err = self.writeProgramFile(path, self.source.prg(PRG_ADDRESS_DEFAULT))
+	} else {
+		err = self.writeProgramFile(path, self.source.tokenize())
+	}
 	if ( err != nil ) {
 		return nil, err
 	}
-	self.Println(rval.toString())
 	return &self.staticTrueValue, nil
 }
 
-func (self *BasicRuntime) CommandGOTO(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+func (self *BasicRuntime) CommandVERIFY(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// VERIFY "NAME"
 	var err error = nil
-	if ( expr.right == nil ) {
-		return nil, errors.New("Expected expression")
+	var path string
+	var data []byte
+	var program []byte
+
+	path, err = self.programFileName(expr)
+	if ( err != nil ) {
+		return nil, err
 	}
-	rval, err = self.evaluate(expr.right)
+	data, err = self.readProgramFile(path)
 	if ( err != nil ) {
 		return nil, err
 	}
-	if ( rval.valuetype != TYPE_INTEGER ) {
-		return nil, errors.New("Expected integer")
+	// Compare with whichever of SAVE or DSAVE wrote the file
+	if ( isTokenizedProgram(data) ) {
+		program = self.source.tokenize()
+	} else if ( isCommodorePRG(data) ) {
+		program = self.source.prg(int(data[0]) | (int(data[1]) << 8))
+	} else {
+		program = self.source.text()
+	}
+	if ( !bytes.Equal(data, program) ) {
+		return nil, newBasicRuntimeError(VERIFY, "%s does not match the program in memory", self.drive.name(path))
+	}
+	if ( self.mode == MODE_REPL ) {
+		self.Println("OK")
 	}
-	self.environment.nextline = rval.intval
 	return &self.staticTrueValue, nil
 }
 
-func (self *BasicRuntime) CommandGOSUB(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+func (self *BasicRuntime) CommandDVERIFY(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	return self.CommandVERIFY(expr, lval, rval)
+}
+
+func (self *BasicRuntime) CommandDIRECTORY(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// DIRECTORY ["PATTERN"]
 	var err error = nil
-	if ( expr.right == nil ) {
-		return nil, errors.New("Expected expression")
+	var pattern string = "*"
+	var matches []string
+	var info os.FileInfo
+	var kind string
+
+	if ( expr.right != nil ) {
+		rval, err = self.evaluate(expr.right)
+		if ( err != nil ) {
+			return nil, err
+		}
+		if ( rval.valuetype != TYPE_STRING ) {
+			return nil, errors.New("Expected STRING")
+		}
+		pattern = rval.stringval
 	}
-	rval, err = self.evaluate(expr.right)
+	matches, err = self.drive.glob(pattern)
 	if ( err != nil ) {
 		return nil, err
 	}
-	if ( rval.valuetype != TYPE_INTEGER ) {
-		return nil, errors.New("Expected integer")
+	for _, path := range(matches) {
+		info, err = os.Stat(path)
+		if ( err != nil ) {
+			continue
+		}
+		kind = "SEQ"
+		if ( info.IsDir() ) {
+			kind = "DIR"
+		}
+		// Sizes are in 254 byte blocks, like a Commodore disk
+		self.Println(fmt.Sprintf("%-5d%-18s %s", (info.Size() + 253) / 254, "\"" + self.drive.name(path) + "\"", kind))
 	}
-	self.newEnvironment()
-	self.environment.gosubReturnLine = self.environment.lineno + 1
-	self.environment.nextline = rval.intval
 	return &self.staticTrueValue, nil
 }
 
-func (self *BasicRuntime) CommandPOKE(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+func (self *BasicRuntime) CommandCATALOG(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	return self.CommandDIRECTORY(expr, lval, rval)
+}
+
+func (self *BasicRuntime) CommandSCRATCH(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// SCRATCH "PATTERN"
 	var err error = nil
-	var addr uintptr
-	var ptr unsafe.Pointer
-	var typedPtr *byte
-	
-	if ( expr == nil ) {
-		return nil, errors.New("NIL leaf")
+	var matches []string
+	var fields []string
+	var info os.FileInfo
+	var count int = 0
+
+	if ( expr.right == nil ) {
+		return nil, newBasicRuntimeError(MISSING_FILE_NAME, "Expected SCRATCH (name)")
 	}
-	expr = expr.firstArgument()
-	if (expr != nil) {
-		self.eval_clone_identifiers = false
-		lval, err = self.evaluate(expr)
-		self.eval_clone_identifiers = true
+	rval, err = self.evaluate(expr.right)
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( rval.valuetype != TYPE_STRING ) {
+		return nil, newBasicRuntimeError(MISSING_FILE_NAME, "Expected SCRATCH (name)")
+	}
+	matches, err = self.drive.glob(rval.stringval)
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( self.mode == MODE_REPL ) {
+		fields, err = self.inputFields("ARE YOU SURE? ", fields)
 		if ( err != nil ) {
 			return nil, err
 		}
-		if ( lval.valuetype != TYPE_INTEGER ) {
-			return nil, errors.New("POKE expected INTEGER, INTEGER")
+		if ( len(fields) == 0 || !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(fields[0])), "Y") ) {
+			return &self.staticFalseValue, nil
 		}
-		if ( expr.right == nil ||
-			expr.right.leaftype != LEAF_LITERAL_INT &&
-			expr.right.leaftype != LEAF_IDENTIFIER_INT) {
-			return nil, errors.New("POKE expected INTEGER, INTEGER")
+	}
+	for _, path := range(matches) {
+		info, err = os.Stat(path)
+		if ( err != nil || info.IsDir() ) {
+			continue
 		}
-		rval, err = self.evaluate(expr.right)
-		
-		addr = uintptr(lval.intval)
-		//fmt.Printf("addr: %v\n", addr)
-		ptr = unsafe.Pointer(addr)
-		typedPtr = (*byte)(ptr)
-		//fmt.Printf("Before set: %d\n", *typedPtr)
-		*typedPtr = byte(rval.intval)
-		//fmt.Printf("After set: %d\n", *typedPtr)
-		return &self.staticTrueValue, nil
+		err = os.Remove(path)
+		if ( err != nil ) {
+			return nil, newBasicRuntimeError(IO, "%s", err)
+		}
+		count += 1
 	}
-	return nil, errors.New("POKE expected INTEGER, INTEGER")
+	if ( self.mode == MODE_REPL ) {
+		self.Println(fmt.Sprintf("%d FILES SCRATCHED", count))
+	}
+	return &self.staticTrueValue, nil
 }
 
+// fileNamePair returns where the source and destination files of RENAME,
+// COPY or CONCAT are on the drive
+func (self *BasicRuntime) fileNamePair(expr *BasicASTLeaf) (string, string, error) {
+	var err error = nil
+	var names []string
+	var path string
+	var rval *BasicValue = nil
 
-func (self *BasicRuntime) CommandRETURN(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
-	var err error
-	if ( self.environment.isWaitingForCommand("RETURN") ) {
-		// we probably got here from a DEF line and should not execute, just return
-		self.environment.stopWaiting("RETURN")
-		return &self.staticTrueValue, nil
+	for argument := expr.firstArgument(); argument != nil; argument = argument.right {
+		rval, err = self.evaluate(argument)
+		if ( err != nil ) {
+			return "", "", err
+		}
+		if ( rval.valuetype != TYPE_STRING ) {
+			return "", "", newBasicRuntimeError(MISSING_FILE_NAME, "Expected (source) TO (destination)")
+		}
+		path, err = self.drive.resolve(rval.stringval)
+		if ( err != nil ) {
+			return "", "", err
+		}
+		names = append(names, path)
 	}
-	if ( self.environment.gosubReturnLine == 0 ) {
-		return nil, errors.New("RETURN outside the context of GOSUB")
+	if ( len(names) != 2 ) {
+		return "", "", newBasicRuntimeError(MISSING_FILE_NAME, "Expected (source) TO (destination)")
 	}
-	//fmt.Printf("RETURN : %s\n", expr.toString())
-	if ( expr.right != nil ) {
-		rval, err = self.evaluate(expr.right)
-	} else {
-		rval = &self.staticTrueValue
-		err = nil
+	_, err = os.Stat(names[0])
+	if ( err != nil ) {
+		return "", "", newBasicRuntimeError(FILE_NOT_FOUND, "%s", self.drive.name(names[0]))
 	}
-	self.environment.parent.nextline = self.environment.gosubReturnLine
-	rval.clone(&self.environment.returnValue)
-	self.prevEnvironment()
-	// if ( rval != nil ) {
-	// 	fmt.Printf("RETURNing %s\n", rval.toString())
-	// } else {
-	// 	fmt.Printf("RETURN got an expression but it evaluated to nil : %s\n", err)
-	// }
-	return rval, err
+	return names[0], names[1], nil
 }
 
-
-func (self *BasicRuntime) CommandDELETE(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+// appendFile copies the contents of source onto the end of the file at
+// destination, which is opened with flags
+func (self *BasicRuntime) appendFile(source string, destination string, flags int) error {
 	var err error = nil
-	var startidx int64 = 0
-	var endidx int64 = MAX_SOURCE_LINES - 1
-	var i int64
+	var in *os.File = nil
+	var out *os.File = nil
 
-	if ( expr.right != nil ) {
-		if ( expr.right.leaftype == LEAF_LITERAL_INT ) {
-			rval, err = self.evaluate(expr.right)
-			if ( err != nil ) {
-				return nil, err
-			}
-			if ( rval.valuetype != TYPE_INTEGER ) {
-				return nil, errors.New("Expected integer")
-			}
-			startidx = rval.intval
-		} else if ( expr.right.leaftype == LEAF_BINARY &&
-			expr.right.operator == MINUS ) {
-			lval, err = self.evaluate(expr.right.left)
-			if ( err != nil ) {
-				return nil, err
-			}
-			if ( lval.valuetype != TYPE_INTEGER ) {
-				return nil, errors.New("Expected integer")
-			}			
-			rval, err = self.evaluate(expr.right.right)
-			if ( err != nil ) {
-				return nil, err
-			}
-			if ( rval.valuetype != TYPE_INTEGER ) {
-				return nil, errors.New("Expected integer")
-			}
-			startidx = lval.intval
-			endidx = rval.intval
-		} else if ( expr.right.leaftype == LEAF_UNARY &&
-			expr.right.operator == MINUS ) {
-			rval, err = self.evaluate(expr.right.right)
-			if ( err != nil ) {
-				return nil, err
-			}
-			if ( rval.valuetype != TYPE_INTEGER ) {
-				return nil, errors.New("Expected integer")
-			}
-			endidx = rval.intval
-		}
+	in, err = os.Open(source)
+	if ( err != nil ) {
+		return newBasicRuntimeError(IO, "%s", err)
 	}
-	for i = startidx; i <= endidx; i++ {
-		if ( len(self.source[i].code) > 0 ) {
-			self.source[i].code = ""
+	defer in.Close()
+	out, err = os.OpenFile(destination, flags, 0644)
+	if ( err != nil ) {
+		if ( errors.Is(err, os.ErrExist) ) {
+			return newBasicRuntimeError(IO, "%s already exists", self.drive.name(destination))
+		} else if ( errors.Is(err, os.ErrNotExist) ) {
+			return newBasicRuntimeError(FILE_NOT_FOUND, "%s", self.drive.name(destination))
 		}
+		return newBasicRuntimeError(IO, "%s", err)
 	}
-	return &self.staticTrueValue, nil
+	_, err = io.Copy(out, in)
+	if ( err != nil ) {
+		out.Close()
+		return newBasicRuntimeError(IO, "%s", err)
+	}
+	err = out.Close()
+	if ( err != nil ) {
+		return newBasicRuntimeError(IO, "%s", err)
+	}
+	return nil
 }
 
-func (self *BasicRuntime) CommandLIST(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+func (self *BasicRuntime) CommandRENAME(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// RENAME "OLD NAME" TO "NEW NAME"
 	var err error = nil
-	var startidx int64 = 0
-	var endidx int64 = MAX_SOURCE_LINES - 1
-	var i int64
+	var source string
+	var destination string
 
-	if ( expr.right != nil ) {
-		if ( expr.right.leaftype == LEAF_LITERAL_INT ) {
-			rval, err = self.evaluate(expr.right)
-			if ( err != nil ) {
+	source, destination, err = self.fileNamePair(expr)
+	if ( err != nil ) {
+		return nil, err
+	}
+	_, err = os.Stat(destination)
+	if ( err == nil ) {
+		return nil, newBasicRuntimeError(IO, "%s already exists", self.drive.name(destination))
+	}
+	err = os.Rename(source, destination)
+	if ( err != nil ) {
+		return nil, newBasicRuntimeError(IO, "%s", err)
+	}
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandCOPY(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// COPY "SOURCE" TO "DESTINATION"
+	var err error = nil
+	var source string
+	var destination string
+
+	source, destination, err = self.fileNamePair(expr)
+	if ( err != nil ) {
+		return nil, err
+	}
+	err = self.appendFile(source, destination, os.O_WRONLY | os.O_CREATE | os.O_EXCL)
+	if ( err != nil ) {
+		return nil, err
+	}
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandCONCAT(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// CONCAT "SOURCE" TO "DESTINATION"
+	var err error = nil
+	var source string
+	var destination string
+
+	source, destination, err = self.fileNamePair(expr)
+	if ( err != nil ) {
+		return nil, err
+	}
+	err = self.appendFile(source, destination, os.O_WRONLY | os.O_APPEND)
+	if ( err != nil ) {
+		return nil, err
+	}
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandLABEL(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var err error
+	// LABEL IDENTIFIER
+	// expr.right should be an identifier
+	if ( expr == nil ||
+		expr.right == nil ||
+		expr.right.isIdentifier() == false ) {
+		return nil, errors.New("Expected LABEL IDENTIFIER")
+	}
+	err = self.environment.setLabel(expr.right.identifier, self.environment.lineno)
+	if ( err != nil ) {
+		return &self.staticFalseValue, err
+	}
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandPRINT(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var err error = nil
+	var format *BasicValue = nil
+	var item *BasicASTLeaf = nil
+	var text string
+	var position int = 0
+	var formatted bool = false
+	var output strings.Builder
+	var column int = int(self.cursorX)
+	var newline bool = true
+	var file *BasicFile = nil
+
+	if ( expr.left != nil ) {
+		file, err = self.channelFile(expr.left)
+		if ( err != nil ) {
+			return nil, err
+		}
+		column = 0
+	}
+	if ( expr.expr != nil ) {
+		format, err = self.evaluate(expr.expr)
+		if ( err != nil ) {
+			return nil, err
+		}
+		if ( format.valuetype != TYPE_STRING ) {
+			return nil, newBasicRuntimeError(TYPE_MISMATCH, "PRINT USING expected a STRING format")
+		}
+		// The format is evaluated into a value that may be reused
+		// while evaluating the items, so keep a copy of the string.
+		text = strings.Clone(format.stringval)
+	}
+	for item = expr.firstArgument(); item != nil; item = item.right {
+		if ( item.expr != nil ) {
+			if ( item.expr.leaftype == LEAF_FUNCTION && item.expr.identifier == "TAB" ) {
+				rval, err = self.evaluate(item.expr.firstArgument())
+				if ( err != nil ) {
+					return nil, err
+				}
+				if ( rval.valuetype != TYPE_INTEGER ) {
+					return nil, errors.New("TAB expected INTEGER")
+				}
+				if ( int(rval.intval) > column ) {
+					output.WriteString(strings.Repeat(" ", int(rval.intval) - column))
+					column = int(rval.intval)
+				}
+			} else {
+				rval, err = self.evaluate(item.expr)
+				if ( err != nil ) {
+					return nil, err
+				}
+				if ( expr.expr != nil ) {
+					rval.stringval, position, err = self.formatUsing(text, position, rval)
+					if ( err != nil ) {
+						return nil, err
+					}
+					rval.valuetype = TYPE_STRING
+					formatted = true
+				}
+				output.WriteString(rval.toString())
+				column += utf8.RuneCountInString(stripControlCodes(rval.toString()))
+			}
+		}
+		newline = ( item.operator != SEMICOLON && item.operator != COMMA )
+		if ( item.operator == COMMA && expr.expr == nil ) {
+			output.WriteString(strings.Repeat(" ", PRINT_ZONE_WIDTH - (column % PRINT_ZONE_WIDTH)))
+			column += PRINT_ZONE_WIDTH - (column % PRINT_ZONE_WIDTH)
+		}
+	}
+	if ( formatted ) {
+		// The text after the last field used is printed up to the
+		// next field
+		output.WriteString(text[position:self.usingFieldStart(text, position)])
+	}
+	if ( file != nil ) {
+		if ( newline ) {
+			output.WriteString("\n")
+		}
+		err = file.write(output.String())
+		if ( err != nil ) {
+			return nil, err
+		}
+	} else if ( newline ) {
+		self.Println(output.String())
+	} else {
+		self.Write(output.String())
+	}
+	return &self.staticTrueValue, nil
+}
+
+// formatUsing formats value with the next field of a PRINT USING format
+// such as "###.##" or "TOTAL: $#,###.##", starting at position. The text
+// before the field is copied as it is, and the position after the field
+// is returned for the next value. When there are no more fields the rest
+// of the format is copied and the fields are used again from the first.
+// A number which doesn't fit in the field prints as asterisks.
+//
+//   #     A digit, or a character of a string
+//   .     The decimal point
+//   ,     Separate thousands with commas
+//   + -   A leading + always prints the sign. A trailing + or - prints the
+//         sign after the number.
+//   ^^^^  Print the number in scientific notation
+//   = >   Center or right justify a string in the field
+func (self *BasicRuntime) formatUsing(format string, position int, value *BasicValue) (string, int, error) {
+	var start int
+	var end int
+	var field string
+	var result string
+	var wrapped string = ""
+
+	start = self.usingFieldStart(format, position)
+	if ( start == len(format) ) {
+		wrapped = format[position:]
+		position = 0
+		start = self.usingFieldStart(format, position)
+	}
+	if ( start == len(format) ) {
+		return "", 0, newBasicRuntimeError(ILLEGAL_QUANTITY, "PRINT USING format has no field")
+	}
+	for end = start + 1; end < len(format) && strings.IndexByte("#.,^=>", format[end]) >= 0; end++ {
+	}
+	if ( end < len(format) && (format[end] == '+' || format[end] == '-') ) {
+		end += 1
+	}
+	field = format[start:end]
+	switch ( value.valuetype ) {
+	case TYPE_STRING:
+		result = self.formatUsingString(field, value.stringval)
+	case TYPE_INTEGER:
+		result = self.formatUsingNumber(field, float64(value.intval))
+	case TYPE_FLOAT:
+		result = self.formatUsingNumber(field, value.floatval)
+	default:
+		return "", 0, newBasicRuntimeError(TYPE_MISMATCH, "PRINT USING can not format %s", value.toString())
+	}
+	return wrapped + format[position:start] + result, end, nil
+}
+
+// usingFieldStart returns where the next field of a PRINT USING format
+// starts from position, including a leading sign, or the length of the
+// format if there are no more fields.
+func (self *BasicRuntime) usingFieldStart(format string, position int) int {
+	var start int = strings.IndexAny(format[position:], "#=>")
+
+	if ( start < 0 ) {
+		return len(format)
+	}
+	start += position
+	if ( start > position && (format[start - 1] == '+' || format[start - 1] == '-') ) {
+		start -= 1
+	}
+	return start
+}
+
+func (self *BasicRuntime) formatUsingString(field string, text string) string {
+	var characters []rune = []rune(text)
+	var padding int
+
+	if ( len(characters) >= len(field) ) {
+		return string(characters[:len(field)])
+	}
+	padding = len(field) - len(characters)
+	if ( strings.Contains(field, "=") ) {
+		return strings.Repeat(" ", padding / 2) + text + strings.Repeat(" ", padding - (padding / 2))
+	} else if ( strings.Contains(field, ">") ) {
+		return strings.Repeat(" ", padding) + text
+	}
+	return text + strings.Repeat(" ", padding)
+}
+
+func (self *BasicRuntime) formatUsingNumber(field string, number float64) string {
+	var decimals int = 0
+	var point int
+	var digits string
+	var sign string = ""
+	var leadingSign bool = false
+	var trailingSign byte = 0
+	var i int
+
+	if ( field[0] == '+' || field[0] == '-' ) {
+		leadingSign = ( field[0] == '+' )
+		field = field[1:]
+	} else if ( field[len(field) - 1] == '+' || field[len(field) - 1] == '-' ) {
+		trailingSign = field[len(field) - 1]
+		field = field[:len(field) - 1]
+	}
+	point = strings.IndexByte(field, '.')
+	if ( point >= 0 ) {
+		decimals = strings.Count(field[point:], "#")
+	}
+	if ( strings.Contains(field, "^^^^") ) {
+		digits = strconv.FormatFloat(math.Abs(number), 'E', decimals, 64)
+	} else {
+		digits = strconv.FormatFloat(math.Abs(number), 'f', decimals, 64)
+		if ( point >= 0 && decimals == 0 ) {
+			digits += "."
+		}
+		if ( strings.Contains(field, ",") ) {
+			point = strings.IndexByte(digits, '.')
+			if ( point < 0 ) {
+				point = len(digits)
+			}
+			for i = point - 3; i > 0; i -= 3 {
+				digits = digits[:i] + "," + digits[i:]
+			}
+		}
+	}
+	if ( number < 0 ) {
+		sign = "-"
+	} else if ( leadingSign || trailingSign == '+' ) {
+		sign = "+"
+	} else if ( trailingSign == '-' ) {
+		sign = " "
+	}
+	if ( trailingSign != 0 ) {
+		digits = digits + sign
+	} else {
+		digits = sign + digits
+	}
+	if ( leadingSign || trailingSign != 0 ) {
+		field = " " + field
+	}
+	if ( len(digits) > len(field) ) {
+		return strings.Repeat("*", len(field))
+	}
+	return strings.Repeat(" ", len(field) - len(digits)) + digits
+}
+
+func (self *BasicRuntime) CommandGOTO(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var err error = nil
+	if ( expr.right == nil ) {
+		return nil, errors.New("Expected expression")
+	}
+	rval, err = self.evaluate(expr.right)
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( rval.valuetype != TYPE_INTEGER ) {
+		return nil, errors.New("Expected integer")
+	}
+	self.environment.nextline = rval.intval
+	self.environment.nextstatement = 0
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandGOSUB(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var err error = nil
+	if ( expr.right == nil ) {
+		return nil, errors.New("Expected expression")
+	}
+	rval, err = self.evaluate(expr.right)
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( rval.valuetype != TYPE_INTEGER ) {
+		return nil, errors.New("Expected integer")
+	}
+	self.newEnvironment()
+	self.environment.gosubReturnLine = self.environment.nextline
+	self.environment.gosubReturnStatement = self.environment.nextstatement
+	self.environment.nextline = rval.intval
+	self.environment.nextstatement = 0
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandON(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var branch BasicASTLeaf
+	var target *BasicASTLeaf = nil
+	var selector int64 = 0
+	var err error = nil
+
+	if ( expr.expr == nil || expr.right == nil || expr.right.right == nil ) {
+		return nil, errors.New("Expected ON (expression) GOTO|GOSUB (target)[, ...]")
+	}
+	rval, err = self.evaluate(expr.expr)
+	if ( err != nil ) {
+		return nil, err
+	}
+	switch (rval.valuetype) {
+	case TYPE_INTEGER: selector = rval.intval
+	case TYPE_FLOAT: selector = int64(rval.floatval)
+	default:
+		return nil, errors.New("Expected integer")
+	}
+	target = expr.right.right.right
+	for ( target != nil && selector > 1 ) {
+		target = target.right
+		selector -= 1
+	}
+	if ( target == nil || selector < 1 ) {
+		// Out of range selectors fall through to the next statement
+		return &self.staticTrueValue, nil
+	}
+	branch.newCommand(expr.right.identifier, target)
+	if ( strings.Compare(expr.right.identifier, "GOSUB") == 0 ) {
+		return self.CommandGOSUB(&branch, lval, rval)
+	}
+	return self.CommandGOTO(&branch, lval, rval)
+}
+
+func (self *BasicRuntime) CommandTRAP(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var err error = nil
+	if ( expr.right == nil ) {
+		// TRAP with no line number turns error trapping off
+		self.trapEnabled = false
+		return &self.staticTrueValue, nil
+	}
+	rval, err = self.evaluate(expr.right)
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( rval.valuetype != TYPE_INTEGER ) {
+		return nil, errors.New("Expected integer")
+	}
+	self.trapEnabled = true
+	self.trapLine = rval.intval
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandRESUME(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var err error = nil
+	if ( self.inTrap == false ) {
+		return nil, newBasicRuntimeError(CANT_RESUME, "RESUME outside the context of TRAP")
+	}
+	if ( expr.right == nil ) {
+		// Try the statement that caused the error again
+		self.environment.nextline = self.errorLine
+		self.environment.nextstatement = self.errorStatement
+	} else if ( expr.right.leaftype == LEAF_COMMAND &&
+		strings.Compare(expr.right.identifier, "NEXT") == 0 ) {
+		self.environment.nextline = self.resumeNextLine
+		self.environment.nextstatement = self.resumeNextStatement
+	} else {
+		rval, err = self.evaluate(expr.right)
+		if ( err != nil ) {
+			return nil, err
+		}
+		if ( rval.valuetype != TYPE_INTEGER ) {
+			return nil, errors.New("Expected integer")
+		}
+		self.environment.nextline = rval.intval
+		self.environment.nextstatement = 0
+	}
+	self.inTrap = false
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandPOKE(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var err error = nil
+	var addr uintptr
+	var ptr unsafe.Pointer
+	var typedPtr *byte
+	
+	if ( expr == nil ) {
+		return nil, errors.New("NIL leaf")
+	}
+	expr = expr.firstArgument()
+	if (expr != nil) {
+		self.eval_clone_identifiers = false
+		lval, err = self.evaluate(expr)
+		self.eval_clone_identifiers = true
+		if ( err != nil ) {
+			return nil, err
+		}
+		if ( lval.valuetype != TYPE_INTEGER ) {
+			return nil, errors.New("POKE expected INTEGER, INTEGER")
+		}
+		if ( expr.right == nil ||
+			expr.right.leaftype != LEAF_LITERAL_INT &&
+			expr.right.leaftype != LEAF_IDENTIFIER_INT) {
+			return nil, errors.New("POKE expected INTEGER, INTEGER")
+		}
+		rval, err = self.evaluate(expr.right)
+		if ( self.screen.poke(lval.intval, byte(rval.intval)) ) {
+			return &self.staticTrueValue, nil
+		}
+		addr = uintptr(lval.intval)
+		//fmt.Printf("addr: %v\n", addr)
+		ptr = unsafe.Pointer(addr)
+		typedPtr = (*byte)(ptr)
+		//fmt.Printf("Before set: %d\n", *typedPtr)
+		*typedPtr = byte(rval.intval)
+		//fmt.Printf("After set: %d\n", *typedPtr)
+		return &self.staticTrueValue, nil
+	}
+	return nil, errors.New("POKE expected INTEGER, INTEGER")
+}
+
+
+func (self *BasicRuntime) CommandRETURN(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var err error
+	if ( self.environment.isWaitingForCommand("RETURN") ) {
+		// we probably got here from a DEF line and should not execute, just return
+		self.environment.stopWaiting("RETURN")
+		return &self.staticTrueValue, nil
+	}
+	if ( self.environment.gosubReturnLine == 0 ) {
+		return nil, newBasicRuntimeError(RETURN_WITHOUT_GOSUB, "RETURN outside the context of GOSUB")
+	}
+	//fmt.Printf("RETURN : %s\n", expr.toString())
+	if ( expr.right != nil ) {
+		rval, err = self.evaluate(expr.right)
+		if ( err != nil ) {
+			return nil, err
+		}
+	} else {
+		rval = &self.staticTrueValue
+		err = nil
+	}
+	self.environment.parent.nextline = self.environment.gosubReturnLine
+	self.environment.parent.nextstatement = self.environment.gosubReturnStatement
+	rval.clone(&self.environment.returnValue)
+	self.prevEnvironment()
+	// if ( rval != nil ) {
+	// 	fmt.Printf("RETURNing %s\n", rval.toString())
+	// } else {
+	// 	fmt.Printf("RETURN got an expression but it evaluated to nil : %s\n", err)
+	// }
+	return rval, err
+}
+
+
+func (self *BasicRuntime) CommandDELETE(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var err error = nil
+	var startidx int64 = 0
+	var endidx int64 = MAX_LINE_NUMBER
+
+	if ( expr.right != nil ) {
+		if ( expr.right.leaftype == LEAF_LITERAL_INT ) {
+			rval, err = self.evaluate(expr.right)
+			if ( err != nil ) {
 				return nil, err
 			}
 			if ( rval.valuetype != TYPE_INTEGER ) {
@@ -357,18 +1034,199 @@ func (self *BasicRuntime) CommandLIST(expr *BasicASTLeaf, lval *BasicValue, rval
 			endidx = rval.intval
 		}
 	}
-	for i = startidx; i <= endidx; i++ {
-		if ( len(self.source[i].code) > 0 ) {
-			self.Println(fmt.Sprintf("%d %s", self.source[i].lineno, self.source[i].code))
-		}
+	for _, sourceline := range(self.source.between(startidx, endidx)) {
+		self.source.remove(sourceline.lineno)
 	}
 	return &self.staticTrueValue, nil
 }
 
+func (self *BasicRuntime) CommandLIST(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var err error = nil
+	var startidx int64 = 0
+	var endidx int64 = MAX_LINE_NUMBER
+
+	if ( expr.right != nil ) {
+		if ( expr.right.leaftype == LEAF_LITERAL_INT ) {
+			rval, err = self.evaluate(expr.right)
+			if ( err != nil ) {
+				return nil, err
+			}
+			if ( rval.valuetype != TYPE_INTEGER ) {
+				return nil, errors.New("Expected integer")
+			}
+			startidx = rval.intval
+		} else if ( expr.right.leaftype == LEAF_BINARY &&
+			expr.right.operator == MINUS ) {
+			lval, err = self.evaluate(expr.right.left)
+			if ( err != nil ) {
+				return nil, err
+			}
+			if ( lval.valuetype != TYPE_INTEGER ) {
+				return nil, errors.New("Expected integer")
+			}			
+			rval, err = self.evaluate(expr.right.right)
+			if ( err != nil ) {
+				return nil, err
+			}
+			if ( rval.valuetype != TYPE_INTEGER ) {
+				return nil, errors.New("Expected integer")
+			}
+			startidx = lval.intval
+			endidx = rval.intval
+		} else if ( expr.right.leaftype == LEAF_UNARY &&
+			expr.right.operator == MINUS ) {
+			rval, err = self.evaluate(expr.right.right)
+			if ( err != nil ) {
+				return nil, err
+			}
+			if ( rval.valuetype != TYPE_INTEGER ) {
+				return nil, errors.New("Expected integer")
+			}
+			endidx = rval.intval
+		}
+	}
+	for _, sourceline := range(self.source.between(startidx, endidx)) {
+		self.Println(fmt.Sprintf("%d %s", sourceline.lineno, listingText(sourceline.code)))
+	}
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandRENUMBER(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// RENUMBER [NEW START[, INCREMENT[, OLD START]]]
+	var err error = nil
+	var arguments = []int64{10, 10, 0}
+	var argument *BasicASTLeaf = nil
+	var lines []BasicSourceLine
+	var newnumbers map[int64]int64 = make(map[int64]int64)
+	var previous int64
+	var found bool
+	var lineno int64
+	var i int
+
+	if ( self.mode == MODE_RUN ) {
+		// The running program would lose its place
+		return nil, newBasicRuntimeError(DIRECT_MODE_ONLY, "RENUMBER can not be used in a program")
+	}
+	argument = expr.firstArgument()
+	for i = 0; argument != nil; i++ {
+		if ( i >= len(arguments) ) {
+			return nil, errors.New("RENUMBER expected at most 3 arguments")
+		}
+		rval, err = self.evaluate(argument)
+		if ( err != nil ) {
+			return nil, err
+		}
+		if ( rval.valuetype != TYPE_INTEGER || rval.intval < 0 ) {
+			return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "RENUMBER expected positive integers")
+		}
+		arguments[i] = rval.intval
+		argument = argument.right
+	}
+	if ( arguments[1] == 0 ) {
+		return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "RENUMBER increment must be greater than 0")
+	}
+	// Lines before the old start keep their numbers, so the new numbers
+	// have to start after them or the program would be reordered.
+	previous, found = self.source.previous(arguments[2])
+	if ( found && arguments[0] <= previous ) {
+		return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "RENUMBER would overwrite line %d", previous)
+	}
+	lines = self.source.all()
+	lineno = arguments[0]
+	for _, sourceline := range(lines) {
+		if ( sourceline.lineno < arguments[2] ) {
+			newnumbers[sourceline.lineno] = sourceline.lineno
+			continue
+		}
+		if ( lineno > MAX_LINE_NUMBER ) {
+			return nil, newBasicRuntimeError(LINE_NUMBER_TOO_LARGE, "RENUMBER would use lines past %d", MAX_LINE_NUMBER)
+		}
+		newnumbers[sourceline.lineno] = lineno
+		lineno += arguments[1]
+	}
+	// Scanning the program replaces the tokens of the line we are running
+	// from, so do it in an environment of its own.
+	self.newEnvironment()
+	for i, _ = range(lines) {
+		lines[i].code, err = self.renumberReferences(lines[i], newnumbers)
+		if ( err != nil ) {
+			self.prevEnvironment()
+			return nil, err
+		}
+	}
+	self.prevEnvironment()
+	self.source.clear()
+	for _, sourceline := range(lines) {
+		self.source.set(newnumbers[sourceline.lineno], sourceline.code)
+	}
+	return &self.staticTrueValue, nil
+}
+
+// renumberReferences rewrites the line numbers which follow GOTO, GOSUB,
+// THEN, ELSE, TRAP, RESUME and RESTORE in a line of source. The line is
+// scanned so that numbers in string literals and REMs are left alone.
+func (self *BasicRuntime) renumberReferences(sourceline BasicSourceLine, newnumbers map[int64]int64) (string, error) {
+	var code string
+	var inReference bool = false
+	var offset int = 0
+	var start int
+	var lineno int64
+	var newlineno int64
+	var exists bool
+	var lexeme string
+	var err error = nil
+
+	code = self.scanner.scanTokens(sourceline.code)
+	if ( self.scanner.hasError ) {
+		return code, errors.New("Unable to scan line for RENUMBER")
+	}
+	for _, token := range(self.environment.tokens) {
+		switch ( token.tokentype ) {
+		case COMMAND: fallthrough
+		case COMMAND_IMMEDIATE:
+			inReference = slices.Contains(lineReferenceCommands, strings.ToUpper(token.lexeme))
+		case COMMA:
+			// ON ... GOTO and ON ... GOSUB are followed by a list of lines
+		case LITERAL_INT:
+			if ( inReference == false ) {
+				break
+			}
+			lineno, err = strconv.ParseInt(token.lexeme, 10, 64)
+			if ( err != nil ) {
+				break
+			}
+			newlineno, exists = newnumbers[lineno]
+			if ( !exists ) {
+				return code, newBasicRuntimeError(UNRESOLVED_REFERENCE, "Line %d refers to line %d, which does not exist", sourceline.lineno, lineno)
+			}
+			lexeme = strconv.FormatInt(newlineno, 10)
+			start = token.position + offset
+			code = code[:start] + lexeme + code[start + len(token.lexeme):]
+			offset += len(lexeme) - len(token.lexeme)
+		default:
+			inReference = false
+		}
+	}
+	return code, nil
+}
+
 func (self *BasicRuntime) CommandRUN(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
 	var err error = nil
 	//fmt.Println("Processing RUN")
 	self.autoLineNumber = 0
+	self.trapEnabled = false
+	self.inTrap = false
+	self.trapUnwinding = false
+	self.errorNumber = NOERROR
+	self.errorLine = 0
+	self.errorMessage = ""
+	self.sprites.collisionLines = [COLLISION_TYPES]int64{}
+	self.environment.nextstatement = 0
+	self.closeFiles()
+	err = self.scanData()
+	if ( err != nil ) {
+		return nil, err
+	}
 	if ( expr.right == nil ) {
 		self.environment.nextline = 0
 	} else {
@@ -386,294 +1244,1521 @@ func (self *BasicRuntime) CommandRUN(expr *BasicASTLeaf, lval *BasicValue, rval
 	return &self.staticTrueValue, nil
 }
 
-func (self *BasicRuntime) CommandINPUT(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
-	var err error 
-	var promptmsg *BasicValue = nil
-	var assignment *BasicASTLeaf = nil
+func (self *BasicRuntime) CommandINPUT(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var err error = nil
+	var prompt string = ""
+	var fields []string
+	var values []BasicASTLeaf
+	var item *BasicASTLeaf = nil
+	var assignment BasicASTLeaf
+	var assignValue BasicASTLeaf
+
+	if ( expr.left != nil ) {
+		return self.inputFromFile(expr)
+	}
+	if ( expr.expr != nil ) {
+		rval, err = self.evaluate(expr.expr)
+		if ( err != nil ) {
+			return nil, err
+		}
+		prompt = rval.toString()
+	}
+	for {
+		fields, err = self.inputFields(prompt + "? ", nil)
+		if ( err != nil || self.mode == MODE_QUIT ) {
+			return &self.staticTrueValue, err
+		}
+		// Every value is converted before any are assigned, so that
+		// nothing changes when the input has to be entered again
+		values = nil
+		for item = expr.firstArgument(); item != nil; item = item.right {
+			if ( len(fields) == 0 ) {
+				// Commodore asks for the rest with ??
+				fields, err = self.inputFields("?? ", fields)
+				if ( err != nil || self.mode == MODE_QUIT ) {
+					return &self.staticTrueValue, err
+				}
+			}
+			err = self.inputLiteral(item.expr, fields[0], &assignValue)
+			if ( err != nil ) {
+				break
+			}
+			values = append(values, assignValue)
+			fields = fields[1:]
+		}
+		if ( err != nil ) {
+			self.Println("?REDO FROM START")
+			continue
+		}
+		if ( len(fields) > 0 ) {
+			self.Println("?EXTRA IGNORED")
+		}
+		for item = expr.firstArgument(); item != nil; item = item.right {
+			assignment.newBinary(item.expr, ASSIGNMENT, &values[0])
+			_, err = self.evaluate(&assignment)
+			if ( err != nil ) {
+				return nil, err
+			}
+			values = values[1:]
+		}
+		return &self.staticTrueValue, nil
+	}
+}
+
+// inputFields prints prompt and waits for a line of input, which is split
+// into fields at commas that aren't inside of quotes. The fields are
+// added to those already collected.
+func (self *BasicRuntime) inputFields(prompt string, fields []string) ([]string, error) {
+	var line string
+	var err error = nil
+
+	line, err = self.inputLine(prompt)
+	if ( err != nil || self.mode == MODE_QUIT ) {
+		return nil, err
+	}
+	return self.splitInputFields(line, fields), nil
+}
+
+// inputLine prints prompt and waits for a line of input. The prompt is
+// printed again when an empty line is entered. The line is empty if the
+// user closed the window or we ran out of input.
+func (self *BasicRuntime) inputLine(prompt string) (string, error) {
+	var line string
+	var err error = nil
+
+	self.userline = ""
+	for ( len(self.userline) == 0 ) {
+		self.Write(prompt)
+		self.frontend.drawPrintBuffer()
+		self.lineEntered = false
+		for ( !self.lineEntered ) {
+			err = self.frontend.processEvents()
+			if ( err != nil ) {
+				return "", err
+			}
+			if ( self.mode == MODE_QUIT ) {
+				return "", nil
+			}
+		}
+	}
+	line = self.userline
+	self.userline = ""
+	return line, nil
+}
+
+// splitInputFields adds the fields of line, which are separated by commas
+// that aren't inside of quotes, to fields
+func (self *BasicRuntime) splitInputFields(line string, fields []string) []string {
+	var inString bool = false
+	var start int = 0
+	var i int
+
+	for i = 0; i < len(line); i++ {
+		if ( line[i] == '"' ) {
+			inString = !inString
+		} else if ( line[i] == ',' && !inString ) {
+			fields = append(fields, line[start:i])
+			start = i + 1
+		}
+	}
+	return append(fields, line[start:])
+}
+
+// inputFromFile is INPUT#. Fields are read from as many lines of the file
+// as it takes to fill all of the variables.
+func (self *BasicRuntime) inputFromFile(expr *BasicASTLeaf) (*BasicValue, error) {
+	var err error = nil
+	var file *BasicFile = nil
+	var line string
+	var fields []string
+	var item *BasicASTLeaf = nil
+	var assignment BasicASTLeaf
+	var assignValue BasicASTLeaf
+
+	file, err = self.channelFile(expr.left)
+	if ( err != nil ) {
+		return nil, err
+	}
+	for item = expr.firstArgument(); item != nil; item = item.right {
+		if ( len(fields) == 0 ) {
+			line, self.ioStatus, err = file.readLine()
+			if ( err != nil ) {
+				return nil, err
+			}
+			if ( (self.ioStatus & IO_STATUS_READ_TIMEOUT) != 0 ) {
+				// There was nothing left to read
+				return &self.staticTrueValue, nil
+			}
+			fields = self.splitInputFields(line, fields)
+		}
+		err = self.inputLiteral(item.expr, fields[0], &assignValue)
+		if ( err != nil ) {
+			return nil, newBasicRuntimeError(FILE_DATA, "Unable to read %q from %s", fields[0], file.name)
+		}
+		fields = fields[1:]
+		assignment.newBinary(item.expr, ASSIGNMENT, &assignValue)
+		_, err = self.evaluate(&assignment)
+		if ( err != nil ) {
+			return nil, err
+		}
+	}
+	return &self.staticTrueValue, nil
+}
+
+// inputLiteral converts a field typed in response to INPUT into a literal
+// leaf that can be assigned to identifier
+func (self *BasicRuntime) inputLiteral(identifier *BasicASTLeaf, field string, literal *BasicASTLeaf) error {
+	var err error = nil
+
+	field = strings.TrimSpace(field)
+	switch (identifier.leaftype) {
+	case LEAF_IDENTIFIER_STRING:
+		if ( len(field) >= 2 && field[0] == '"' && field[len(field) - 1] == '"' ) {
+			field = field[1:len(field) - 1]
+		}
+		literal.newLiteralString(field)
+	case LEAF_IDENTIFIER_INT:
+		literal.init(LEAF_LITERAL_INT)
+		literal.literal_int, err = strconv.ParseInt(field, 10, 64)
+	case LEAF_IDENTIFIER_FLOAT:
+		literal.init(LEAF_LITERAL_FLOAT)
+		literal.literal_float, err = strconv.ParseFloat(field, 64)
+	default:
+		err = errors.New("Expected identifier")
+	}
+	return err
+}
+
+func (self *BasicRuntime) CommandGET(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	return self.getKeys(expr, false)
+}
+
+func (self *BasicRuntime) CommandGETKEY(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	return self.getKeys(expr, true)
+}
+
+// getKeys reads one key for each variable of GET or GETKEY, or one
+// character for each variable of GET#. String variables get the key, or
+// "" if none was pressed. Numeric variables get the value of a digit
+// key, or 0 for any other key.
+func (self *BasicRuntime) getKeys(expr *BasicASTLeaf, wait bool) (*BasicValue, error) {
+	var err error = nil
+	var key rune
+	var item *BasicASTLeaf = nil
+	var assignment BasicASTLeaf
+	var assignValue BasicASTLeaf
+
+	var file *BasicFile = nil
+
+	if ( expr.left != nil ) {
+		file, err = self.channelFile(expr.left)
+		if ( err != nil ) {
+			return nil, err
+		}
+	} else {
+		self.frontend.drawPrintBuffer()
+	}
+	for item = expr.firstArgument(); item != nil; item = item.right {
+		if ( file != nil ) {
+			key, self.ioStatus, err = file.readCharacter()
+		} else {
+			key, err = self.frontend.getKey(wait)
+		}
+		if ( err != nil ) {
+			return nil, err
+		}
+		if ( self.mode == MODE_QUIT ) {
+			return &self.staticTrueValue, nil
+		}
+		if ( item.expr.leaftype == LEAF_IDENTIFIER_STRING ) {
+			if ( key == 0 ) {
+				assignValue.newLiteralString("")
+			} else {
+				assignValue.newLiteralString(characterString(key))
+			}
+		} else {
+			assignValue.init(LEAF_LITERAL_INT)
+			if ( unicode.IsDigit(key) ) {
+				assignValue.literal_int = int64(key - '0')
+			}
+		}
+		assignment.newBinary(item.expr, ASSIGNMENT, &assignValue)
+		_, err = self.evaluate(&assignment)
+		if ( err != nil ) {
+			return nil, err
+		}
+	}
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandDOPEN(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var err error = nil
+	var channel int64
+	var mode byte = 'R'
+	var file *BasicFile = nil
+	var option *BasicASTLeaf = nil
+	var recordLength int64 = 0
+	var path string
+	var exists bool
+
+	channel, err = self.evaluateChannel(expr.expr)
+	if ( err != nil ) {
+		return nil, err
+	}
+	_, exists = self.files[channel]
+	if ( exists ) {
+		return nil, newBasicRuntimeError(FILE_OPEN, "Channel %d is already open", channel)
+	}
+	rval, err = self.evaluate(expr.firstArgument())
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( rval.valuetype != TYPE_STRING ) {
+		return nil, newBasicRuntimeError(MISSING_FILE_NAME, "Expected DOPEN #(channel), (name)")
+	}
+	for option = expr.firstArgument().right; option != nil; option = option.right {
+		switch ( option.literal_string ) {
+		case "R": mode = 'R'
+		case "W": mode = 'W'
+		case "A": mode = 'A'
+		default:
+			// Ln opens a relative file of n byte records
+			if ( !strings.HasPrefix(option.literal_string, "L") ) {
+				return nil, newBasicRuntimeError(SYNTAX, "Unknown DOPEN option %s", option.literal_string)
+			}
+			recordLength, err = strconv.ParseInt(option.literal_string[1:], 10, 64)
+			if ( err != nil ) {
+				return nil, newBasicRuntimeError(SYNTAX, "Expected a record length in DOPEN option %s", option.literal_string)
+			}
+			mode = 'L'
+		}
+	}
+	path, err = self.drive.resolve(rval.stringval)
+	if ( err != nil ) {
+		return nil, err
+	}
+	file = new(BasicFile)
+	if ( mode == 'L' ) {
+		err = file.openRelative(path, recordLength)
+	} else {
+		err = file.open(path, mode)
+	}
+	if ( err != nil ) {
+		return nil, err
+	}
+	self.files[channel] = file
+	self.ioStatus = 0
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandRECORD(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// RECORD #CHANNEL, RECORD NUMBER[, BYTE]
+	var err error = nil
+	var file *BasicFile = nil
+	var arguments = []int64{1, 1}
+	var argument *BasicASTLeaf = nil
+	var i int
+
+	file, err = self.channelFile(expr.expr)
+	if ( err != nil ) {
+		return nil, err
+	}
+	argument = expr.firstArgument()
+	for i = 0; argument != nil; i++ {
+		if ( i >= len(arguments) ) {
+			return nil, errors.New("RECORD expected at most 2 arguments")
+		}
+		rval, err = self.evaluate(argument)
+		if ( err != nil ) {
+			return nil, err
+		}
+		if ( rval.valuetype != TYPE_INTEGER ) {
+			return nil, newBasicRuntimeError(TYPE_MISMATCH, "RECORD expected integers")
+		}
+		arguments[i] = rval.intval
+		argument = argument.right
+	}
+	err = file.seek(arguments[0], arguments[1])
+	if ( err != nil ) {
+		return nil, err
+	}
+	self.ioStatus = 0
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandDCLOSE(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var err error = nil
+	var channel int64
+	var file *BasicFile = nil
+
+	if ( expr.expr == nil ) {
+		return &self.staticTrueValue, self.closeFiles()
+	}
+	channel, err = self.evaluateChannel(expr.expr)
+	if ( err != nil ) {
+		return nil, err
+	}
+	file, err = self.channelFile(expr.expr)
+	if ( err != nil ) {
+		return nil, err
+	}
+	delete(self.files, channel)
+	err = file.close()
+	if ( err != nil ) {
+		return nil, err
+	}
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) evaluateChannel(expr *BasicASTLeaf) (int64, error) {
+	var err error = nil
+	var rval *BasicValue = nil
+
+	rval, err = self.evaluate(expr)
+	if ( err != nil ) {
+		return 0, err
+	}
+	if ( rval.valuetype != TYPE_INTEGER ) {
+		return 0, newBasicRuntimeError(TYPE_MISMATCH, "Expected an integer channel number")
+	}
+	return rval.intval, nil
+}
+
+// channelFile returns the file open on the channel expr evaluates to
+func (self *BasicRuntime) channelFile(expr *BasicASTLeaf) (*BasicFile, error) {
+	var err error = nil
+	var channel int64
+	var file *BasicFile = nil
+	var exists bool
+
+	channel, err = self.evaluateChannel(expr)
+	if ( err != nil ) {
+		return nil, err
+	}
+	file, exists = self.files[channel]
+	if ( !exists ) {
+		return nil, newBasicRuntimeError(FILE_NOT_OPEN, "Channel %d is not open", channel)
+	}
+	return file, nil
+}
+
+// closeFiles closes every open file, writing out anything still buffered
+func (self *BasicRuntime) closeFiles() error {
+	var err error = nil
+	var closeErr error = nil
+
+	for channel, file := range(self.files) {
+		closeErr = file.close()
+		if ( err == nil ) {
+			err = closeErr
+		}
+		delete(self.files, channel)
+	}
+	return err
+}
+
+func (self *BasicRuntime) CommandAUTO(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var err error = nil
+	if ( expr.right == nil ) {
+		//fmt.Println("Turned AUTO off")
+		self.autoLineNumber = 0
+	} else {
+		rval, err = self.evaluate(expr.right)
+		if ( err != nil ) {
+			return nil, err
+		}
+		if ( rval.valuetype != TYPE_INTEGER ) {
+			return nil, errors.New("Expected integer")
+		}
+		self.autoLineNumber = rval.intval
+		//fmt.Printf("Turned AUTO on: %d\n", self.autoLineNumber)
+	}
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandQUIT(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	self.setMode(MODE_QUIT)
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandLET(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// LET is not expressly required in our basic implementation or in
+	// Commodore 128 BASIC 7.0. Assignments to variables are handled as
+	// part of expression evaluation, LET doesn't need to manage it.
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandIF(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var err error = nil
+	var actionclause *BasicASTLeaf = nil
+	if ( expr.right == nil ) {
+		return nil, errors.New("Expected IF ... THEN")
+	}
+	rval, err = self.evaluate(expr.right)
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( rval.boolvalue == BASIC_TRUE ) {
+		for ( expr.right != nil ) {
+			expr = expr.right
+			if ( expr.leaftype == LEAF_COMMAND && strings.Compare(expr.identifier, "THEN") == 0 ) {
+				actionclause = expr.right
+			}
+		}
+		if ( expr == nil || expr.right == nil ) {
+			return nil, errors.New("Malformed IF statement")
+		}
+		return self.evaluate(actionclause)
+	}
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandELSE(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	if ( self.environment.ifTakeElse == false ) {
+		// The IF was true, the rest of this line belongs to the ELSE
+		self.environment.nextline = self.environment.lineno + 1
+		self.environment.nextstatement = 0
+		return &self.staticTrueValue, nil
+	}
+	self.environment.ifTakeElse = false
+	if ( expr.right == nil ) {
+		return nil, errors.New("Expected IF ... THEN ... ELSE ...")
+	}
+	return self.evaluate(expr.right)
+}
+
+func (self *BasicRuntime) evaluateForCondition(rval *BasicValue) (bool, error) {
+	var truth *BasicValue = nil
+	var err error = nil
+	if ( rval == nil ) {
+		return false, errors.New("NIL pointer for rval")
+	}
+	truth, err = self.environment.forStepValue.lessThan(&BasicValue{valuetype: TYPE_INTEGER, intval: 0})
+	if ( err != nil ) {
+		return false, err
+	}
+	if ( truth.isTrue() ) {
+		// Our step is negative
+		truth, err = self.environment.forToValue.greaterThanEqual(rval)
+	} else {
+		// Our step is positive
+		truth, err = self.environment.forToValue.lessThanEqual(rval)
+	}
+	if ( err != nil ) {
+		return false, err
+	}
+
+	//fmt.Printf("%s ? %s : %s\n",
+	//rval.toString(),
+	//self.environment.forToValue.toString(),
+	//truth.toString())
+
+	return truth.isTrue(), nil
+}
+
+func (self *BasicRuntime) CommandREAD(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var assignment BasicASTLeaf
+	var err error = nil
+
+	for expr = expr.firstArgument(); expr != nil; expr = expr.right {
+		if ( self.dataIdx >= len(self.data) ) {
+			return nil, newBasicRuntimeError(OUT_OF_DATA, "No more DATA to READ")
+		}
+		assignment.newBinary(expr, ASSIGNMENT, self.data[self.dataIdx].leaf)
+		_, err = self.evaluate(&assignment)
+		if ( err != nil ) {
+			return nil, err
+		}
+		self.dataIdx += 1
+	}
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandRESTORE(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var err error = nil
+	self.dataIdx = 0
+	if ( expr.right == nil ) {
+		return &self.staticTrueValue, nil
+	}
+	rval, err = self.evaluate(expr.right)
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( rval.valuetype != TYPE_INTEGER ) {
+		return nil, errors.New("Expected integer")
+	}
+	if ( self.source.get(rval.intval) == "" ) {
+		return nil, newBasicRuntimeError(UNDEFD_STATEMENT, "Line %d does not exist", rval.intval)
+	}
+	// The next READ uses the first DATA on or after that line
+	for ( self.dataIdx < len(self.data) && self.data[self.dataIdx].lineno < rval.intval ) {
+		self.dataIdx += 1
+	}
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandSTOP(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	self.setMode(MODE_REPL)
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandDATA(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// DATA was collected by scanData() when the program started,
+	// there's nothing to do when we run into it.
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandFOR(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// At this point the assignment has already been evaluated. We need to
+	// evaluate the STEP expression if there is one, and the TO
+	// leaf, and then return nil, nil.
+	var err error = nil
+	var assignval *BasicValue = nil
+	var tmpvar *BasicValue = nil
+	var forConditionMet bool = false
+		
+	if ( self.environment.forToLeaf == nil || expr.right == nil ) {
+		return nil, errors.New("Expected FOR ... TO [STEP ...]")
+	}
+	if ( expr.right.left == nil || (
+		expr.right.left.leaftype != LEAF_IDENTIFIER_INT &&
+			expr.right.left.leaftype != LEAF_IDENTIFIER_FLOAT &&
+			expr.right.left.leaftype != LEAF_IDENTIFIER_STRING) ) {
+		return nil, errors.New("Expected variable in FOR loop")
+	}
+	assignval, err = self.evaluate(expr.right)
+	if ( err != nil ) {
+		return nil, err
+	}
+	self.environment.forNextVariable = self.environment.get(expr.right.left.identifier)
+	self.environment.forNextVariable.set(assignval, 0)
+
+
+	tmpvar, err = self.evaluate(self.environment.forToLeaf)
+	if ( err != nil ) {
+		return nil, err
+	}
+	_, _ = tmpvar.clone(&self.environment.forToValue)
+	tmpvar, err = self.evaluate(self.environment.forStepLeaf)
+	if ( err != nil ) {
+		return nil, err
+	}
+	_, _ = tmpvar.clone(&self.environment.forStepValue)
+	self.environment.forToLeaf = nil
+	self.environment.forStepLeaf = nil
+	tmpvar, err = self.environment.forNextVariable.getSubscript(0)
+	if (err != nil ) {
+		return nil, err
+	}
+	forConditionMet, err = self.evaluateForCondition(tmpvar)
+	if ( forConditionMet == true ) {
+		self.environment.waitForCommand("NEXT")
+	}
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandNEXT(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var forConditionMet = false
+	var err error = nil
+	var nextvar *BasicVariable
+
+	// if self.environment.forRelationLeaf is nil, parse error
+	if ( self.environment.forNextVariable == nil ) {
+		return nil, newBasicRuntimeError(NEXT_WITHOUT_FOR, "NEXT outside the context of FOR")
+	}
+
+	if ( expr.right == nil ) {
+		return nil, errors.New("Expected NEXT IDENTIFIER")
+	}
+	if ( expr.right.leaftype != LEAF_IDENTIFIER_INT &&
+		expr.right.leaftype != LEAF_IDENTIFIER_FLOAT ) {
+		return nil, errors.New("FOR ... NEXT only valid over INT and FLOAT types")
+	}
+	self.environment.loopExitLine = self.environment.nextline
+	self.environment.loopExitStatement = self.environment.nextstatement
+
+	//fmt.Println("Found NEXT %s, I'm waiting for NEXT %s\n", self.environment.forNextVariable.name, expr.right.identifier)
+	if ( strings.Compare(expr.right.identifier, self.environment.forNextVariable.name) != 0 ) {
+		self.environment.parent.nextline = self.environment.nextline
+		self.environment.parent.nextstatement = self.environment.nextstatement
+		self.prevEnvironment()
+		return &self.staticFalseValue, nil
+	}
+	nextvar = self.environment.get(expr.right.identifier)
+	rval, err = nextvar.getSubscript(0)
+	if ( err != nil ) {
+		return nil, err
+	}
+	forConditionMet, err = self.evaluateForCondition(rval)
+	self.environment.stopWaiting("NEXT")
+	if ( forConditionMet == true || self.environment.loopExiting == true ) {
+		//fmt.Println("Exiting loop")
+		if ( self.environment.parent != nil ) {
+			self.environment.parent.nextline = self.environment.nextline
+			self.environment.parent.nextstatement = self.environment.nextstatement
+			self.prevEnvironment()
+		}
+		return &self.staticTrueValue, nil
+	}
+	//fmt.Printf("Incrementing %s (%s) by %s\n", rval.name, rval.toString(), self.environment.forStepValue.toString())
+	rval, err = rval.mathPlus(&self.environment.forStepValue)
+	if ( err != nil ) {
+		return nil, err
+	}
+	//fmt.Println("Continuing loop")
+	self.environment.nextline = self.environment.loopFirstLine
+	self.environment.nextstatement = self.environment.loopFirstStatement
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandEXIT(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+
+	if ( len(self.environment.loopEndCommand) == 0 ) {
+		return nil, errors.New("EXIT outside the context of FOR or DO")
+	}
+	// Skip everything up to the end of the loop, which will then
+	// exit instead of going around again
+	self.environment.loopExiting = true
+	self.environment.waitForCommand(self.environment.loopEndCommand)
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandDO(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var loopContinues bool = true
+	var err error = nil
+
+	// LOOP sends us back here to check the condition again, in which
+	// case we are already in the environment for this loop.
+	if ( strings.Compare(self.environment.loopEndCommand, "LOOP") != 0 ||
+		self.environment.loopFirstLine != self.environment.lineno ||
+		self.environment.loopFirstStatement != self.environment.statement ) {
+		self.newEnvironment()
+		self.environment.loopEndCommand = "LOOP"
+		self.environment.loopFirstLine = self.environment.lineno
+		self.environment.loopFirstStatement = self.environment.statement
+	}
+	loopContinues, err = self.evaluateLoopCondition(expr.right)
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( loopContinues == false ) {
+		self.environment.loopExiting = true
+		self.environment.waitForCommand("LOOP")
+	}
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandLOOP(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var loopenv *BasicEnvironment = nil
+	var loopContinues bool = true
+	var err error = nil
+
+	loopenv = self.environment.waitingEnvironment("LOOP")
+	if ( loopenv != nil ) {
+		if ( loopenv.doNesting > 0 ) {
+			// This is the LOOP for a nested DO that we skipped
+			loopenv.doNesting -= 1
+			return &self.staticTrueValue, nil
+		}
+		loopenv.stopWaiting("LOOP")
+		// Discard any environments that were created while skipping
+		// to get here
+		loopenv.nextline = self.environment.nextline
+		loopenv.nextstatement = self.environment.nextstatement
+		self.environment = loopenv
+	} else if ( strings.Compare(self.environment.loopEndCommand, "LOOP") != 0 ) {
+		return nil, newBasicRuntimeError(LOOP_WITHOUT_DO, "LOOP outside the context of DO")
+	} else {
+		loopContinues, err = self.evaluateLoopCondition(expr.right)
+		if ( err != nil ) {
+			return nil, err
+		}
+	}
+	if ( loopContinues == true && self.environment.loopExiting == false ) {
+		// Go back to the DO and check its condition again
+		self.environment.nextline = self.environment.loopFirstLine
+		self.environment.nextstatement = self.environment.loopFirstStatement
+		return &self.staticTrueValue, nil
+	}
+	self.environment.parent.nextline = self.environment.nextline
+	self.environment.parent.nextstatement = self.environment.nextstatement
+	self.prevEnvironment()
+	return &self.staticTrueValue, nil
+}
+
+// evaluateLoopCondition evaluates the WHILE or UNTIL clause on a DO or
+// LOOP statement and returns true if the loop should go around again.
+func (self *BasicRuntime) evaluateLoopCondition(condition *BasicASTLeaf) (bool, error) {
+	var truth *BasicValue = nil
+	var err error = nil
+
+	if ( condition == nil ) {
+		return true, nil
+	}
+	if ( condition.right == nil ) {
+		return false, fmt.Errorf("Expected %s (expression)", condition.identifier)
+	}
+	truth, err = self.evaluate(condition.right)
+	if ( err != nil ) {
+		return false, err
+	}
+	if ( strings.Compare(condition.identifier, "UNTIL") == 0 ) {
+		return !truth.isTrue(), nil
+	}
+	return truth.isTrue(), nil
+}
+
+
+// graphicArguments evaluates the numeric arguments of a graphics command.
+// Arguments which were left out are given the matching default, and
+// reported as not given so that required ones can be checked.
+func (self *BasicRuntime) graphicArguments(expr *BasicASTLeaf, name string, defaults ...float64) ([]float64, []bool, error) {
+	return self.graphicArgumentList(expr.firstArgument(), name, defaults...)
+}
+
+// graphicArgumentList is graphicArguments for the arguments from argument
+// onwards, for commands whose first argument isn't a number
+func (self *BasicRuntime) graphicArgumentList(argument *BasicASTLeaf, name string, defaults ...float64) ([]float64, []bool, error) {
+	var err error = nil
+	var rval *BasicValue = nil
+	var values []float64 = slices.Clone(defaults)
+	var given []bool = make([]bool, len(defaults))
+	var i int
+
+	for i = 0; argument != nil; i++ {
+		if ( i >= len(values) ) {
+			return nil, nil, fmt.Errorf("%s expected at most %d arguments", name, len(values))
+		}
+		if ( argument.leaftype != LEAF_UNDEFINED ) {
+			rval, err = self.evaluate(argument)
+			if ( err != nil ) {
+				return nil, nil, err
+			}
+			switch ( rval.valuetype ) {
+			case TYPE_INTEGER: values[i] = float64(rval.intval)
+			case TYPE_FLOAT: values[i] = rval.floatval
+			default:
+				return nil, nil, newBasicRuntimeError(TYPE_MISMATCH, "%s expected numbers", name)
+			}
+			given[i] = true
+		}
+		argument = argument.right
+	}
+	return values, given, nil
+}
+
+// colorSource checks the colour source argument of a graphics command
+func (self *BasicRuntime) colorSource(value float64) (byte, error) {
+	if ( value < COLOR_SOURCE_BACKGROUND || value > COLOR_SOURCE_MULTICOLOR_2 ) {
+		return 0, newBasicRuntimeError(ILLEGAL_QUANTITY, "Colour source must be between %d and %d", COLOR_SOURCE_BACKGROUND, COLOR_SOURCE_MULTICOLOR_2)
+	}
+	return byte(value), nil
+}
+
+// graphicsArea returns an error if there is no bitmap to draw on
+func (self *BasicRuntime) graphicsArea() error {
+	if ( !self.bitmap.allocated ) {
+		return newBasicRuntimeError(NO_GRAPHICS_AREA, "Use GRAPHIC to select a bitmap mode before drawing")
+	}
+	return nil
+}
+
+func (self *BasicRuntime) CommandGRAPHIC(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// GRAPHIC MODE[, CLEAR][, SPLIT LINE]
+	// GRAPHIC CLR
+	var err error = nil
+	var args []float64
+	var given []bool
+
+	if ( expr.expr != nil ) {
+		self.bitmap.free()
+		return &self.staticTrueValue, nil
+	}
+	args, given, err = self.graphicArguments(expr, "GRAPHIC", GRAPHIC_TEXT, 0, DEFAULT_SPLIT_LINE)
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( !given[0] ) {
+		return nil, errors.New("Expected GRAPHIC (mode)[, (clear)][, (split line)]")
+	}
+	if ( args[0] < GRAPHIC_TEXT || args[0] > GRAPHIC_TEXT_80 ) {
+		return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "GRAPHIC mode must be between %d and %d", GRAPHIC_TEXT, GRAPHIC_TEXT_80)
+	}
+	if ( args[2] < 0 || args[2] > TEXT_LINES ) {
+		return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "GRAPHIC split line must be between 0 and %d", TEXT_LINES)
+	}
+	self.bitmap.mode = int64(args[0])
+	self.bitmap.splitLine = int64(args[2])
+	if ( self.bitmap.mode == GRAPHIC_TEXT_80 && self.screen.columns != SCREEN_COLUMNS_80 ) {
+		self.screen.setColumns(SCREEN_COLUMNS_80)
+	} else if ( self.bitmap.mode != GRAPHIC_TEXT_80 && self.screen.columns != SCREEN_COLUMNS ) {
+		self.screen.setColumns(SCREEN_COLUMNS)
+	}
+	if ( self.bitmap.visible() ) {
+		self.bitmap.allocate()
+	}
+	if ( args[1] != 0 ) {
+		self.bitmap.clear()
+	}
+	self.bitmap.dirty = true
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandDRAW(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// DRAW [SOURCE][, X1, Y1][ TO X2, Y2 ...]
+	var err error = nil
+	var args []float64
+	var defaults = []float64{COLOR_SOURCE_FOREGROUND, self.bitmap.cursorX, self.bitmap.cursorY}
+	var argument *BasicASTLeaf = nil
+	var source byte
+	var x1 int
+	var y1 int
+	var x2 int
+	var y2 int
+	var count int = 0
+	var i int
+
+	err = self.graphicsArea()
+	if ( err != nil ) {
+		return nil, err
+	}
+	// Every point after the first is one which was drawn to with TO
+	for argument = expr.firstArgument(); argument != nil; argument = argument.right {
+		count += 1
+	}
+	for i = len(defaults); i < count; i++ {
+		defaults = append(defaults, 0)
+	}
+	args, _, err = self.graphicArguments(expr, "DRAW", defaults...)
+	if ( err != nil ) {
+		return nil, err
+	}
+	source, err = self.colorSource(args[0])
+	if ( err != nil ) {
+		return nil, err
+	}
+	x1, y1 = self.bitmap.toPixel(args[1], args[2])
+	self.bitmap.plot(x1, y1, source)
+	for i = 3; i + 1 < len(args); i += 2 {
+		x2, y2 = self.bitmap.toPixel(args[i], args[i + 1])
+		self.bitmap.line(x1, y1, x2, y2, source)
+		x1 = x2
+		y1 = y2
+	}
+	self.bitmap.cursorX = args[len(args) - 2]
+	self.bitmap.cursorY = args[len(args) - 1]
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandBOX(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// BOX [SOURCE], X1, Y1[, X2, Y2][, ANGLE][, PAINT]
+	var err error = nil
+	var args []float64
+	var given []bool
+	var source byte
+	var x1 int
+	var y1 int
+	var x2 int
+	var y2 int
+
+	err = self.graphicsArea()
+	if ( err != nil ) {
+		return nil, err
+	}
+	args, given, err = self.graphicArguments(expr, "BOX",
+		COLOR_SOURCE_FOREGROUND, 0, 0, self.bitmap.cursorX, self.bitmap.cursorY, 0, 0)
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( !given[1] || !given[2] ) {
+		return nil, errors.New("Expected BOX [source], (x1), (y1)[, (x2), (y2)][, (angle)][, (paint)]")
+	}
+	source, err = self.colorSource(args[0])
+	if ( err != nil ) {
+		return nil, err
+	}
+	x1, y1 = self.bitmap.toPixel(args[1], args[2])
+	x2, y2 = self.bitmap.toPixel(args[3], args[4])
+	self.bitmap.box(x1, y1, x2, y2, args[5], source, ( args[6] != 0 ))
+	self.bitmap.cursorX = args[3]
+	self.bitmap.cursorY = args[4]
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandCIRCLE(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// CIRCLE [SOURCE], X, Y, XRADIUS[, YRADIUS][, START][, END][, ANGLE][, INCREMENT]
+	var err error = nil
+	var args []float64
+	var given []bool
+	var source byte
+	var x int
+	var y int
+	var radiusX float64
+	var radiusY float64
+
+	err = self.graphicsArea()
+	if ( err != nil ) {
+		return nil, err
+	}
+	args, given, err = self.graphicArguments(expr, "CIRCLE",
+		COLOR_SOURCE_FOREGROUND, self.bitmap.cursorX, self.bitmap.cursorY, 0, 0, 0, 360, 0, DEFAULT_CIRCLE_INCREMENT)
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( !given[3] ) {
+		return nil, errors.New("Expected CIRCLE [source], (x), (y), (x radius)[, (y radius)][, (start)][, (end)][, (angle)][, (increment)]")
+	}
+	if ( !given[4] ) {
+		args[4] = args[3]
+	}
+	if ( args[8] <= 0 ) {
+		return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "CIRCLE increment must be greater than 0")
+	}
+	source, err = self.colorSource(args[0])
+	if ( err != nil ) {
+		return nil, err
+	}
+	x, y = self.bitmap.toPixel(args[1], args[2])
+	radiusX, radiusY = self.bitmap.toPixelDistance(args[3], args[4])
+	self.bitmap.circle(x, y, radiusX, radiusY, args[5], args[6], args[7], args[8], source)
+	self.bitmap.cursorX = args[1]
+	self.bitmap.cursorY = args[2]
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandPAINT(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// PAINT [SOURCE], X, Y[, MODE]
+	var err error = nil
+	var args []float64
+	var source byte
+	var x int
+	var y int
+
+	err = self.graphicsArea()
+	if ( err != nil ) {
+		return nil, err
+	}
+	args, _, err = self.graphicArguments(expr, "PAINT",
+		COLOR_SOURCE_FOREGROUND, self.bitmap.cursorX, self.bitmap.cursorY, PAINT_TO_SOURCE)
+	if ( err != nil ) {
+		return nil, err
+	}
+	source, err = self.colorSource(args[0])
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( args[3] != PAINT_TO_SOURCE && args[3] != PAINT_TO_NONBACKGROUND ) {
+		return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "PAINT mode must be %d or %d", PAINT_TO_SOURCE, PAINT_TO_NONBACKGROUND)
+	}
+	x, y = self.bitmap.toPixel(args[1], args[2])
+	self.bitmap.paint(x, y, source, int64(args[3]))
+	self.bitmap.cursorX = args[1]
+	self.bitmap.cursorY = args[2]
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandLOCATE(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// LOCATE X, Y
+	var err error = nil
+	var args []float64
+	var given []bool
+
+	args, given, err = self.graphicArguments(expr, "LOCATE", 0, 0)
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( !given[0] || !given[1] ) {
+		return nil, errors.New("Expected LOCATE (x), (y)")
+	}
+	self.bitmap.cursorX = args[0]
+	self.bitmap.cursorY = args[1]
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandSCALE(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// SCALE ON[, XMAX, YMAX]
+	var err error = nil
+	var args []float64
+	var given []bool
+
+	args, given, err = self.graphicArguments(expr, "SCALE", 0, DEFAULT_SCALE, DEFAULT_SCALE)
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( !given[0] ) {
+		return nil, errors.New("Expected SCALE (on)[, (x max), (y max)]")
+	}
+	if ( args[1] <= 0 || args[2] <= 0 ) {
+		return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "SCALE maximums must be greater than 0")
+	}
+	self.bitmap.scaling = ( args[0] != 0 )
+	self.bitmap.scaleX = args[1]
+	self.bitmap.scaleY = args[2]
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandSSHAPE(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// SSHAPE STRING VARIABLE, X1, Y1[, X2, Y2]
+	var err error = nil
+	var destination *BasicASTLeaf = expr.firstArgument()
+	var args []float64
+	var given []bool
+	var x1 int
+	var y1 int
+	var x2 int
+	var y2 int
+	var shape string
+	var onBitmap bool
+	var assignment BasicASTLeaf
 	var assignValue BasicASTLeaf
 
-	if ( expr == nil || expr.right == nil || expr.right.left == nil || expr.right.isIdentifier() == false ) {
-		return nil, errors.New("Expected INPUT \"PROMPT\" IDENTIFIER")
-	}
-	promptmsg, err = self.evaluate(expr.right.left)
+	err = self.graphicsArea()
 	if ( err != nil ) {
 		return nil, err
 	}
-	self.Write(promptmsg.stringval)
-	self.drawPrintBuffer()
-	// get the string from the user
-	for ( len(self.userline) == 0 ) {
-		self.sdlEvents()
+	if ( destination == nil || destination.leaftype != LEAF_IDENTIFIER_STRING ) {
+		return nil, errors.New("Expected SSHAPE (string variable), (x1), (y1)[, (x2), (y2)]")
 	}
-	
-	assignment, err = self.parser.newLeaf()
+	args, given, err = self.graphicArgumentList(destination.right, "SSHAPE",
+		0, 0, self.bitmap.cursorX, self.bitmap.cursorY)
 	if ( err != nil ) {
 		return nil, err
 	}
-	switch (expr.right.leaftype) {
-	case LEAF_IDENTIFIER_STRING:
-		assignValue.leaftype = LEAF_LITERAL_STRING
-		assignValue.literal_string = self.userline
-		assignValue.operator = LITERAL_STRING
-	case LEAF_IDENTIFIER_INT:
-		assignValue.leaftype = LEAF_LITERAL_INT
-		var i int
-		i, err = strconv.Atoi(self.userline)
-		if ( err != nil ) {
-			return nil, err
-		}
-		assignValue.literal_int = int64(i)
-		assignValue.operator = LITERAL_INT
-	case LEAF_IDENTIFIER_FLOAT:
-		assignValue.leaftype = LEAF_LITERAL_FLOAT
-		assignValue.literal_float, err = strconv.ParseFloat(self.userline, 64)
-		if ( err != nil ) {
-			return nil, err
-		}
-		assignValue.operator = LITERAL_FLOAT
+	if ( !given[0] || !given[1] ) {
+		return nil, errors.New("Expected SSHAPE (string variable), (x1), (y1)[, (x2), (y2)]")
+	}
+	x1, y1 = self.bitmap.toPixel(args[0], args[1])
+	x2, y2 = self.bitmap.toPixel(args[2], args[3])
+	shape, onBitmap = self.bitmap.shape(x1, y1, x2, y2)
+	if ( !onBitmap ) {
+		return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "SSHAPE area must be on the bitmap")
+	}
+	assignValue.newLiteralString(shape)
+	assignment.newBinary(destination, ASSIGNMENT, &assignValue)
+	_, err = self.evaluate(&assignment)
+	if ( err != nil ) {
+		return nil, err
 	}
-	assignment.newBinary(expr.right, ASSIGNMENT, &assignValue)
-	self.evaluate(assignment)
 	return &self.staticTrueValue, nil
 }
 
-func (self *BasicRuntime) CommandAUTO(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+func (self *BasicRuntime) CommandGSHAPE(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// GSHAPE STRING[, X, Y][, MODE]
 	var err error = nil
-	if ( expr.right == nil ) {
-		//fmt.Println("Turned AUTO off")
-		self.autoLineNumber = 0
-	} else {
-		rval, err = self.evaluate(expr.right)
-		if ( err != nil ) {
-			return nil, err
-		}
-		if ( rval.valuetype != TYPE_INTEGER ) {
-			return nil, errors.New("Expected integer")
-		}
-		self.autoLineNumber = rval.intval
-		//fmt.Printf("Turned AUTO on: %d\n", self.autoLineNumber)
+	var source *BasicASTLeaf = expr.firstArgument()
+	var args []float64
+	var x int
+	var y int
+
+	err = self.graphicsArea()
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( source == nil || source.leaftype == LEAF_UNDEFINED ) {
+		return nil, errors.New("Expected GSHAPE (string)[, (x), (y)][, (mode)]")
+	}
+	rval, err = self.evaluate(source)
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( rval.valuetype != TYPE_STRING ) {
+		return nil, newBasicRuntimeError(TYPE_MISMATCH, "GSHAPE expected a string")
+	}
+	args, _, err = self.graphicArgumentList(source.right, "GSHAPE",
+		self.bitmap.cursorX, self.bitmap.cursorY, GSHAPE_REPLACE)
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( args[2] < GSHAPE_REPLACE || args[2] > GSHAPE_XOR ) {
+		return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "GSHAPE mode must be between %d and %d", GSHAPE_REPLACE, GSHAPE_XOR)
+	}
+	x, y = self.bitmap.toPixel(args[0], args[1])
+	if ( !self.bitmap.stamp(rval.stringval, x, y, int64(args[2])) ) {
+		return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "GSHAPE expected a shape made by SSHAPE")
 	}
 	return &self.staticTrueValue, nil
 }
 
-func (self *BasicRuntime) CommandQUIT(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
-	self.setMode(MODE_QUIT)
-	return &self.staticTrueValue, nil
-}
+func (self *BasicRuntime) CommandCOLOR(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// COLOR SOURCE, COLOUR
+	var err error = nil
+	var args []float64
+	var given []bool
 
-func (self *BasicRuntime) CommandLET(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
-	// LET is not expressly required in our basic implementation or in
-	// Commodore 128 BASIC 7.0. Assignments to variables are handled as
-	// part of expression evaluation, LET doesn't need to manage it.
+	args, given, err = self.graphicArguments(expr, "COLOR", 0, 0)
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( !given[0] || !given[1] ) {
+		return nil, errors.New("Expected COLOR (source), (colour)")
+	}
+	if ( args[0] < 0 || args[0] >= COLOR_SOURCES ) {
+		return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "COLOR source must be between 0 and %d", COLOR_SOURCES - 1)
+	}
+	if ( args[1] < 1 || args[1] > COLORS ) {
+		return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "COLOR colour must be between 1 and %d", COLORS)
+	}
+	if ( args[0] == COLOR_SOURCE_CHARACTER ) {
+		// The same as printing the colour's control character
+		self.Write(string(colorCode(int64(args[1]))))
+		return &self.staticTrueValue, nil
+	}
+	self.colors[int(args[0])] = int64(args[1])
+	self.bitmap.dirty = true
 	return &self.staticTrueValue, nil
 }
 
-func (self *BasicRuntime) CommandIF(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+func (self *BasicRuntime) CommandSCNCLR(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// SCNCLR [MODE]
 	var err error = nil
-	var actionclause *BasicASTLeaf = nil
-	if ( expr.right == nil ) {
-		return nil, errors.New("Expected IF ... THEN")
-	}
-	rval, err = self.evaluate(expr.right)
+	var args []float64
+	var given []bool
+
+	args, given, err = self.graphicArguments(expr, "SCNCLR", 0)
 	if ( err != nil ) {
 		return nil, err
 	}
-	if ( rval.boolvalue == BASIC_TRUE ) {
-		for ( expr.right != nil ) {
-			expr = expr.right
-			if ( expr.leaftype == LEAF_COMMAND && strings.Compare(expr.identifier, "THEN") == 0 ) {
-				actionclause = expr.right
-			}
+	if ( !given[0] ) {
+		// Clear whatever is on the screen now
+		self.screen.clearWindow()
+		if ( self.bitmap.visible() ) {
+			self.bitmap.clear()
 		}
-		if ( expr == nil || expr.right == nil ) {
-			return nil, errors.New("Malformed IF statement")
-		}
-		return self.evaluate(actionclause)
+		return &self.staticTrueValue, nil
+	}
+	if ( args[0] < GRAPHIC_TEXT || args[0] > GRAPHIC_TEXT_80 ) {
+		return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "SCNCLR mode must be between %d and %d", GRAPHIC_TEXT, GRAPHIC_TEXT_80)
+	}
+	if ( args[0] == GRAPHIC_TEXT || args[0] == GRAPHIC_TEXT_80 ) {
+		self.screen.clearWindow()
+	} else if ( self.bitmap.allocated ) {
+		self.bitmap.clear()
 	}
 	return &self.staticTrueValue, nil
 }
 
-func (self *BasicRuntime) evaluateForCondition(rval *BasicValue) (bool, error) {
-	var truth *BasicValue = nil
+func (self *BasicRuntime) CommandCHAR(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// CHAR [SOURCE], X, Y[, STRING]
 	var err error = nil
-	if ( rval == nil ) {
-		return false, errors.New("NIL pointer for rval")
-	}
-	truth, err = self.environment.forStepValue.lessThan(&BasicValue{valuetype: TYPE_INTEGER, intval: 0})
+	var args []float64
+	var given []bool
+	var argument *BasicASTLeaf = nil
+	var textArgument *BasicASTLeaf = nil
+	var i int
+
+	// The string isn't a number, so graphicArguments only sees the
+	// arguments before it
+	argument = expr.firstArgument()
+	for i = 0; i < 2 && argument != nil; i++ {
+		argument = argument.right
+	}
+	if ( argument != nil && argument.right != nil ) {
+		textArgument = argument.right
+		argument.right = nil
+		defer func() {
+			argument.right = textArgument
+		}()
+	}
+	args, given, err = self.graphicArguments(expr, "CHAR", COLOR_SOURCE_FOREGROUND, 0, 0)
 	if ( err != nil ) {
-		return false, err
+		return nil, err
 	}
-	if ( truth.isTrue() ) {
-		// Our step is negative
-		truth, err = self.environment.forToValue.greaterThanEqual(rval)
-	} else {
-		// Our step is positive
-		truth, err = self.environment.forToValue.lessThanEqual(rval)
+	if ( !given[1] || !given[2] ) {
+		return nil, errors.New("Expected CHAR [(source)], (x), (y)[, (string)]")
+	}
+	if ( args[0] < 0 || args[0] >= COLOR_SOURCES ) {
+		return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "CHAR source must be between 0 and %d", COLOR_SOURCES - 1)
+	}
+	if ( args[1] < 0 || int(args[1]) >= self.screen.columns || args[2] < 0 || args[2] >= TEXT_LINES ) {
+		return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "CHAR position must be on the %d x %d screen", self.screen.columns, TEXT_LINES)
 	}
+	if ( textArgument == nil || textArgument.leaftype == LEAF_UNDEFINED ) {
+		return &self.staticTrueValue, nil
+	}
+	rval, err = self.evaluate(textArgument)
 	if ( err != nil ) {
-		return false, err
+		return nil, err
 	}
-
-	//fmt.Printf("%s ? %s : %s\n",
-	//rval.toString(),
-	//self.environment.forToValue.toString(),
-	//truth.toString())
-
-	return truth.isTrue(), nil
+	if ( rval.valuetype != TYPE_STRING ) {
+		return nil, newBasicRuntimeError(TYPE_MISMATCH, "CHAR expected a string")
+	}
+	self.screen.write(int(args[1]), int(args[2]), rval.stringval, self.colors[int(args[0])])
+	return &self.staticTrueValue, nil
 }
 
-func (self *BasicRuntime) CommandREAD(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
-	self.environment.waitForCommand("DATA")
-	self.environment.readIdentifierIdx = 0
+func (self *BasicRuntime) CommandWINDOW(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// WINDOW LEFT, TOP, RIGHT, BOTTOM[, CLEAR]
+	var err error = nil
+	var args []float64
+	var given []bool
+
+	args, given, err = self.graphicArguments(expr, "WINDOW", 0, 0, 0, 0, 0)
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( !given[0] || !given[1] || !given[2] || !given[3] ) {
+		return nil, errors.New("Expected WINDOW (left), (top), (right), (bottom)[, (clear)]")
+	}
+	if ( args[0] < 0 || args[2] < args[0] || int(args[2]) >= self.screen.columns ||
+		args[1] < 0 || args[3] < args[1] || args[3] >= TEXT_LINES ) {
+		return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "WINDOW must fit on the %d x %d screen", self.screen.columns, TEXT_LINES)
+	}
+	self.screen.setWindow(int(args[0]), int(args[1]), int(args[2]), int(args[3]))
+	if ( args[4] != 0 ) {
+		self.screen.clearWindow()
+	}
 	return &self.staticTrueValue, nil
 }
 
-func (self *BasicRuntime) CommandSTOP(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
-	self.setMode(MODE_REPL)
-	return &self.staticTrueValue, nil
+// spriteNumber checks the sprite number argument of a sprite command
+func (self *BasicRuntime) spriteNumber(value float64) (*BasicSprite, error) {
+	if ( value < 1 || value > SPRITES ) {
+		return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "Sprite number must be between 1 and %d", SPRITES)
+	}
+	return self.sprites.sprite(int64(value)), nil
 }
 
-func (self *BasicRuntime) CommandDATA(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
-	var curIdentifier *BasicASTLeaf = nil
-	var curAssignCommand BasicASTLeaf
-	var err error
-	if ( expr == nil || expr.right == nil ) {
-		return nil, errors.New("NIL expression or argument list")
+func (self *BasicRuntime) CommandSPRITE(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// SPRITE N[, ON][, COLOUR][, PRIORITY][, X EXPAND][, Y EXPAND][, MODE]
+	var err error = nil
+	var args []float64
+	var given []bool
+	var sprite *BasicSprite = nil
+
+	args, given, err = self.graphicArguments(expr, "SPRITE", 0, 0, 0, 0, 0, 0, 0)
+	if ( err != nil ) {
+		return nil, err
 	}
-	expr = expr.right.right
-	for ( expr != nil ) {
-		curIdentifier = self.environment.readIdentifierLeaves[self.environment.readIdentifierIdx]
-		if ( curIdentifier == nil ) {
-			break
-		}
-		curAssignCommand.newBinary(curIdentifier, ASSIGNMENT, expr)
-		_, err = self.evaluate(&curAssignCommand)
-		if ( err != nil ) {
-			return nil, err
-		}
-		self.environment.readIdentifierIdx += 1
-		expr = expr.right
+	if ( !given[0] ) {
+		return nil, errors.New("Expected SPRITE (sprite)[, (on)][, (colour)][, (priority)][, (x expand)][, (y expand)][, (mode)]")
 	}
-	if ( expr == nil &&
-		self.environment.readIdentifierIdx < MAX_LEAVES &&
-		self.environment.readIdentifierLeaves[self.environment.readIdentifierIdx] != nil ) {
-		// We ran out of DATA and still have READ items left to fulfill, leave us in waitingFor mode
-		return &self.staticTrueValue, nil
+	sprite, err = self.spriteNumber(args[0])
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( given[2] && ( args[2] < 1 || args[2] > COLORS ) ) {
+		return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "SPRITE colour must be between 1 and %d", COLORS)
 	}
-	// we fulfilled all our READ items, exit waitingFor mode
-	self.environment.stopWaiting("DATA")
-	self.environment.lineno = self.environment.readReturnLine
-	self.environment.readIdentifierIdx = 0
+	if ( given[1] ) {
+		sprite.enabled = ( args[1] != 0 )
+	}
+	if ( given[2] ) {
+		sprite.color = int64(args[2])
+	}
+	if ( given[3] ) {
+		sprite.behind = ( args[3] != 0 )
+	}
+	if ( given[4] ) {
+		sprite.expandX = ( args[4] != 0 )
+	}
+	if ( given[5] ) {
+		sprite.expandY = ( args[5] != 0 )
+	}
+	if ( given[6] ) {
+		sprite.multicolor = ( args[6] != 0 )
+	}
+	self.sprites.changed = true
+	self.sprites.dirty = true
 	return &self.staticTrueValue, nil
 }
 
-func (self *BasicRuntime) CommandFOR(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
-	// At this point the assignment has already been evaluated. We need to
-	// evaluate the STEP expression if there is one, and the TO
-	// leaf, and then return nil, nil.
+func (self *BasicRuntime) CommandMOVSPR(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// MOVSPR N, X, Y
+	// MOVSPR N, +X|-X, +Y|-Y
+	// MOVSPR N, DISTANCE ; ANGLE
+	// MOVSPR N, ANGLE # SPEED
 	var err error = nil
-	var assignval *BasicValue = nil
-	var tmpvar *BasicValue = nil
-	var forConditionMet bool = false
-		
-	if ( self.environment.forToLeaf == nil || expr.right == nil ) {
-		return nil, errors.New("Expected FOR ... TO [STEP ...]")
+	var args []float64
+	var sprite *BasicSprite = nil
+	var x float64
+	var y float64
+
+	if ( expr.expr == nil ) {
+		return nil, errors.New("Expected MOVSPR (sprite), (x), (y)")
 	}
-	if ( expr.right.left == nil || (
-		expr.right.left.leaftype != LEAF_IDENTIFIER_INT &&
-			expr.right.left.leaftype != LEAF_IDENTIFIER_FLOAT &&
-			expr.right.left.leaftype != LEAF_IDENTIFIER_STRING) ) {
-		return nil, errors.New("Expected variable in FOR loop")
+	args, _, err = self.graphicArguments(expr, "MOVSPR", 0, 0, 0)
+	if ( err != nil ) {
+		return nil, err
 	}
-	assignval, err = self.evaluate(expr.right)
+	sprite, err = self.spriteNumber(args[0])
 	if ( err != nil ) {
 		return nil, err
 	}
-	self.environment.forNextVariable = self.environment.get(expr.right.left.identifier)
-	self.environment.forNextVariable.set(assignval, 0)
+	switch ( expr.expr.literal_string ) {
+	case MOVSPR_POLAR:
+		self.sprites.moveBy(sprite, args[1], args[2])
+	case MOVSPR_VELOCITY:
+		if ( args[2] < 0 || args[2] > SPRITE_MAX_SPEED ) {
+			return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "MOVSPR speed must be between 0 and %d", SPRITE_MAX_SPEED)
+		}
+		sprite.angle = args[1]
+		sprite.speed = args[2]
+	default:
+		x = args[1]
+		y = args[2]
+		if ( expr.expr.literal_string == MOVSPR_RELATIVE || expr.expr.literal_string == MOVSPR_RELATIVE_X ) {
+			x += sprite.x
+		} else if ( x < 0 || x >= SPRITE_MAX_X ) {
+			return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "MOVSPR x must be between 0 and %d", SPRITE_MAX_X - 1)
+		}
+		if ( expr.expr.literal_string == MOVSPR_RELATIVE || expr.expr.literal_string == MOVSPR_RELATIVE_Y ) {
+			y += sprite.y
+		} else if ( y < 0 || y >= SPRITE_MAX_Y ) {
+			return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "MOVSPR y must be between 0 and %d", SPRITE_MAX_Y - 1)
+		}
+		self.sprites.move(sprite, x, y)
+	}
+	return &self.staticTrueValue, nil
+}
 
+func (self *BasicRuntime) CommandSPRCOLOR(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// SPRCOLOR [MULTICOLOUR 1][, MULTICOLOUR 2]
+	var err error = nil
+	var args []float64
+	var i int
 
-	tmpvar, err = self.evaluate(self.environment.forToLeaf)
+	args, _, err = self.graphicArguments(expr, "SPRCOLOR", float64(self.sprites.multicolor1), float64(self.sprites.multicolor2))
 	if ( err != nil ) {
 		return nil, err
 	}
-	_, _ = tmpvar.clone(&self.environment.forToValue)
-	tmpvar, err = self.evaluate(self.environment.forStepLeaf)
+	for i = 0; i < len(args); i++ {
+		if ( args[i] < 1 || args[i] > COLORS ) {
+			return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "SPRCOLOR colour must be between 1 and %d", COLORS)
+		}
+	}
+	self.sprites.multicolor1 = int64(args[0])
+	self.sprites.multicolor2 = int64(args[1])
+	self.sprites.dirty = true
+	return &self.staticTrueValue, nil
+}
+
+func (self *BasicRuntime) CommandSPRDEF(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// SPRDEF N
+	var err error = nil
+	var args []float64
+	var given []bool
+	var sprite *BasicSprite = nil
+	var line string
+	var row int
+	var column int
+
+	args, given, err = self.graphicArguments(expr, "SPRDEF", 0)
 	if ( err != nil ) {
 		return nil, err
 	}
-	_, _ = tmpvar.clone(&self.environment.forStepValue)
-	self.environment.forToLeaf = nil
-	self.environment.forStepLeaf = nil
-	tmpvar, err = self.environment.forNextVariable.getSubscript(0)
-	if (err != nil ) {
+	if ( !given[0] ) {
+		return nil, errors.New("Expected SPRDEF (sprite)")
+	}
+	sprite, err = self.spriteNumber(args[0])
+	if ( err != nil ) {
 		return nil, err
 	}
-	forConditionMet, err = self.evaluateForCondition(tmpvar)
-	if ( forConditionMet == true ) {
-		self.environment.waitForCommand("NEXT")
+	// Each row is typed as a line of up to 24 characters, where a space or
+	// a . is a pixel which is off. An empty line leaves the rest as they are.
+	for row = 0; row < SPRITE_HEIGHT; row++ {
+		line, err = self.inputLine(fmt.Sprintf("ROW %d? ", row + 1))
+		if ( err != nil ) {
+			return nil, err
+		}
+		if ( len(line) == 0 ) {
+			break
+		}
+		sprite.data[(row * 3)] = 0
+		sprite.data[(row * 3) + 1] = 0
+		sprite.data[(row * 3) + 2] = 0
+		for column = 0; column < min(len(line), SPRITE_WIDTH); column++ {
+			if ( line[column] != ' ' && line[column] != '.' ) {
+				sprite.data[(row * 3) + (column / 8)] |= 0x80 >> (column % 8)
+			}
+		}
 	}
+	self.sprites.changed = true
+	self.sprites.dirty = true
 	return &self.staticTrueValue, nil
 }
 
-func (self *BasicRuntime) CommandNEXT(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
-	var forConditionMet = false
+func (self *BasicRuntime) CommandSPRSAV(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// SPRSAV N|STRING, N|STRING VARIABLE
 	var err error = nil
-	var nextvar *BasicVariable
-
-	// if self.environment.forRelationLeaf is nil, parse error
-	if ( self.environment.forNextVariable == nil ) {
-		return nil, errors.New("NEXT outside the context of FOR")
-	}
+	var source *BasicASTLeaf = expr.firstArgument()
+	var destination *BasicASTLeaf = nil
+	var sprite *BasicSprite = nil
+	var shape string
+	var assignment BasicASTLeaf
+	var assignValue BasicASTLeaf
 
-	if ( expr.right == nil ) {
-		return nil, errors.New("Expected NEXT IDENTIFIER")
+	if ( source == nil || source.leaftype == LEAF_UNDEFINED ||
+		source.right == nil || source.right.leaftype == LEAF_UNDEFINED ) {
+		return nil, errors.New("Expected SPRSAV (source), (destination)")
 	}
-	if ( expr.right.leaftype != LEAF_IDENTIFIER_INT &&
-		expr.right.leaftype != LEAF_IDENTIFIER_FLOAT ) {
-		return nil, errors.New("FOR ... NEXT only valid over INT and FLOAT types")
+	destination = source.right
+	rval, err = self.evaluate(source)
+	if ( err != nil ) {
+		return nil, err
 	}
-	self.environment.loopExitLine = self.environment.lineno + 1
-
-	//fmt.Println("Found NEXT %s, I'm waiting for NEXT %s\n", self.environment.forNextVariable.name, expr.right.identifier)
-	if ( strings.Compare(expr.right.identifier, self.environment.forNextVariable.name) != 0 ) {
-		self.environment.parent.nextline = self.environment.nextline
-		self.prevEnvironment()
-		return &self.staticFalseValue, nil
+	switch ( rval.valuetype ) {
+	case TYPE_STRING:
+		shape = rval.stringval
+	case TYPE_INTEGER:
+		sprite, err = self.spriteNumber(float64(rval.intval))
+	case TYPE_FLOAT:
+		sprite, err = self.spriteNumber(rval.floatval)
+	default:
+		return nil, newBasicRuntimeError(TYPE_MISMATCH, "SPRSAV expected a sprite number or a string")
 	}
-	nextvar = self.environment.get(expr.right.identifier)
-	rval, err = nextvar.getSubscript(0)
 	if ( err != nil ) {
 		return nil, err
 	}
-	forConditionMet, err = self.evaluateForCondition(rval)
-	self.environment.stopWaiting("NEXT")
-	if ( forConditionMet == true ) {
-		//fmt.Println("Exiting loop")
-		if ( self.environment.parent != nil ) {
-			self.environment.parent.nextline = self.environment.nextline
-			self.prevEnvironment()
+	if ( sprite != nil ) {
+		shape = self.sprites.shape(sprite)
+	}
+	if ( destination.leaftype == LEAF_IDENTIFIER_STRING ) {
+		assignValue.newLiteralString(shape)
+		assignment.newBinary(destination, ASSIGNMENT, &assignValue)
+		_, err = self.evaluate(&assignment)
+		if ( err != nil ) {
+			return nil, err
 		}
 		return &self.staticTrueValue, nil
 	}
-	//fmt.Printf("Incrementing %s (%s) by %s\n", rval.name, rval.toString(), self.environment.forStepValue.toString())
-	rval, err = rval.mathPlus(&self.environment.forStepValue)
+	rval, err = self.evaluate(destination)
 	if ( err != nil ) {
 		return nil, err
 	}
-	//fmt.Println("Continuing loop")
-	self.environment.nextline = self.environment.loopFirstLine
+	switch ( rval.valuetype ) {
+	case TYPE_INTEGER:
+		sprite, err = self.spriteNumber(float64(rval.intval))
+	case TYPE_FLOAT:
+		sprite, err = self.spriteNumber(rval.floatval)
+	default:
+		return nil, newBasicRuntimeError(TYPE_MISMATCH, "SPRSAV expected a sprite number or a string variable")
+	}
+	if ( err != nil ) {
+		return nil, err
+	}
+	if ( !self.sprites.setShape(sprite, shape) ) {
+		return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "SPRSAV expected a shape made by SSHAPE or SPRSAV")
+	}
 	return &self.staticTrueValue, nil
 }
 
-func (self *BasicRuntime) CommandEXIT(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+func (self *BasicRuntime) CommandCOLLISION(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// COLLISION TYPE[, LINE]
+	var err error = nil
+	var args []float64
+	var given []bool
 
-	if ( self.environment.forToValue.valuetype == TYPE_UNDEFINED ) {
-		return nil, errors.New("EXIT outside the context of FOR")
+	args, given, err = self.graphicArguments(expr, "COLLISION", 0, 0)
+	if ( err != nil ) {
+		return nil, err
 	}
-
-	self.environment.nextline = self.environment.loopExitLine
-	self.prevEnvironment()
+	if ( !given[0] ) {
+		return nil, errors.New("Expected COLLISION (type)[, (line)]")
+	}
+	if ( args[0] < COLLISION_SPRITE || args[0] > COLLISION_LIGHT_PEN ) {
+		return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "COLLISION type must be between %d and %d", COLLISION_SPRITE, COLLISION_LIGHT_PEN)
+	}
+	// Without a line, collisions of this type are ignored again
+	self.sprites.collisionLines[int(args[0]) - 1] = int64(args[1])
 	return &self.staticTrueValue, nil
 }
-
@@ -8,15 +8,21 @@ import (
 	"strings"
 	"strconv"
 	"slices"
+	"unicode/utf8"
 	"unsafe"
 )
 
 func (self *BasicRuntime) initFunctions() {
 	var funcdefs string = `
 10 DEF ABS(X#) = X#
+15 DEF ASC(X$) = X$
 20 DEF ATN(X#) = X#
+25 DEF BUMP(X#) = X#
 30 DEF CHR(X#) = X#
 40 DEF COS(X#) = X#
+41 DEF EL = 0
+42 DEF ER = 0
+43 DEF ERR(X#) = X#
 50 DEF HEX(X#) = X#
 60 DEF INSTR(X$, Y$) = X$
 70 DEF LEFT(X$, A#) = X$
@@ -29,12 +35,19 @@ func (self *BasicRuntime) initFunctions() {
 106 DEF POINTER(X#) = X#
 110 DEF RIGHT(X$, A#) = X$
 120 DEF RAD(X#) = X#
+121 DEF RCLR(X#) = X#
+122 DEF RDOT(X#) = X#
+123 DEF RGR(X#) = X#
+124 DEF RWINDOW(X#) = X#
+125 DEF RSPPOS(X#, Y#) = X#
 130 DEF SGN(X#) = X#
 135 DEF SHL(X#, Y#) = X#
 136 DEF SHR(X#, Y#) = X#
 140 DEF SIN(X#) = X#
 150 DEF SPC(X#) = " " * X#
+155 DEF ST = 0
 160 DEF STR(X#) = "" + X#
+165 DEF TAB(X#) = X#
 170 DEF TAN(X#) = X#
 180 DEF VAL(X$) = X#
 190 DEF XOR(X#, Y#) = X#`
@@ -52,10 +65,7 @@ func (self *BasicRuntime) initFunctions() {
 		delete(self.scanner.functions, basicfunc.name)
 		//fmt.Printf("%+v\n", basicfunc)
 	}
-	for i, _ := range self.source {
-		self.source[i].code = ""
-		self.source[i].lineno = 0
-	}
+	self.source.clear()
 	self.setMode(oldmode)
 }
 
@@ -87,6 +97,38 @@ func (self *BasicRuntime) FunctionABS(expr *BasicASTLeaf, lval *BasicValue, rval
 	return nil, errors.New("ABS expected integer or float")
 }
 
+func (self *BasicRuntime) FunctionASC(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var err error = nil
+	var tval *BasicValue = nil
+
+	if ( expr == nil ) {
+		return nil, errors.New("NIL leaf")
+	}
+	expr = expr.firstArgument()
+	if (expr != nil) {
+		rval, err = self.evaluate(expr)
+		if ( err != nil ) {
+			return nil, err
+		}
+		if ( rval.valuetype != TYPE_STRING ) {
+			return nil, errors.New("ASC expected STRING")
+		}
+		tval, err = self.environment.newValue()
+		if ( tval == nil ) {
+			return nil, err
+		}
+		// The code of the first character, which CHR makes it from. The
+		// empty string is 0.
+		tval.valuetype = TYPE_INTEGER
+		for _, c := range(rval.stringval) {
+			tval.intval = int64(c)
+			break
+		}
+		return tval, nil
+	}
+	return nil, errors.New("ASC expected STRING")
+}
+
 func (self *BasicRuntime) FunctionATN(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
 	var err error = nil
 	var tval *BasicValue = nil
@@ -117,6 +159,36 @@ func (self *BasicRuntime) FunctionATN(expr *BasicASTLeaf, lval *BasicValue, rval
 	return nil, errors.New("ATN expected integer or float")
 }
 
+func (self *BasicRuntime) FunctionBUMP(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var err error = nil
+	var tval *BasicValue = nil
+
+	if ( expr == nil ) {
+		return nil, errors.New("NIL leaf")
+	}
+	expr = expr.firstArgument()
+	if (expr != nil) {
+		rval, err = self.evaluate(expr)
+		if ( err != nil ) {
+			return nil, err
+		}
+		if ( rval.valuetype != TYPE_INTEGER ) {
+			return nil, errors.New("BUMP expected INTEGER")
+		}
+		if ( rval.intval != COLLISION_SPRITE && rval.intval != COLLISION_BACKGROUND ) {
+			return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "BUMP expected %d or %d", COLLISION_SPRITE, COLLISION_BACKGROUND)
+		}
+		tval, err = self.environment.newValue()
+		if ( tval == nil ) {
+			return nil, err
+		}
+		tval.valuetype = TYPE_INTEGER
+		tval.intval = self.sprites.bump(rval.intval)
+		return tval, nil
+	}
+	return nil, errors.New("BUMP expected INTEGER")
+}
+
 func (self *BasicRuntime) FunctionCHR(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
 	var err error = nil
 	var tval *BasicValue = nil
@@ -138,7 +210,7 @@ func (self *BasicRuntime) FunctionCHR(expr *BasicASTLeaf, lval *BasicValue, rval
 			return nil, err
 		}
 		tval.valuetype = TYPE_STRING
-		tval.stringval = string(rune(rval.intval)) 
+		tval.stringval = characterString(rune(rval.intval))
 		return tval, nil
 	}
 	return nil, errors.New("CHR expected INTEGER")
@@ -174,6 +246,62 @@ func (self *BasicRuntime) FunctionCOS(expr *BasicASTLeaf, lval *BasicValue, rval
 	return nil, errors.New("COS expected integer or float")
 }
 
+func (self *BasicRuntime) FunctionEL(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var tval *BasicValue = nil
+	var err error = nil
+
+	tval, err = self.environment.newValue()
+	if ( tval == nil ) {
+		return nil, err
+	}
+	tval.valuetype = TYPE_INTEGER
+	tval.intval = self.errorLine
+	return tval, nil
+}
+
+func (self *BasicRuntime) FunctionER(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var tval *BasicValue = nil
+	var err error = nil
+
+	tval, err = self.environment.newValue()
+	if ( tval == nil ) {
+		return nil, err
+	}
+	tval.valuetype = TYPE_INTEGER
+	tval.intval = int64(self.errorNumber)
+	return tval, nil
+}
+
+func (self *BasicRuntime) FunctionERR(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var err error = nil
+	var tval *BasicValue = nil
+
+	if ( expr == nil ) {
+		return nil, errors.New("NIL leaf")
+	}
+	expr = expr.firstArgument()
+	if (expr != nil) {
+		rval, err = self.evaluate(expr)
+		if ( err != nil ) {
+			return nil, err
+		}
+		if ( rval.valuetype != TYPE_INTEGER ) {
+			return nil, errors.New("ERR expected INTEGER")
+		}
+		if ( rval.intval <= int64(NOERROR) || rval.intval >= int64(MAX_BASIC_ERROR) ) {
+			return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "ERR expected an error number between 1 and %d", MAX_BASIC_ERROR - 1)
+		}
+		tval, err = self.environment.newValue()
+		if ( tval == nil ) {
+			return nil, err
+		}
+		tval.valuetype = TYPE_STRING
+		tval.stringval = BasicError(rval.intval).name()
+		return tval, nil
+	}
+	return nil, errors.New("ERR expected INTEGER")
+}
+
 func (self *BasicRuntime) FunctionHEX(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
 	var err error = nil
 	var tval *BasicValue = nil
@@ -237,6 +365,10 @@ func (self *BasicRuntime) FunctionINSTR(expr *BasicASTLeaf, lval *BasicValue, rv
 		return nil, err
 	}
 	rval.intval = int64(strings.Index(strtarget.stringval, substr.stringval))
+	if ( rval.intval > 0 ) {
+		// The position is counted in characters
+		rval.intval = int64(utf8.RuneCountInString(strtarget.stringval[:rval.intval]))
+	}
 	rval.valuetype = TYPE_INTEGER
 	return rval, nil
 }
@@ -276,10 +408,10 @@ func (self *BasicRuntime) FunctionLEFT(expr *BasicASTLeaf, lval *BasicValue, rva
 	if ( err != nil ) {
 		return nil, err
 	}
-	if ( length.intval >= int64(len(strtarget.stringval)) ) {
+	if ( length.intval >= int64(utf8.RuneCountInString(strtarget.stringval)) ) {
 		rval.stringval = strings.Clone(strtarget.stringval)
 	} else {
-		rval.stringval = strtarget.stringval[0:length.intval]
+		rval.stringval = string([]rune(strtarget.stringval)[0:length.intval])
 	}
 	rval.valuetype = TYPE_STRING
 	return rval, nil
@@ -297,7 +429,6 @@ func (self *BasicRuntime) FunctionLEN(expr *BasicASTLeaf, lval *BasicValue, rval
 	firstarg = expr.firstArgument()
 	
 	if ( firstarg == nil ||
-		firstarg == nil ||
 		(firstarg.isIdentifier() == false &&
 			firstarg.isLiteral() == false)) {
 		//fmt.Printf("%+v\n", expr);
@@ -315,7 +446,7 @@ func (self *BasicRuntime) FunctionLEN(expr *BasicASTLeaf, lval *BasicValue, rval
 		if ( err != nil ) {
 			return nil, err
 		}
-		rval.intval = int64(len(strval.stringval))
+		rval.intval = int64(utf8.RuneCountInString(strval.stringval))
 	} else {
 		varref = self.environment.get(firstarg.identifier)
 		rval.intval = int64(len(varref.values))
@@ -357,6 +488,7 @@ func (self *BasicRuntime) FunctionMID(expr *BasicASTLeaf, lval *BasicValue, rval
 	var startpos *BasicValue = nil
 	var length *BasicValue = nil
 	var curarg *BasicASTLeaf = nil
+	var characters []rune
 
 	if ( expr == nil ) {
 		return nil, errors.New("NIL leaf")
@@ -372,6 +504,7 @@ func (self *BasicRuntime) FunctionMID(expr *BasicASTLeaf, lval *BasicValue, rval
 	if ( err != nil ) {
 		return nil, err
 	}
+	characters = []rune(strtarget.stringval)
 	
 	curarg = curarg.right
 	if ( curarg == nil ||
@@ -400,14 +533,18 @@ func (self *BasicRuntime) FunctionMID(expr *BasicASTLeaf, lval *BasicValue, rval
 		if ( err != nil ) {
 			return nil, err
 		}
-		length.intval = int64(len(strtarget.stringval))
+		length.intval = int64(len(characters))
 	}
 
+	if ( startpos.intval < 0 || length.intval < 0 ) {
+		return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "MID start and length can't be negative")
+	}
 	rval, err = self.environment.newValue()
 	if ( err != nil ) {
 		return nil, err
 	}
-	rval.stringval = strtarget.stringval[startpos.intval:(startpos.intval+length.intval)]
+	// Anything past the end of the string is left out
+	rval.stringval = string(characters[min(startpos.intval, int64(len(characters))):min(startpos.intval + length.intval, int64(len(characters)))])
 	rval.valuetype = TYPE_STRING
 	return rval, nil
 }
@@ -418,6 +555,8 @@ func (self *BasicRuntime) FunctionPEEK(expr *BasicASTLeaf, lval *BasicValue, rva
 	var addr uintptr
 	var ptr unsafe.Pointer
 	var typedPtr *byte
+	var screenValue byte
+	var isScreen bool
 	
 	if ( expr == nil ) {
 		return nil, errors.New("NIL leaf")
@@ -439,6 +578,12 @@ func (self *BasicRuntime) FunctionPEEK(expr *BasicASTLeaf, lval *BasicValue, rva
 		if ( rval.valuetype != TYPE_INTEGER || rval.intval == 0 ) {
 			return nil, errors.New("PEEK got NIL pointer or uninitialized variable")
 		}
+		screenValue, isScreen = self.screen.peek(rval.intval)
+		if ( isScreen ) {
+			tval.valuetype = TYPE_INTEGER
+			tval.intval = int64(screenValue)
+			return tval, nil
+		}
 		addr = uintptr(rval.intval)
 		ptr = unsafe.Pointer(addr)
 		typedPtr = (*byte)(ptr)
@@ -486,7 +631,10 @@ func (self *BasicRuntime) FunctionPOINTER(expr *BasicASTLeaf, lval *BasicValue,
 		if ( expr.isIdentifier() == false ) {
 			return nil, errors.New("POINTER expected IDENTIFIER")
 		}
+		// The address of the variable itself, not of a copy of it
+		self.eval_clone_identifiers = false
 		rval, err = self.evaluate(expr)
+		self.eval_clone_identifiers = true
 		if ( err != nil ) {
 			return nil, err
 		}
@@ -540,6 +688,167 @@ func (self *BasicRuntime) FunctionRAD(expr *BasicASTLeaf, lval *BasicValue, rval
 	return nil, errors.New("RAD expected integer or float")
 }
 
+func (self *BasicRuntime) FunctionRCLR(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var err error = nil
+	var tval *BasicValue = nil
+
+	if ( expr == nil ) {
+		return nil, errors.New("NIL leaf")
+	}
+	expr = expr.firstArgument()
+	if (expr != nil) {
+		rval, err = self.evaluate(expr)
+		if ( err != nil ) {
+			return nil, err
+		}
+		if ( rval.valuetype != TYPE_INTEGER ) {
+			return nil, errors.New("RCLR expected INTEGER")
+		}
+		if ( rval.intval < 0 || rval.intval >= COLOR_SOURCES ) {
+			return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "RCLR expected a colour source between 0 and %d", COLOR_SOURCES - 1)
+		}
+		tval, err = self.environment.newValue()
+		if ( tval == nil ) {
+			return nil, err
+		}
+		tval.valuetype = TYPE_INTEGER
+		tval.intval = self.colors[rval.intval]
+		return tval, nil
+	}
+	return nil, errors.New("RCLR expected INTEGER")
+}
+
+func (self *BasicRuntime) FunctionRDOT(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var err error = nil
+	var tval *BasicValue = nil
+	var x int
+	var y int
+
+	if ( expr == nil ) {
+		return nil, errors.New("NIL leaf")
+	}
+	expr = expr.firstArgument()
+	if (expr != nil) {
+		rval, err = self.evaluate(expr)
+		if ( err != nil ) {
+			return nil, err
+		}
+		if ( rval.valuetype != TYPE_INTEGER ) {
+			return nil, errors.New("RDOT expected INTEGER")
+		}
+		tval, err = self.environment.newValue()
+		if ( tval == nil ) {
+			return nil, err
+		}
+		tval.valuetype = TYPE_INTEGER
+		switch ( rval.intval ) {
+		case 0: tval.intval = int64(self.bitmap.cursorX)
+		case 1: tval.intval = int64(self.bitmap.cursorY)
+		case 2:
+			// The colour source of the pixel under the pixel cursor
+			tval.intval = COLOR_SOURCE_BACKGROUND
+			if ( self.bitmap.allocated ) {
+				x, y = self.bitmap.toPixel(self.bitmap.cursorX, self.bitmap.cursorY)
+				tval.intval = int64(self.bitmap.point(x, y))
+			}
+		default:
+			return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "RDOT expected 0, 1 or 2")
+		}
+		return tval, nil
+	}
+	return nil, errors.New("RDOT expected INTEGER")
+}
+
+func (self *BasicRuntime) FunctionRGR(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var tval *BasicValue = nil
+	var err error = nil
+
+	// The argument is a dummy, as it is on the C128
+	tval, err = self.environment.newValue()
+	if ( tval == nil ) {
+		return nil, err
+	}
+	tval.valuetype = TYPE_INTEGER
+	tval.intval = self.bitmap.mode
+	return tval, nil
+}
+
+func (self *BasicRuntime) FunctionRSPPOS(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var err error = nil
+	var tval *BasicValue = nil
+	var sval *BasicValue = nil
+	var sprite *BasicSprite = nil
+
+	if ( expr == nil ) {
+		return nil, errors.New("NIL leaf")
+	}
+	expr = expr.firstArgument()
+	if ( expr != nil && expr.right != nil ) {
+		rval, err = self.evaluate(expr)
+		if ( err != nil ) {
+			return nil, err
+		}
+		sval, err = self.evaluate(expr.right)
+		if ( err != nil ) {
+			return nil, err
+		}
+		if ( rval.valuetype != TYPE_INTEGER || sval.valuetype != TYPE_INTEGER ) {
+			return nil, errors.New("RSPPOS expected INTEGER, INTEGER")
+		}
+		sprite, err = self.spriteNumber(float64(rval.intval))
+		if ( err != nil ) {
+			return nil, err
+		}
+		tval, err = self.environment.newValue()
+		if ( tval == nil ) {
+			return nil, err
+		}
+		tval.valuetype = TYPE_INTEGER
+		switch ( sval.intval ) {
+		case 0: tval.intval = int64(sprite.x)
+		case 1: tval.intval = int64(sprite.y)
+		case 2: tval.intval = int64(sprite.speed)
+		default:
+			return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "RSPPOS expected 0, 1 or 2")
+		}
+		return tval, nil
+	}
+	return nil, errors.New("RSPPOS expected INTEGER, INTEGER")
+}
+
+func (self *BasicRuntime) FunctionRWINDOW(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var err error = nil
+	var tval *BasicValue = nil
+
+	if ( expr == nil ) {
+		return nil, errors.New("NIL leaf")
+	}
+	expr = expr.firstArgument()
+	if (expr != nil) {
+		rval, err = self.evaluate(expr)
+		if ( err != nil ) {
+			return nil, err
+		}
+		if ( rval.valuetype != TYPE_INTEGER ) {
+			return nil, errors.New("RWINDOW expected INTEGER")
+		}
+		tval, err = self.environment.newValue()
+		if ( tval == nil ) {
+			return nil, err
+		}
+		tval.valuetype = TYPE_INTEGER
+		switch ( rval.intval ) {
+		case 0: tval.intval = int64(self.screen.window.bottom - self.screen.window.top + 1)
+		case 1: tval.intval = int64(self.screen.window.right - self.screen.window.left + 1)
+		case 2: tval.intval = int64(self.screen.columns)
+		default:
+			return nil, newBasicRuntimeError(ILLEGAL_QUANTITY, "RWINDOW expected 0, 1 or 2")
+		}
+		return tval, nil
+	}
+	return nil, errors.New("RWINDOW expected INTEGER")
+}
+
 func (self *BasicRuntime) FunctionRIGHT(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
 	var err error = nil
 	var strtarget *BasicValue = nil
@@ -575,12 +884,13 @@ func (self *BasicRuntime) FunctionRIGHT(expr *BasicASTLeaf, lval *BasicValue, rv
 	if ( err != nil ) {
 		return nil, err
 	}
-	var maxlen = int64(len(strtarget.stringval))
+	var characters []rune = []rune(strtarget.stringval)
+	var maxlen = int64(len(characters))
 	if ( length.intval >= maxlen ) {
 		rval.stringval = strings.Clone(strtarget.stringval)
 	} else {
 		var start int64 = maxlen - length.intval
-		rval.stringval = strtarget.stringval[start:maxlen]
+		rval.stringval = string(characters[start:maxlen])
 	}
 	rval.valuetype = TYPE_STRING
 	return rval, nil
@@ -709,6 +1019,24 @@ func (self *BasicRuntime) FunctionSIN(expr *BasicASTLeaf, lval *BasicValue, rval
 	return nil, errors.New("SIN expected integer or float")
 }
 
+func (self *BasicRuntime) FunctionST(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	var tval *BasicValue = nil
+	var err error = nil
+
+	tval, err = self.environment.newValue()
+	if ( tval == nil ) {
+		return nil, err
+	}
+	tval.valuetype = TYPE_INTEGER
+	tval.intval = self.ioStatus
+	return tval, nil
+}
+
+func (self *BasicRuntime) FunctionTAB(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
+	// CommandPRINT moves the cursor itself when it finds TAB
+	return nil, newBasicRuntimeError(SYNTAX, "TAB can only be used in PRINT")
+}
+
 func (self *BasicRuntime) FunctionTAN(expr *BasicASTLeaf, lval *BasicValue, rval *BasicValue) (*BasicValue, error) {
 	var err error = nil
 	var tval *BasicValue = nil
@@ -750,7 +1078,6 @@ func (self *BasicRuntime) FunctionVAL(expr *BasicASTLeaf, lval *BasicValue, rval
 	firstarg = expr.firstArgument()
 	
 	if ( firstarg == nil ||
-		firstarg == nil ||
 		(firstarg.isIdentifier() == false &&
 			firstarg.isLiteral() == false)) {
 		//fmt.Printf("%+v\n", expr);
@@ -1,189 +1,603 @@
 package main
 
 import (
+	"encoding/binary"
 	"fmt"
 	"strings"
+	"time"
+	"unicode"
 	"github.com/veandco/go-sdl2/sdl"
+	"github.com/veandco/go-sdl2/ttf"
 )
 
-func (self *BasicRuntime) advanceCursor(x int32, y int32) error { var
-	err error
-	self.cursorX += x
-	if ( self.cursorX >= self.maxCharsW ) {
-		self.cursorX = 0
-		self.cursorY += 1
-	} else if ( self.cursorX < 0 ) {
-		if ( self.cursorY > 0 ) {
-			self.cursorY -=1
-		}
-		self.cursorX = self.maxCharsW
-	}
-	self.cursorY += y
-	if ( self.cursorY >= self.maxCharsH - 1 ) {
-		err = self.scrollWindow(0, 1)
-		if ( err != nil ) {
-			return err
-		}
-		self.cursorY -= 1
+const (
+	// The border takes up this fraction of the window on each side
+	SCREEN_BORDER_DIVISOR = 20
+	// While a program runs, the window is drawn at most this often
+	REDRAW_INTERVAL = time.Second / 60
+)
+
+// BasicSDLFrontend draws the runtime's screen in an SDL window with the
+// Commodore font, and collects keyboard input from SDL events.
+type BasicSDLFrontend struct {
+	runtime *BasicRuntime
+	window *sdl.Window
+	// The text screen is drawn here a row at a time from the runtime's
+	// character grid, the bitmap is drawn on graphicsSurface and the
+	// sprites on spriteSurface. They are scaled up onto the window.
+	textSurface *sdl.Surface
+	graphicsSurface *sdl.Surface
+	spriteSurface *sdl.Surface
+
+	// What the window was last drawn with. When any of them change the
+	// whole window is drawn again.
+	columns int
+	background int64
+	borderColor int64
+	graphicMode int64
+	cursorColumn int
+	cursorRow int
+	redraw bool
+	lastDraw time.Time
+	// The cursor is shown while waiting for the user to type
+	cursorShown bool
+
+	font *ttf.Font
+	fontWidth int
+	fontHeight int
+
+	lineInProgress [MAX_LINE_LENGTH]rune
+	userlineIndex int
+}
+
+func (self *BasicSDLFrontend) init(runtime *BasicRuntime) error {
+	var err error = nil
+
+	self.runtime = runtime
+	err = sdl.Init(sdl.INIT_EVERYTHING)
+	if ( err != nil ) {
+		return err
+	}
+	err = ttf.Init()
+	if ( err != nil ) {
+		sdl.Quit()
+		return err
+	}
+	self.window, err = sdl.CreateWindow(
+		"BASIC",
+		sdl.WINDOWPOS_UNDEFINED,
+		sdl.WINDOWPOS_UNDEFINED,
+		800, 600,
+		sdl.WINDOW_SHOWN | sdl.WINDOW_RESIZABLE)
+	if ( err != nil ) {
+		self.close()
+		return err
 	}
-	//fmt.Println("Cursor X, Y : %d, %d", self.cursorX, self.cursorY)
+	// Load the font for our text
+	self.font, err = ttf.OpenFont("./fonts/C64_Pro_Mono-STYLE.ttf", 16)
+	if ( err != nil ) {
+		self.close()
+		return err
+	}
+	self.fontWidth, self.fontHeight, err = self.font.SizeUTF8("A")
+	if ( err != nil ) {
+		self.close()
+		return fmt.Errorf("Could not get the height and width of the font : %s", err)
+	}
+	// Big enough for the 80 column screen. The 40 column screen uses the
+	// left half of it.
+	self.textSurface, err = sdl.CreateRGBSurfaceWithFormat(0,
+		int32(SCREEN_COLUMNS_80 * self.fontWidth),
+		int32(TEXT_LINES * self.fontHeight),
+		32, sdl.PIXELFORMAT_ARGB8888)
+	if ( err != nil ) {
+		self.close()
+		return fmt.Errorf("Could not create the text screen surface : %s", err)
+	}
+	self.graphicsSurface, err = sdl.CreateRGBSurfaceWithFormat(0, BITMAP_WIDTH, BITMAP_HEIGHT, 32, sdl.PIXELFORMAT_ARGB8888)
+	if ( err != nil ) {
+		self.close()
+		return fmt.Errorf("Could not create the graphics surface : %s", err)
+	}
+	self.spriteSurface, err = sdl.CreateRGBSurfaceWithFormat(0, BITMAP_WIDTH, BITMAP_HEIGHT, 32, sdl.PIXELFORMAT_ARGB8888)
+	if ( err != nil ) {
+		self.close()
+		return fmt.Errorf("Could not create the sprite surface : %s", err)
+	}
+	// Only the pixels of the sprites are drawn over the screen
+	err = self.spriteSurface.SetBlendMode(sdl.BLENDMODE_BLEND)
+	if ( err != nil ) {
+		self.close()
+		return err
+	}
+	self.redraw = true
 	return nil
 }
 
-func (self *BasicRuntime) drawCursor() error {
-	return self.drawText(
-		(self.cursorX * int32(self.fontWidth)),
-		(self.cursorY * int32(self.fontHeight)),
-		"_",
-		true)
+func (self *BasicSDLFrontend) close() {
+	if ( self.textSurface != nil ) {
+		self.textSurface.Free()
+		self.textSurface = nil
+	}
+	if ( self.graphicsSurface != nil ) {
+		self.graphicsSurface.Free()
+		self.graphicsSurface = nil
+	}
+	if ( self.spriteSurface != nil ) {
+		self.spriteSurface.Free()
+		self.spriteSurface = nil
+	}
+	if ( self.font != nil ) {
+		self.font.Close()
+		self.font = nil
+	}
+	if ( self.window != nil ) {
+		self.window.Destroy()
+		self.window = nil
+	}
+	ttf.Quit()
+	sdl.Quit()
+}
+
+func (self *BasicSDLFrontend) startTextInput() {
+	sdl.StartTextInput()
+}
+
+func (self *BasicSDLFrontend) drawCursor() error {
+	return self.drawScreen(true)
+}
+
+func (self *BasicSDLFrontend) drawPrintBuffer() error {
+	return self.drawScreen(false)
+}
+
+func (self *BasicSDLFrontend) drawGraphics() error {
+	return self.drawScreen(false)
 }
 
-func (self *BasicRuntime) drawWrappedText(x int32, y int32, text string) error {
+// drawScreen draws the rows of the text screen which have changed onto
+// textSurface, and then the screen, bitmap and border onto the window if
+// any of them have changed. Unless force is set, a running program only
+// has the window drawn every REDRAW_INTERVAL.
+func (self *BasicSDLFrontend) drawScreen(force bool) error {
+	var screen *BasicScreen = &self.runtime.screen
+	var bitmap *BasicBitmap = &self.runtime.bitmap
+	var changed bool = false
+	var row int
 	var err error
-	var curslice string
-	var curstartidx int32 = 0
-	var endidx int32 = 0
-
-	// chop the text up into slices that will fit onto the screen after the cursor
-	for ( curstartidx < int32(len(text)) ) {
-		endidx = curstartidx + (self.maxCharsW - self.cursorX)
-		if ( endidx >= int32(len(text)) ) {
-			endidx = int32(len(text))
-		}
-		curslice = text[curstartidx:endidx]
-		//fmt.Printf("Drawing \"%s\"\n", curslice)
-		err = self.drawText(x, y, curslice, false)
-		self.advanceCursor(int32(len(curslice)), 0)
-		x = (self.cursorX * int32(self.fontWidth))
-		y = (self.cursorY * int32(self.fontHeight))
-		self.window.UpdateSurface()
+
+	if ( !force && self.runtime.mode == MODE_RUN && time.Since(self.lastDraw) < REDRAW_INTERVAL ) {
+		return nil
+	}
+	if ( screen.columns != self.columns ||
+		self.backgroundColor() != self.background ||
+		self.runtime.colors[COLOR_SOURCE_BORDER] != self.borderColor ||
+		bitmap.mode != self.graphicMode ) {
+		self.columns = screen.columns
+		self.background = self.backgroundColor()
+		self.borderColor = self.runtime.colors[COLOR_SOURCE_BORDER]
+		self.graphicMode = bitmap.mode
+		self.redraw = true
+	}
+	if ( self.redraw ) {
+		for row = 0; row < TEXT_LINES; row++ {
+			screen.dirtyRows[row] = true
+		}
+		bitmap.dirty = true
+		changed = true
+	}
+	for row = 0; row < TEXT_LINES; row++ {
+		if ( !screen.dirtyRows[row] ) {
+			continue
+		}
+		err = self.renderRow(row)
 		if ( err != nil ) {
 			return err
 		}
-		if ( endidx == int32(len(text)) ) {
-			break
+		screen.dirtyRows[row] = false
+		changed = true
+	}
+	if ( bitmap.visible() && bitmap.dirty ) {
+		err = self.renderBitmap()
+		if ( err != nil ) {
+			return err
 		}
-		curstartidx += int32(len(curslice))
+		bitmap.dirty = false
+		changed = true
 	}
-	return nil
+	if ( self.runtime.sprites.dirty ) {
+		self.runtime.sprites.dirty = false
+		changed = true
+	}
+	if ( screen.column != self.cursorColumn || screen.row != self.cursorRow ) {
+		self.cursorColumn = screen.column
+		self.cursorRow = screen.row
+		changed = changed || self.cursorShown
+	}
+	if ( !changed ) {
+		return nil
+	}
+	self.redraw = false
+	self.lastDraw = time.Now()
+	return self.drawWindow()
 }
 
-func (self *BasicRuntime) drawText(x int32, y int32, text string, updateWindow bool) error {
+// drawWindow scales the text screen and the bitmap up onto the window,
+// inside of the border
+func (self *BasicSDLFrontend) drawWindow() error {
+	var bitmap *BasicBitmap = &self.runtime.bitmap
 	var windowSurface *sdl.Surface
-	var textSurface *sdl.Surface
+	var area sdl.Rect
+	var textSource sdl.Rect
+	var textDestination sdl.Rect
+	var bitmapSource sdl.Rect
+	var bitmapDestination sdl.Rect
+	var splitHeight int32
 	var err error
 
 	windowSurface, err = self.window.GetSurface()
 	if ( err != nil ) {
 		return err
 	}
-
-	textSurface, err = self.font.RenderUTF8Shaded(
-		text,
-		sdl.Color{R: 255, G: 255, B: 255, A: 255},
-		sdl.Color{R: 0, G: 0, B: 0, A: 255})
+	err = windowSurface.FillRect(nil, self.mapColor(windowSurface, self.borderColor))
 	if ( err != nil ) {
 		return err
 	}
-	defer textSurface.Free()
-	
-	err = textSurface.Blit(nil,
-		windowSurface,
+	area = self.screenArea(windowSurface)
+	textSource = sdl.Rect{X: 0, Y: 0, W: int32(self.columns * self.fontWidth), H: int32(TEXT_LINES * self.fontHeight)}
+	textDestination = area
+	if ( bitmap.visible() ) {
+		bitmapSource = sdl.Rect{X: 0, Y: 0, W: BITMAP_WIDTH, H: BITMAP_HEIGHT}
+		bitmapDestination = area
+		if ( bitmap.split() ) {
+			// Text is shown below the split line
+			bitmapSource.H = int32(BITMAP_HEIGHT * bitmap.splitLine / TEXT_LINES)
+			splitHeight = int32(int64(area.H) * bitmap.splitLine / TEXT_LINES)
+			bitmapDestination.H = splitHeight
+			textSource.Y = int32(int64(self.fontHeight) * bitmap.splitLine)
+			textSource.H -= textSource.Y
+			textDestination.Y += splitHeight
+			textDestination.H -= splitHeight
+		} else {
+			textSource.H = 0
+		}
+		err = self.graphicsSurface.BlitScaled(&bitmapSource, windowSurface, &bitmapDestination)
+		if ( err != nil ) {
+			return err
+		}
+	}
+	if ( textSource.H > 0 ) {
+		err = self.textSurface.BlitScaled(&textSource, windowSurface, &textDestination)
+		if ( err != nil ) {
+			return err
+		}
+	}
+	if ( self.runtime.sprites.visible() ) {
+		err = self.renderSprites()
+		if ( err != nil ) {
+			return err
+		}
+		err = self.spriteSurface.BlitScaled(nil, windowSurface, &area)
+		if ( err != nil ) {
+			return err
+		}
+	}
+	if ( self.cursorShown && textSource.H > 0 && self.cursorRow >= int(textSource.Y) / self.fontHeight ) {
+		err = self.drawCursorCell(windowSurface, area)
+		if ( err != nil ) {
+			return err
+		}
+	}
+	return self.window.UpdateSurface()
+}
+
+// screenArea returns the part of the window inside of the border
+func (self *BasicSDLFrontend) screenArea(windowSurface *sdl.Surface) sdl.Rect {
+	var borderWidth int32 = windowSurface.W / SCREEN_BORDER_DIVISOR
+	var borderHeight int32 = windowSurface.H / SCREEN_BORDER_DIVISOR
+	return sdl.Rect{
+		X: borderWidth,
+		Y: borderHeight,
+		W: windowSurface.W - (2 * borderWidth),
+		H: windowSurface.H - (2 * borderHeight)}
+}
+
+// drawCursorCell underlines the cell the cursor is in
+func (self *BasicSDLFrontend) drawCursorCell(windowSurface *sdl.Surface, area sdl.Rect) error {
+	var cellWidth int32 = area.W / int32(self.columns)
+	var cellHeight int32 = area.H / TEXT_LINES
+	var color int64 = self.runtime.colors[COLOR_SOURCE_CHARACTER]
+	return windowSurface.FillRect(
 		&sdl.Rect{
-			X: x,
-			Y: y,
-			W: 0,
-			H: 0})
+			X: area.X + (int32(self.cursorColumn) * cellWidth),
+			Y: area.Y + (int32(self.cursorRow + 1) * cellHeight) - max(cellHeight / 8, 1),
+			W: cellWidth,
+			H: max(cellHeight / 8, 1)},
+		self.mapColor(windowSurface, color))
+}
+
+// renderRow draws a row of the runtime's text screen onto textSurface
+func (self *BasicSDLFrontend) renderRow(row int) error {
+	var screen *BasicScreen = &self.runtime.screen
+	var runSurface *sdl.Surface
+	var y int32 = int32(row * self.fontHeight)
+	var color int64
+	var start int = 0
+	var end int
+	var err error
+
+	err = self.textSurface.FillRect(
+		&sdl.Rect{X: 0, Y: y, W: self.textSurface.W, H: int32(self.fontHeight)},
+		self.mapColor(self.textSurface, self.background))
 	if ( err != nil ) {
 		return err
 	}
-	if ( updateWindow == true ) {
-		self.window.UpdateSurface()
-	}		
+	for ( start < screen.columns ) {
+		// Draw each run of characters which are the same colour together
+		color = screen.cellColor(start, row)
+		end = start + 1
+		for ( end < screen.columns && screen.cellColor(end, row) == color ) {
+			end += 1
+		}
+		runSurface, err = self.font.RenderUTF8Shaded(
+			string(screen.characters[(row * screen.columns) + start:(row * screen.columns) + end]),
+			sdlColor(color),
+			sdlColor(self.background))
+		if ( err != nil ) {
+			return err
+		}
+		err = runSurface.Blit(nil,
+			self.textSurface,
+			&sdl.Rect{X: int32(start * self.fontWidth), Y: y, W: 0, H: 0})
+		runSurface.Free()
+		if ( err != nil ) {
+			return err
+		}
+		start = end
+	}
 	return nil
 }
 
-func (self *BasicRuntime) scrollWindow(x int32, y int32) error {
+// renderBitmap copies the runtime's bitmap onto graphicsSurface
+func (self *BasicSDLFrontend) renderBitmap() error {
+	var bitmap *BasicBitmap = &self.runtime.bitmap
+	var colors [COLORS]uint32
+	var pixels []byte
+	var offset int
+	var x int
+	var y int
 	var err error
-	var windowSurface *sdl.Surface
-	var newTextHeight int32 = int32(self.fontHeight * strings.Count(self.printBuffer, "\n"))
-	windowSurface, err = self.window.GetSurface()
-	err = windowSurface.Blit(
-		&sdl.Rect{
-			X: 0, Y: 0,
-			W: windowSurface.W, H: windowSurface.H},
-		self.printSurface,
-		&sdl.Rect{
-			X: 0, Y:0,
-			W: windowSurface.W, H: windowSurface.H})
+
+	for i, color := range(palette) {
+		colors[i] = sdl.MapRGB(self.graphicsSurface.Format, color.R, color.G, color.B)
+	}
+	err = self.graphicsSurface.Lock()
 	if ( err != nil ) {
 		return err
 	}
-	err = windowSurface.FillRect(nil, 0x00000000)
+	defer self.graphicsSurface.Unlock()
+	pixels = self.graphicsSurface.Pixels()
+	for y = 0; y < BITMAP_HEIGHT; y++ {
+		for x = 0; x < BITMAP_WIDTH; x++ {
+			offset = (y * int(self.graphicsSurface.Pitch)) + (x * 4)
+			binary.LittleEndian.PutUint32(pixels[offset:], colors[bitmap.color((y * BITMAP_WIDTH) + x) - 1])
+		}
+	}
+	return nil
+}
+
+// renderSprites draws the runtime's sprites onto spriteSurface, which is
+// transparent everywhere else
+func (self *BasicSDLFrontend) renderSprites() error {
+	var sprites *BasicSprites = &self.runtime.sprites
+	var colors [COLORS]uint32
+	var pixels []byte
+	var color int64
+	var offset int
+	var x int
+	var y int
+	var err error
+
+	for i, c := range(palette) {
+		colors[i] = sdl.MapRGBA(self.spriteSurface.Format, c.R, c.G, c.B, 255)
+	}
+	err = self.spriteSurface.Lock()
 	if ( err != nil ) {
 		return err
 	}
-	err = self.printSurface.Blit(
-		&sdl.Rect{
-			X: 0, Y: newTextHeight,
-			W: windowSurface.W, H: windowSurface.H - newTextHeight},
-		windowSurface,
-		&sdl.Rect{
-			X: 0, Y: 0,
-			W: windowSurface.W, H: newTextHeight})
-	self.cursorX = 0
-	self.cursorY = (self.maxCharsH - int32(strings.Count(self.printBuffer, "\n")))
-	
+	defer self.spriteSurface.Unlock()
+	pixels = self.spriteSurface.Pixels()
+	for y = 0; y < BITMAP_HEIGHT; y++ {
+		for x = 0; x < BITMAP_WIDTH; x++ {
+			offset = (y * int(self.spriteSurface.Pitch)) + (x * 4)
+			color = sprites.color(x, y)
+			if ( color == 0 ) {
+				binary.LittleEndian.PutUint32(pixels[offset:], 0)
+			} else {
+				binary.LittleEndian.PutUint32(pixels[offset:], colors[color - 1])
+			}
+		}
+	}
 	return nil
 }
 
-func (self *BasicRuntime) Write(text string) {
-	fmt.Printf(text)
-	self.drawWrappedText(
-		(self.cursorX * int32(self.fontWidth)),
-		(self.cursorY * int32(self.fontHeight)),
-		text)
+// sdlColor returns a colour of the palette
+func sdlColor(color int64) sdl.Color {
+	var c BasicColor = palette[color - 1]
+	return sdl.Color{R: c.R, G: c.G, B: c.B, A: 255}
+}
+
+func (self *BasicSDLFrontend) mapColor(surface *sdl.Surface, color int64) uint32 {
+	var c BasicColor = palette[color - 1]
+	return sdl.MapRGB(surface.Format, c.R, c.G, c.B)
+}
+
+// backgroundColor returns the colour behind text in the current mode
+func (self *BasicSDLFrontend) backgroundColor() int64 {
+	if ( self.runtime.bitmap.mode == GRAPHIC_TEXT_80 ) {
+		return self.runtime.colors[COLOR_SOURCE_BACKGROUND_80]
+	}
+	return self.runtime.colors[COLOR_SOURCE_BACKGROUND]
 }
 
-func (self *BasicRuntime) Println(text string) {
-	fmt.Println(text)
-	self.printBuffer += text + "\n"
-	self.cursorY += int32(strings.Count(text, "\n"))
-	self.cursorX = 0
+// Write and Println only copy the text to stdout. The runtime has already
+// put it on its screen, which is drawn by drawScreen.
+func (self *BasicSDLFrontend) Write(text string) {
+	fmt.Print(stripControlCodes(text))
+	self.moveCursor()
 }
 
-func (self *BasicRuntime) drawPrintBuffer() error {
+func (self *BasicSDLFrontend) Println(text string) {
+	fmt.Println(stripControlCodes(text))
+	self.moveCursor()
+}
+
+// moveCursor sets the runtime's cursor to the cursor of its screen
+func (self *BasicSDLFrontend) moveCursor() {
+	self.runtime.cursorX = int32(self.runtime.screen.cursorColumn())
+	self.runtime.cursorY = int32(self.runtime.screen.cursorRow())
+}
+
+func (self *BasicSDLFrontend) processEvents() error {
+	var screen *BasicScreen = &self.runtime.screen
+	var ir rune
+	var sb strings.Builder
+	var i int
 	var err error
-	if ( len(self.printBuffer) == 0 ) {
-		return nil
+
+	if ( !self.cursorShown ) {
+		self.cursorShown = true
+		self.redraw = true
 	}
-	if ( self.cursorY >= self.maxCharsH - 1) {
-		err = self.scrollWindow(0, int32(self.fontHeight * strings.Count(self.printBuffer, "\n"))+1)
-		if ( err != nil ) {
-			fmt.Println(err)
-			return err
+	// Wait briefly for the first event so that callers waiting for a
+	// line of input don't spin
+	for event := sdl.WaitEventTimeout(EVENT_WAIT_MS); event != nil; event = sdl.PollEvent() {
+		switch t := event.(type) {
+		case *sdl.QuitEvent:
+			self.runtime.setMode(MODE_QUIT)
+		case *sdl.WindowEvent:
+			self.windowEvent(t)
+		case *sdl.TextInputEvent:
+			// This is LAZY but it works on US ASCII keyboards so I guess
+			// international users go EFF themselves? It's how we did it in the old days...
+			ir = rune(t.Text[0])
+			if ( unicode.IsPrint(ir) && self.userlineIndex < MAX_LINE_LENGTH - 1 ) {
+				self.lineInProgress[self.userlineIndex] = ir
+				self.userlineIndex += 1
+				screen.print(string(ir))
+			}
+		case *sdl.KeyboardEvent:
+			if ( t.Type != sdl.KEYUP ) {
+				continue
+			}
+			ir = self.runeForSDLScancode(t.Keysym)
+			if ( ir == sdl.K_LEFT ) {
+				if ( self.userlineIndex > 0 ) {
+					self.userlineIndex -= 1
+					screen.cursorLeft()
+				}
+			} else if ( ir == sdl.K_RIGHT ) {
+				if ( self.userlineIndex < MAX_LINE_LENGTH - 1 &&
+					self.lineInProgress[self.userlineIndex] != 0 ) {
+					self.userlineIndex += 1
+					screen.cursorRight()
+				}
+			} else if ( ir == sdl.K_BACKSPACE ) {
+				if ( self.userlineIndex > 0 ) {
+					self.userlineIndex -= 1
+					self.lineInProgress[self.userlineIndex] = 0
+					screen.backspace()
+				}
+			} else if ( ir == sdl.K_RETURN || ir == '\n' ) {
+				for i = 0; i < MAX_LINE_LENGTH; i++ {
+					if ( self.lineInProgress[i] == 0 ) {
+						break
+					}
+					sb.WriteRune(self.lineInProgress[i])
+					self.lineInProgress[i] = 0
+				}
+				self.runtime.userline = sb.String()
+				self.runtime.lineEntered = true
+				self.userlineIndex = 0
+				self.cursorShown = false
+				screen.newline()
+				self.moveCursor()
+			}
 		}
-		//fmt.Printf("Cursor X %d Y %d\n", self.cursorX, self.cursorY)
 	}
-	for _, line := range strings.Split(self.printBuffer, "\n") {
-		if ( len(line) == 0 ) {
-			break
+	err = self.drawScreen(true)
+	if ( err != nil ) {
+		fmt.Println(err)
+		return err
+	}
+	return nil
+}
+
+// windowEvent redraws the whole window the next time the screen is drawn
+// if the window has been resized or uncovered
+func (self *BasicSDLFrontend) windowEvent(event *sdl.WindowEvent) {
+	if ( event.Event == sdl.WINDOWEVENT_SIZE_CHANGED || event.Event == sdl.WINDOWEVENT_EXPOSED ) {
+		self.redraw = true
+	}
+}
+
+func (self *BasicSDLFrontend) getKey(wait bool) (rune, error) {
+	var event sdl.Event
+	var err error
+	for {
+		if ( wait ) {
+			event = sdl.WaitEventTimeout(EVENT_WAIT_MS)
+		} else {
+			event = sdl.PollEvent()
 		}
-		err = self.drawWrappedText(
-			(self.cursorX * int32(self.fontWidth)),
-			(self.cursorY * int32(self.fontHeight)),
-			line)
-		if ( err != nil ) {
-			fmt.Println(err)
-			return err
+		if ( event == nil ) {
+			if ( wait && self.runtime.mode != MODE_QUIT ) {
+				continue
+			}
+			return 0, nil
+		}
+		switch t := event.(type) {
+		case *sdl.QuitEvent:
+			self.runtime.setMode(MODE_QUIT)
+			return 0, nil
+		case *sdl.WindowEvent:
+			// Nothing else draws the window while GETKEY waits
+			self.windowEvent(t)
+			err = self.drawScreen(true)
+			if ( err != nil ) {
+				return 0, err
+			}
+		case *sdl.TextInputEvent:
+			return rune(t.Text[0]), nil
+		case *sdl.KeyboardEvent:
+			// Printable keys arrive as TextInputEvents
+			if ( t.Type != sdl.KEYDOWN ) {
+				continue
+			}
+			switch ( t.Keysym.Sym ) {
+			case sdl.K_RETURN: return '\r', nil
+			case sdl.K_BACKSPACE: return rune(20), nil
+			case sdl.K_ESCAPE: return rune(27), nil
+			case sdl.K_UP: return rune(145), nil
+			case sdl.K_DOWN: return rune(17), nil
+			case sdl.K_LEFT: return rune(157), nil
+			case sdl.K_RIGHT: return rune(29), nil
+			}
 		}
-		self.cursorX = 0
-		self.cursorY += 1
 	}
-	//fmt.Printf("Cursor X %d Y %d\n", self.cursorX, self.cursorY)
-	if ( self.cursorY >= self.maxCharsH - 1) {
-		//fmt.Println("Forcing cursor to bottom -1")
-		self.cursorY = self.maxCharsH - 1
+}
+
+func (self *BasicSDLFrontend) runeForSDLScancode(keysym sdl.Keysym) rune {
+	var rc rune = 0
+	var keyboardstate []uint8
+	rc = rune(keysym.Sym)
+	keyboardstate = sdl.GetKeyboardState()
+	if ( keyboardstate[sdl.SCANCODE_LSHIFT] != 0 ||
+		keyboardstate[sdl.SCANCODE_RSHIFT] != 0 ) {
+		if ( unicode.IsUpper(rc) ) {
+			return unicode.ToLower(rc)
+		}
+		return unicode.ToUpper(rc)
 	}
-	return nil
+	return rc
 }
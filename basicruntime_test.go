@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io"
+	"testing"
+)
+
+// parseLine scans and parses a line of code which has no line number
+func parseLine(b *testing.B, runtime *BasicRuntime, line string) *BasicASTLeaf {
+	var leaf *BasicASTLeaf = nil
+	var err error = nil
+
+	runtime.scanner.scanTokens(line)
+	if ( runtime.scanner.hasError ) {
+		b.Fatalf("Unable to scan %s", line)
+	}
+	leaf, err = runtime.parser.parse()
+	if ( err != nil ) {
+		b.Fatal(err)
+	}
+	return leaf
+}
+
+// BenchmarkEvaluate times the evaluate() loop on an assignment from an
+// arithmetic expression, the same work each pass through a FOR loop of a
+// BASIC program does.
+func BenchmarkEvaluate(b *testing.B) {
+	var runtime BasicRuntime
+	var frontend BasicConsoleFrontend = BasicConsoleFrontend{runtime: &runtime, output: io.Discard}
+	var leaf *BasicASTLeaf = nil
+	var err error = nil
+
+	runtime.init(&frontend)
+	_, err = runtime.evaluate(parseLine(b, &runtime, "I# = 12345"))
+	if ( err != nil ) {
+		b.Fatal(err)
+	}
+	leaf = parseLine(b, &runtime, "A# = A# + ((I# * 3) - (I# / 2)) / 7 - (I# * I#)")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		runtime.environment.zero()
+		_, err = runtime.evaluate(leaf)
+		if ( err != nil ) {
+			b.Fatal(err)
+		}
+	}
+}
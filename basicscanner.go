@@ -55,6 +55,7 @@ const (
 	FUNCTION_ARGUMENT // 38
 	ATSYMBOL // 39
 	IDENTIFIER_STRUCT // 40
+	SEMICOLON // 41
 )
 
 type BasicScanner struct {
@@ -92,7 +93,7 @@ func (self *BasicScanner) init(runtime *BasicRuntime) error {
 	}
 	if len(self.commands) == 0 {
 		self.commands = make(map[string]BasicTokenType)
-		// self.commands["APPEND"] =  COMMAND
+		self.commands["APPEND"] =  COMMAND_IMMEDIATE
 		// self.commands["ATN"] =  COMMAND
 		self.commands["AUTO"] =  COMMAND_IMMEDIATE
 		// self.commands["BACKUP"] =  COMMAND
@@ -101,51 +102,50 @@ func (self *BasicScanner) init(runtime *BasicRuntime) error {
 		// self.commands["BEND"] =  COMMAND
 		// self.commands["BLOAD"] =  COMMAND
 		// self.commands["BOOT"] =  COMMAND
-		// self.commands["BOX"] =  COMMAND
+		self.commands["BOX"] =  COMMAND
 		// self.commands["BSAVE"] =  COMMAND
 		// self.commands["CALLFN"] =  COMMAND
-		// self.commands["CATALOG"] =  COMMAND
-		// self.commands["CHAR"] =  COMMAND
-		// self.commands["CHARCIRCLE"] =  COMMAND
+		self.commands["CATALOG"] =  COMMAND_IMMEDIATE
+		self.commands["CHAR"] =  COMMAND
+		self.commands["CIRCLE"] =  COMMAND
 		// self.commands["CLOSE"] =  COMMAND
 		// self.commands["CLR"] =  COMMAND
 		// self.commands["CMD"] =  COMMAND
 		// self.commands["COLLECT"] =  COMMAND
-		// self.commands["COLLISION"] =  COMMAND
-		// self.commands["COLOR"] =  COMMAND
-		// self.commands["CONCAT"] =  COMMAND
+		self.commands["COLLISION"] =  COMMAND
+		self.commands["COLOR"] =  COMMAND
+		self.commands["CONCAT"] =  COMMAND_IMMEDIATE
 		// self.commands["CONT"] =  COMMAND
-		// self.commands["COPY"] =  COMMAND
+		self.commands["COPY"] =  COMMAND_IMMEDIATE
 		self.commands["DATA"] =  COMMAND
 		// self.commands["DCLEAR"] =  COMMAND
-		// self.commands["DCLOSE"] =  COMMAND
+		self.commands["DCLOSE"] =  COMMAND
 		self.commands["DEF"] =  COMMAND
 		self.commands["DELETE"] =  COMMAND_IMMEDIATE
 		self.commands["DIM"] =  COMMAND
-		// self.commands["DIRECTORY"] =  COMMAND
+		self.commands["DIRECTORY"] =  COMMAND_IMMEDIATE
 		self.commands["DLOAD"] =  COMMAND_IMMEDIATE
-		// self.commands["DO"] =  COMMAND
-		// self.commands["DOPEN"] =  COMMAND
-		// self.commands["DRAW"] =  COMMAND
+		self.commands["DO"] =  COMMAND
+		self.commands["DOPEN"] =  COMMAND
+		self.commands["DRAW"] =  COMMAND
 		self.commands["DSAVE"] =  COMMAND_IMMEDIATE
-		// self.commands["DVERIFY"] =  COMMAND
+		self.commands["DVERIFY"] =  COMMAND_IMMEDIATE
 		self.commands["ELSE"] =  COMMAND
 		// self.commands["END"] =  COMMAND
 		// self.commands["ENVELOPE"] =  COMMAND
-		// self.commands["ER"] =  COMMAND
-		// self.commands["ERR"] =  COMMAND
 		self.commands["EXIT"] =  COMMAND
 		// self.commands["FAST"] =  COMMAND
 		// self.commands["FETCH"] =  COMMAND
 		// self.commands["FILTER"] =  COMMAND
 		self.commands["FOR"] =  COMMAND
-		// self.commands["GET"] =  COMMAND
+		self.commands["GET"] =  COMMAND
 		// self.commands["GETIO"] =  COMMAND
-		// self.commands["GETKEY"] =  COMMAND
+		self.commands["GETKEY"] =  COMMAND
 		self.commands["GOSUB"] =  COMMAND
 		self.commands["GOTO"] =  COMMAND
-		// self.commands["GRAPHIC"] =  COMMAND
-		// self.commands["GSHAPE"] =  COMMAND
+		self.commands["GLOBAL"] =  COMMAND
+		self.commands["GRAPHIC"] =  COMMAND
+		self.commands["GSHAPE"] =  COMMAND
 		// self.commands["HEADER"] =  COMMAND
 		// self.commands["HELP"] =  COMMAND
 		self.commands["IF"] =  COMMAND
@@ -156,16 +156,17 @@ func (self *BasicScanner) init(runtime *BasicRuntime) error {
 		self.commands["LABEL"]= COMMAND
 		self.commands["LET"] =  COMMAND
 		self.commands["LIST"] =  COMMAND_IMMEDIATE
-		// self.commands["LOAD"] =  COMMAND
-		// self.commands["LOCATE"] =  COMMAND
-		// self.commands["LOOP"] =  COMMAND
+		self.commands["LOAD"] =  COMMAND_IMMEDIATE
+		self.commands["LOCATE"] =  COMMAND
+		self.commands["LOOP"] =  COMMAND
+		self.commands["MERGE"] =  COMMAND_IMMEDIATE
 		// self.commands["MONITOR"] =  COMMAND
-		// self.commands["MOVSPR"] =  COMMAND
+		self.commands["MOVSPR"] =  COMMAND
 		// self.commands["NEW"] =  COMMAND
 		self.commands["NEXT"] =  COMMAND
-		// self.commands["ON"] =  COMMAND
+		self.commands["ON"] =  COMMAND
 		// self.commands["OPENIO"] =  COMMAND
-		// self.commands["PAINT"] =  COMMAND
+		self.commands["PAINT"] =  COMMAND
 		// self.commands["PLAY"] =  COMMAND
 		self.commands["POKE"] =  COMMAND
 		self.commands["PRINT"] =  COMMAND
@@ -173,24 +174,25 @@ func (self *BasicScanner) init(runtime *BasicRuntime) error {
 		// self.commands["PUDEF"] =  COMMAND
 		self.commands["QUIT"] = COMMAND_IMMEDIATE
 		self.commands["READ"] =  COMMAND
-		// self.commands["RECORDIO"] =  COMMAND
-		// self.commands["RENAME"] =  COMMAND
-		// self.commands["RENUMBER"] =  COMMAND
-		// self.commands["RESTORE"] =  COMMAND
-		// self.commands["RESUME"] =  COMMAND
+		self.commands["RECORD"] =  COMMAND
+		self.commands["RENAME"] =  COMMAND_IMMEDIATE
+		self.commands["RENUMBER"] =  COMMAND_IMMEDIATE
+		self.commands["RESTORE"] =  COMMAND
+		self.commands["RESUME"] =  COMMAND
 		self.commands["RETURN"] =  COMMAND
 		self.commands["RUN"] =  COMMAND_IMMEDIATE
-		// self.commands["SAVE"] =  COMMAND
-		// self.commands["SCALE"] =  COMMAND
-		// self.commands["SCNCLR"] =  COMMAND
-		// self.commands["SCRATCH"] =  COMMAND
+		self.commands["SAVE"] =  COMMAND_IMMEDIATE
+		self.commands["SCALE"] =  COMMAND
+		self.commands["SCNCLR"] =  COMMAND
+		self.commands["SCRATCH"] =  COMMAND_IMMEDIATE
+		self.commands["SHARED"] =  COMMAND
 		// self.commands["SLEEP"] =  COMMAND
 		// self.commands["SOUND"] =  COMMAND
-		// self.commands["SPRCOLOR"] =  COMMAND
-		// self.commands["SPRDEF"] =  COMMAND
-		// self.commands["SPRITE"] =  COMMAND
-		// self.commands["SPRSAV"] =  COMMAND
-		// self.commands["SSHAPE"] =  COMMAND
+		self.commands["SPRCOLOR"] =  COMMAND
+		self.commands["SPRDEF"] =  COMMAND
+		self.commands["SPRITE"] =  COMMAND
+		self.commands["SPRSAV"] =  COMMAND
+		self.commands["SSHAPE"] =  COMMAND
 		// self.commands["STASH"] =  COMMAND
 		self.commands["STEP"] =  COMMAND
 		self.commands["STOP"] =  COMMAND
@@ -200,18 +202,18 @@ func (self *BasicScanner) init(runtime *BasicRuntime) error {
 		self.commands["THEN"] =  COMMAND
 		// self.commands["TI"] =  COMMAND
 		self.commands["TO"] =  COMMAND
-		// self.commands["TRAP"] =  COMMAND
+		self.commands["TRAP"] =  COMMAND
 		// self.commands["TROFF"] =  COMMAND
 		// self.commands["TRON"] =  COMMAND
-		// self.commands["UNTIL"] =  COMMAND
-		// self.commands["USING"] =  COMMAND
-		// self.commands["VERIFY"] =  COMMAND
+		self.commands["UNTIL"] =  COMMAND
+		self.commands["USING"] =  COMMAND
+		self.commands["VERIFY"] =  COMMAND_IMMEDIATE
 		// self.commands["VOL"] =  COMMAND
 		// self.commands["WAIT"] =  COMMAND
 		// self.commands["WAIT"] =  COMMAND
-		// self.commands["WHILE"] =  COMMAND
+		self.commands["WHILE"] =  COMMAND
 		// self.commands["WIDTH"] =  COMMAND
-		// self.commands["WINDOW"] =  COMMAND
+		self.commands["WINDOW"] =  COMMAND
 	}
 	if len(self.functions) == 0 {
 		self.functions = make(map[string]BasicTokenType)
@@ -220,10 +222,11 @@ func (self *BasicScanner) init(runtime *BasicRuntime) error {
 }
 
 func (self *BasicScanner) addToken(token BasicTokenType, lexeme string) {
-	self.runtime.environment.tokens[self.runtime.environment.nexttoken].tokentype = token
-	self.runtime.environment.tokens[self.runtime.environment.nexttoken].lineno = self.runtime.environment.lineno
-	self.runtime.environment.tokens[self.runtime.environment.nexttoken].lexeme = lexeme
-	
+	self.runtime.environment.tokens = append(self.runtime.environment.tokens, BasicToken{
+		tokentype: token,
+		lineno: self.runtime.environment.lineno,
+		position: self.start,
+		lexeme: lexeme})
 	//fmt.Printf("%+v\n", self.runtime.environment.tokens[self.runtime.environment.nexttoken])
 	self.runtime.environment.nexttoken += 1
 }
@@ -329,6 +332,10 @@ func (self *BasicScanner) matchNumber() {
 		if ( err != nil ) {
 			self.runtime.basicError(PARSE, fmt.Sprintf("INTEGER CONVERSION ON '%s'", self.getLexeme()))
 			self.hasError = true
+		} else if ( lineno > MAX_LINE_NUMBER ) {
+			self.runtime.basicError(LINE_NUMBER_TOO_LARGE, fmt.Sprintf("LINE NUMBER %d IS GREATER THAN %d", lineno, MAX_LINE_NUMBER))
+			self.hasError = true
+			return
 		}
 		self.runtime.environment.lineno = int64(lineno)
 		self.tokentype = LINE_NUMBER
@@ -362,6 +369,16 @@ func (self *BasicScanner) matchIdentifier() {
 		}
 	}
 	identifier = strings.ToUpper(self.getLexeme())
+	if ( self.tokentype == IDENTIFIER_INT ) {
+		// PRINT#, INPUT# and GET# are commands followed by a channel,
+		// leave the # to be scanned on its own
+		commandtype, cmdexists := self.commands[identifier[:len(identifier) - 1]]
+		if ( cmdexists ) {
+			self.current -= 1
+			self.tokentype = commandtype
+			return
+		}
+	}
 
 	// Look for reserved words (command and function names) in variable identifiers
 	reservedtype, resexists := self.reservedwords[identifier]
@@ -386,6 +403,57 @@ func (self *BasicScanner) matchIdentifier() {
 	}
 }
 
+// splitStatements breaks a line of source code up into the statements
+// separated by colons. Colons inside of string literals are not separators,
+// and neither is anything after a REM.
+func (self *BasicScanner) splitStatements(line string) []string {
+	var statements []string
+	var inString bool = false
+	var start int = 0
+	var i int
+
+	for i = 0; i < len(line); i++ {
+		if ( line[i] == '"' ) {
+			inString = !inString
+		} else if ( inString == true ) {
+			continue
+		} else if ( line[i] == ':' ) {
+			statements = append(statements, line[start:i])
+			start = i + 1
+		} else if ( self.isRemAt(line, i) ) {
+			break
+		}
+	}
+	return append(statements, line[start:])
+}
+
+func (self *BasicScanner) isRemAt(line string, i int) bool {
+	if ( len(line) < i + 3 || !strings.EqualFold(line[i:i+3], "REM") ) {
+		return false
+	}
+	return ( !self.isIdentifierChar(line, i - 1) && !self.isIdentifierChar(line, i + 3) )
+}
+
+func (self *BasicScanner) isElseStatement(statement string) bool {
+	return self.isCommandStatement(statement, "ELSE")
+}
+
+// isCommandStatement reports whether statement begins with command,
+// without needing to scan it
+func (self *BasicScanner) isCommandStatement(statement string, command string) bool {
+	statement = strings.TrimLeft(statement, " \t")
+	return ( len(statement) >= len(command) &&
+		strings.EqualFold(statement[0:len(command)], command) &&
+		!self.isIdentifierChar(statement, len(command)) )
+}
+
+func (self *BasicScanner) isIdentifierChar(line string, i int) bool {
+	if ( i < 0 || i >= len(line) ) {
+		return false
+	}
+	return ( unicode.IsLetter(rune(line[i])) || unicode.IsDigit(rune(line[i])) )
+}
+
 func (self *BasicScanner) scanTokens(line string) string {
 
 	var c rune
@@ -407,6 +475,9 @@ func (self *BasicScanner) scanTokens(line string) string {
 		case '/': self.tokentype = LEFT_SLASH
 		case '*': self.tokentype = STAR
 		case ',': self.tokentype = COMMA
+		case ':': self.tokentype = COLON
+		case ';': self.tokentype = SEMICOLON
+		case '#': self.tokentype = HASH
 		case '=': self.matchNextChar('=', EQUAL, ASSIGNMENT)
 		case '<':
 			if ( ! self.matchNextChar('=', LESS_THAN_EQUAL, LESS_THAN) ) {
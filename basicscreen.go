@@ -0,0 +1,334 @@
+package main
+
+import (
+	"strings"
+)
+
+const (
+	SCREEN_COLUMNS = 40
+	SCREEN_COLUMNS_80 = 80
+	// PEEK and POKE reach the character and colour of each cell of the
+	// screen at these addresses, as they would on a C128
+	SCREEN_MEMORY = 1024
+	COLOR_MEMORY = 55296
+
+	PETSCII_HOME = 0x13
+	PETSCII_CLEAR = 0x93
+	PETSCII_CURSOR_DOWN = 0x11
+	PETSCII_CURSOR_UP = 0x91
+	PETSCII_CURSOR_RIGHT = 0x1D
+	PETSCII_CURSOR_LEFT = 0x9D
+)
+
+// BasicTextWindow is the part of the screen which text is printed in and
+// scrolls. The edges are included in it.
+type BasicTextWindow struct {
+	left int
+	top int
+	right int
+	bottom int
+}
+
+// BasicScreen is the text screen: the character and colour in each cell,
+// the text cursor and the window set by WINDOW. Everything printed goes
+// here, and the frontend draws the window from it.
+type BasicScreen struct {
+	columns int
+	characters []rune
+	cellColors []byte
+	colors *[COLOR_SOURCES]int64
+	window BasicTextWindow
+	column int
+	row int
+	// A HOME straight after a HOME puts the window back to the whole screen
+	lastHome bool
+	// The rows which have changed since the frontend last drew them
+	dirtyRows []bool
+}
+
+func (self *BasicScreen) init(colors *[COLOR_SOURCES]int64) {
+	self.colors = colors
+	self.setColumns(SCREEN_COLUMNS)
+}
+
+// setColumns switches between the 40 and 80 column screens, clearing it
+func (self *BasicScreen) setColumns(columns int) {
+	self.columns = columns
+	self.characters = make([]rune, columns * TEXT_LINES)
+	self.cellColors = make([]byte, columns * TEXT_LINES)
+	self.dirtyRows = make([]bool, TEXT_LINES)
+	self.resetWindow()
+	self.clearWindow()
+}
+
+func (self *BasicScreen) resetWindow() {
+	self.window = BasicTextWindow{left: 0, top: 0, right: self.columns - 1, bottom: TEXT_LINES - 1}
+}
+
+// setWindow makes a part of the screen the window and moves the cursor
+// to its top left corner
+func (self *BasicScreen) setWindow(left int, top int, right int, bottom int) {
+	self.window = BasicTextWindow{left: left, top: top, right: right, bottom: bottom}
+	self.home()
+}
+
+func (self *BasicScreen) home() {
+	self.column = self.window.left
+	self.row = self.window.top
+}
+
+func (self *BasicScreen) clearWindow() {
+	var row int
+	for row = self.window.top; row <= self.window.bottom; row++ {
+		self.clearRow(row)
+	}
+	self.home()
+}
+
+func (self *BasicScreen) clearRow(row int) {
+	var column int
+	for column = self.window.left; column <= self.window.right; column++ {
+		self.put(column, row, ' ', self.colors[COLOR_SOURCE_CHARACTER])
+	}
+}
+
+// put sets the character and colour of a cell. Cells off the screen are
+// ignored.
+func (self *BasicScreen) put(column int, row int, character rune, color int64) {
+	if ( column < 0 || row < 0 || column >= self.columns || row >= TEXT_LINES ) {
+		return
+	}
+	self.characters[(row * self.columns) + column] = character
+	self.cellColors[(row * self.columns) + column] = byte(color)
+	self.dirtyRows[row] = true
+}
+
+// write puts text on the screen from a cell onwards without moving the
+// cursor, continuing on the next row at the edge of the screen. Colour
+// control characters change the colour of the text after them.
+func (self *BasicScreen) write(column int, row int, text string, color int64) {
+	var cell int = (row * self.columns) + column
+	var codeColor int64
+	var isColor bool
+
+	for _, c := range(text) {
+		codeColor, isColor = petsciiColorCodes[c]
+		if ( isColor ) {
+			color = codeColor
+			continue
+		}
+		if ( cell >= len(self.characters) ) {
+			return
+		}
+		self.put(cell % self.columns, cell / self.columns, c, color)
+		cell += 1
+	}
+}
+
+func (self *BasicScreen) cellColor(column int, row int) int64 {
+	return int64(self.cellColors[(row * self.columns) + column])
+}
+
+// print writes text at the cursor in the character colour. PETSCII
+// control characters change the colour, move the cursor or clear the
+// window instead of being printed.
+func (self *BasicScreen) print(text string) {
+	var color int64
+	var isColor bool
+
+	for _, c := range(text) {
+		color, isColor = petsciiColorCodes[c]
+		if ( c != PETSCII_HOME ) {
+			self.lastHome = false
+		}
+		switch {
+		case isColor:
+			self.colors[COLOR_SOURCE_CHARACTER] = color
+		case c == '\n':
+			self.newline()
+		case c == PETSCII_HOME:
+			if ( self.lastHome ) {
+				self.resetWindow()
+			}
+			self.home()
+			self.lastHome = true
+		case c == PETSCII_CLEAR:
+			self.clearWindow()
+		case c == PETSCII_CURSOR_DOWN:
+			self.cursorDown()
+		case c == PETSCII_CURSOR_UP:
+			self.row = max(self.row - 1, self.window.top)
+		case c == PETSCII_CURSOR_RIGHT:
+			self.cursorRight()
+		case c == PETSCII_CURSOR_LEFT:
+			self.cursorLeft()
+		default:
+			self.put(self.column, self.row, c, self.colors[COLOR_SOURCE_CHARACTER])
+			self.cursorRight()
+		}
+	}
+}
+
+// backspace moves the cursor back one cell and clears it
+func (self *BasicScreen) backspace() {
+	self.cursorLeft()
+	self.put(self.column, self.row, ' ', self.colors[COLOR_SOURCE_CHARACTER])
+}
+
+func (self *BasicScreen) newline() {
+	self.column = self.window.left
+	self.cursorDown()
+}
+
+func (self *BasicScreen) cursorDown() {
+	if ( self.row < self.window.bottom ) {
+		self.row += 1
+		return
+	}
+	self.scroll()
+}
+
+// cursorRight moves the cursor on, to the start of the next line at the
+// right edge of the window
+func (self *BasicScreen) cursorRight() {
+	if ( self.column < self.window.right ) {
+		self.column += 1
+		return
+	}
+	self.newline()
+}
+
+// cursorLeft moves the cursor back, to the end of the previous line at the
+// left edge of the window
+func (self *BasicScreen) cursorLeft() {
+	if ( self.column > self.window.left ) {
+		self.column -= 1
+	} else if ( self.row > self.window.top ) {
+		self.column = self.window.right
+		self.row -= 1
+	}
+}
+
+// scroll moves the text in the window up a line. The rest of the screen
+// doesn't move.
+func (self *BasicScreen) scroll() {
+	var row int
+	var start int
+	var width int = self.window.right - self.window.left + 1
+
+	for row = self.window.top; row < self.window.bottom; row++ {
+		start = (row * self.columns) + self.window.left
+		copy(self.characters[start:start + width], self.characters[start + self.columns:start + self.columns + width])
+		copy(self.cellColors[start:start + width], self.cellColors[start + self.columns:start + self.columns + width])
+		self.dirtyRows[row] = true
+	}
+	self.clearRow(self.window.bottom)
+}
+
+// cursorColumn returns the column of the cursor in the window
+func (self *BasicScreen) cursorColumn() int {
+	return self.column - self.window.left
+}
+
+// cursorRow returns the row of the cursor in the window
+func (self *BasicScreen) cursorRow() int {
+	return self.row - self.window.top
+}
+
+// peek returns the screen code or colour at a screen memory address, and
+// false if the address isn't screen memory
+func (self *BasicScreen) peek(address int64) (byte, bool) {
+	var cells int64 = int64(len(self.characters))
+	if ( address >= SCREEN_MEMORY && address < SCREEN_MEMORY + cells ) {
+		return screenCode(self.characters[address - SCREEN_MEMORY]), true
+	}
+	if ( address >= COLOR_MEMORY && address < COLOR_MEMORY + cells ) {
+		// Colour memory holds colours from 0, not 1
+		return self.cellColors[address - COLOR_MEMORY] - 1, true
+	}
+	return 0, false
+}
+
+// poke sets the screen code or colour at a screen memory address. It
+// returns false if the address isn't screen memory.
+func (self *BasicScreen) poke(address int64, value byte) bool {
+	var cells int64 = int64(len(self.characters))
+	var cell int
+	if ( address >= SCREEN_MEMORY && address < SCREEN_MEMORY + cells ) {
+		cell = int(address - SCREEN_MEMORY)
+		self.characters[cell] = screenRune(value)
+	} else if ( address >= COLOR_MEMORY && address < COLOR_MEMORY + cells ) {
+		cell = int(address - COLOR_MEMORY)
+		self.cellColors[cell] = (value % COLORS) + 1
+	} else {
+		return false
+	}
+	self.dirtyRows[cell / self.columns] = true
+	return true
+}
+
+func isControlCode(c rune) bool {
+	switch ( c ) {
+	case PETSCII_HOME, PETSCII_CLEAR, PETSCII_CURSOR_DOWN, PETSCII_CURSOR_UP, PETSCII_CURSOR_RIGHT, PETSCII_CURSOR_LEFT:
+		return true
+	}
+	return isColorCode(c)
+}
+
+// stripControlCodes returns text without the control characters which
+// change colour or move the cursor, for output which is only a stream of
+// text. The result is always UTF-8.
+func stripControlCodes(text string) string {
+	var stripped strings.Builder
+	for _, c := range(text) {
+		if ( !isControlCode(c) ) {
+			stripped.WriteRune(c)
+		}
+	}
+	return stripped.String()
+}
+
+// screenCode returns the Commodore screen code of a character. Lower case
+// letters have the same codes as upper case ones.
+func screenCode(c rune) byte {
+	var i int
+	switch {
+	case c == '@': return 0
+	case c >= 'A' && c <= 'Z': return byte(c - 'A' + 1)
+	case c >= 'a' && c <= 'z': return byte(c - 'a' + 1)
+	case c == '[': return 27
+	case c == '£': return 28
+	case c == ']': return 29
+	case c == '↑': return 30
+	case c == '←': return 31
+	case c >= ' ' && c <= '?': return byte(c)
+	}
+	for i = 0; i < len(petsciiGraphics); i++ {
+		if ( petsciiGraphics[i] != c ) {
+			continue
+		}
+		if ( i >= 32 ) {
+			return byte(64 + i - 32)
+		}
+		return byte(96 + i)
+	}
+	return ' '
+}
+
+// screenRune returns the character for a Commodore screen code. Reversed
+// characters (128 and above) are shown as they are without reversing.
+func screenRune(code byte) rune {
+	code = code % 128
+	switch {
+	case code == 0: return '@'
+	case code <= 26: return rune('A' + code - 1)
+	case code == 27: return '['
+	case code == 28: return '£'
+	case code == 29: return ']'
+	case code == 30: return '↑'
+	case code == 31: return '←'
+	case code < 64: return rune(code)
+	case code < 96: return petsciiGraphics[32 + code - 64]
+	}
+	return petsciiGraphics[code - 96]
+}
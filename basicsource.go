@@ -0,0 +1,102 @@
+package main
+
+import (
+	"slices"
+)
+
+type BasicSourceLine struct {
+	code string
+	lineno int64
+}
+
+// BasicSource holds the lines of the program in memory. Only lines that
+// exist are stored, and the line numbers are kept sorted so that RUN
+// and LIST can step straight from one line to the next.
+type BasicSource struct {
+	lines map[int64]BasicSourceLine
+	order []int64
+}
+
+func (self *BasicSource) init() {
+	self.lines = make(map[int64]BasicSourceLine)
+	self.order = nil
+}
+
+// set stores code as line lineno, replacing any line that is already
+// there. Setting a line to "" removes it.
+func (self *BasicSource) set(lineno int64, code string) {
+	var idx int
+	var found bool
+
+	if ( len(code) == 0 ) {
+		self.remove(lineno)
+		return
+	}
+	idx, found = slices.BinarySearch(self.order, lineno)
+	if ( !found ) {
+		self.order = slices.Insert(self.order, idx, lineno)
+	}
+	self.lines[lineno] = BasicSourceLine{
+		code: code,
+		lineno: lineno}
+}
+
+func (self *BasicSource) remove(lineno int64) {
+	var idx int
+	var found bool
+
+	idx, found = slices.BinarySearch(self.order, lineno)
+	if ( found ) {
+		self.order = slices.Delete(self.order, idx, idx + 1)
+		delete(self.lines, lineno)
+	}
+}
+
+// get returns the code for line lineno, or "" if there is no such line
+func (self *BasicSource) get(lineno int64) string {
+	return self.lines[lineno].code
+}
+
+// next returns the first line number that is >= lineno
+func (self *BasicSource) next(lineno int64) (int64, bool) {
+	var idx int
+
+	idx, _ = slices.BinarySearch(self.order, lineno)
+	if ( idx >= len(self.order) ) {
+		return 0, false
+	}
+	return self.order[idx], true
+}
+
+// previous returns the last line number that is < lineno
+func (self *BasicSource) previous(lineno int64) (int64, bool) {
+	var idx int
+
+	idx, _ = slices.BinarySearch(self.order, lineno)
+	if ( idx == 0 ) {
+		return 0, false
+	}
+	return self.order[idx - 1], true
+}
+
+// between returns the lines numbered from startidx to endidx inclusive,
+// in order. The result is a copy, so lines may be changed or removed
+// while ranging over it.
+func (self *BasicSource) between(startidx int64, endidx int64) []BasicSourceLine {
+	var result []BasicSourceLine
+	var idx int
+
+	idx, _ = slices.BinarySearch(self.order, startidx)
+	for ; idx < len(self.order) && self.order[idx] <= endidx; idx++ {
+		result = append(result, self.lines[self.order[idx]])
+	}
+	return result
+}
+
+func (self *BasicSource) all() []BasicSourceLine {
+	return self.between(0, MAX_LINE_NUMBER)
+}
+
+func (self *BasicSource) clear() {
+	self.init()
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	SPRITES = 8
+	SPRITE_WIDTH = 24
+	SPRITE_HEIGHT = 21
+	SPRITE_BYTES = 63
+	// Sprite positions are in the C128's sprite coordinates, which have
+	// the top left corner of the screen at 24, 50. They wrap around at
+	// SPRITE_MAX_X and SPRITE_MAX_Y.
+	SPRITE_SCREEN_X = 24
+	SPRITE_SCREEN_Y = 50
+	SPRITE_MAX_X = 512
+	SPRITE_MAX_Y = 256
+	// Sprites with a speed move this many times a second
+	SPRITE_FRAME_RATE = 60
+	SPRITE_MAX_SPEED = 15
+
+	// The types of collision that COLLISION and BUMP work with. Light pens
+	// are accepted but never collide with anything.
+	COLLISION_SPRITE = 1
+	COLLISION_BACKGROUND = 2
+	COLLISION_LIGHT_PEN = 3
+	COLLISION_TYPES = 3
+
+	// The ways MOVSPR can move a sprite
+	MOVSPR_ABSOLUTE = "ABSOLUTE"
+	MOVSPR_RELATIVE = "RELATIVE"
+	MOVSPR_RELATIVE_X = "RELATIVE X"
+	MOVSPR_RELATIVE_Y = "RELATIVE Y"
+	MOVSPR_POLAR = "POLAR"
+	MOVSPR_VELOCITY = "VELOCITY"
+)
+
+type BasicSprite struct {
+	enabled bool
+	color int64
+	// Sprites with priority are drawn behind the text and the bitmap
+	behind bool
+	expandX bool
+	expandY bool
+	multicolor bool
+	// 21 rows of 3 bytes, with the leftmost pixel in the highest bit
+	data [SPRITE_BYTES]byte
+	x float64
+	y float64
+	// Set by MOVSPR with an angle and a speed
+	angle float64
+	speed float64
+}
+
+// BasicSprites are the eight sprites, which are drawn on top of the text
+// screen and the bitmap.
+type BasicSprites struct {
+	sprites [SPRITES]BasicSprite
+	// The colours of the multicolour sprites' other two colours, set by
+	// SPRCOLOR
+	multicolor1 int64
+	multicolor2 int64
+	screen *BasicScreen
+	bitmap *BasicBitmap
+	lastFrame time.Time
+	// Something has changed since collisions were last looked for
+	changed bool
+	// Something has changed since the frontend last drew the sprites
+	dirty bool
+	// The sprites colliding in the last update, and the ones that have
+	// collided since BUMP last read them, as a bit for each sprite
+	colliding [COLLISION_TYPES]int64
+	bumps [COLLISION_TYPES]int64
+	// The lines COLLISION GOSUBs to, and the environment of the GOSUB
+	// in progress
+	collisionLines [COLLISION_TYPES]int64
+	collisionEnvironment *BasicEnvironment
+}
+
+func (self *BasicSprites) init(screen *BasicScreen, bitmap *BasicBitmap) {
+	var i int
+	self.screen = screen
+	self.bitmap = bitmap
+	for i = 0; i < SPRITES; i++ {
+		self.sprites[i] = BasicSprite{color: int64(COLOR_WHITE + i)}
+	}
+	self.multicolor1 = COLOR_RED
+	self.multicolor2 = COLOR_CYAN
+	self.lastFrame = time.Now()
+	self.changed = true
+	self.dirty = true
+}
+
+// sprite returns sprite n, counting from 1 as BASIC does
+func (self *BasicSprites) sprite(n int64) *BasicSprite {
+	return &self.sprites[n - 1]
+}
+
+// move puts a sprite at a position, wrapping it around the edges of the
+// sprite coordinates
+func (self *BasicSprites) move(sprite *BasicSprite, x float64, y float64) {
+	sprite.x = math.Mod(math.Mod(x, SPRITE_MAX_X) + SPRITE_MAX_X, SPRITE_MAX_X)
+	sprite.y = math.Mod(math.Mod(y, SPRITE_MAX_Y) + SPRITE_MAX_Y, SPRITE_MAX_Y)
+	self.changed = true
+	self.dirty = true
+}
+
+// moveBy moves a sprite distance pixels towards angle. 0 degrees is up and
+// angles go clockwise.
+func (self *BasicSprites) moveBy(sprite *BasicSprite, distance float64, angle float64) {
+	var radians float64 = angle * math.Pi / 180
+	// Rounded so that moves along the axes land on whole pixels
+	var dx float64 = math.Round(distance * math.Sin(radians) * 1e6) / 1e6
+	var dy float64 = math.Round(distance * math.Cos(radians) * 1e6) / 1e6
+	self.move(sprite, sprite.x + dx, sprite.y - dy)
+}
+
+// update moves the sprites which have a speed by the number of frames
+// since the last update, and looks for collisions if anything has
+// changed. It returns the sprites which have started colliding.
+func (self *BasicSprites) update() [COLLISION_TYPES]int64 {
+	var started [COLLISION_TYPES]int64
+	var colliding [COLLISION_TYPES]int64
+	var frameLength time.Duration = time.Second / SPRITE_FRAME_RATE
+	var frames int64
+	var i int
+
+	frames = int64(time.Since(self.lastFrame) / frameLength)
+	if ( frames > 0 ) {
+		self.lastFrame = self.lastFrame.Add(time.Duration(frames) * frameLength)
+		for i = 0; i < SPRITES; i++ {
+			if ( self.sprites[i].speed > 0 ) {
+				self.moveBy(&self.sprites[i], self.sprites[i].speed * float64(frames), self.sprites[i].angle)
+			}
+		}
+		// The screen behind the sprites may have changed
+		self.changed = true
+	}
+	if ( !self.changed ) {
+		return started
+	}
+	self.changed = false
+	colliding = self.collisions()
+	for i = 0; i < COLLISION_TYPES; i++ {
+		started[i] = colliding[i] &^ self.colliding[i]
+		self.bumps[i] |= colliding[i]
+	}
+	self.colliding = colliding
+	return started
+}
+
+// bump returns the sprites which have collided since the last bump, and
+// forgets them
+func (self *BasicSprites) bump(collisionType int64) int64 {
+	var bumps int64 = self.bumps[collisionType - 1]
+	self.bumps[collisionType - 1] = 0
+	return bumps
+}
+
+// collisions returns a bit for each sprite which is touching another
+// sprite, and for each one touching the text or the bitmap
+func (self *BasicSprites) collisions() [COLLISION_TYPES]int64 {
+	var colliding [COLLISION_TYPES]int64
+	var i int
+	var j int
+	var x int
+	var y int
+	var left int
+	var top int
+	var right int
+	var bottom int
+
+	for i = 0; i < SPRITES; i++ {
+		if ( !self.sprites[i].enabled ) {
+			continue
+		}
+		left, top, right, bottom = self.bounds(i)
+		for y = top; y < bottom; y++ {
+			for x = left; x < right; x++ {
+				if ( self.spritePixel(i, x, y) == 0 ) {
+					continue
+				}
+				if ( self.foreground(x - SPRITE_SCREEN_X, y - SPRITE_SCREEN_Y) ) {
+					colliding[COLLISION_BACKGROUND - 1] |= 1 << i
+				}
+				for j = i + 1; j < SPRITES; j++ {
+					if ( self.sprites[j].enabled && self.spritePixel(j, x, y) != 0 ) {
+						colliding[COLLISION_SPRITE - 1] |= (1 << i) | (1 << j)
+					}
+				}
+			}
+		}
+	}
+	return colliding
+}
+
+// bounds returns the sprite coordinates that a sprite covers, from left,
+// top up to but not including right, bottom
+func (self *BasicSprites) bounds(n int) (int, int, int, int) {
+	var sprite *BasicSprite = &self.sprites[n]
+	var width int = SPRITE_WIDTH
+	var height int = SPRITE_HEIGHT
+	if ( sprite.expandX ) {
+		width *= 2
+	}
+	if ( sprite.expandY ) {
+		height *= 2
+	}
+	return int(sprite.x), int(sprite.y), int(sprite.x) + width, int(sprite.y) + height
+}
+
+// spritePixel returns the colour of sprite n at a point in sprite
+// coordinates, or 0 where it is transparent
+func (self *BasicSprites) spritePixel(n int, x int, y int) int64 {
+	var sprite *BasicSprite = &self.sprites[n]
+	var left int
+	var top int
+	var right int
+	var bottom int
+	var bit int
+
+	left, top, right, bottom = self.bounds(n)
+	if ( x < left || y < top || x >= right || y >= bottom ) {
+		return 0
+	}
+	x -= left
+	y -= top
+	if ( sprite.expandX ) {
+		x /= 2
+	}
+	if ( sprite.expandY ) {
+		y /= 2
+	}
+	if ( !sprite.multicolor ) {
+		if ( sprite.data[(y * 3) + (x / 8)] & (0x80 >> (x % 8)) == 0 ) {
+			return 0
+		}
+		return sprite.color
+	}
+	// Multicolour pixels are two bits wide
+	x -= x % 2
+	bit = (int(sprite.data[(y * 3) + (x / 8)]) >> (6 - (x % 8))) & 3
+	switch ( bit ) {
+	case 1: return self.multicolor1
+	case 2: return sprite.color
+	case 3: return self.multicolor2
+	}
+	return 0
+}
+
+// color returns the colour of the sprites at a pixel of the screen, or 0
+// if there isn't a sprite there. Lower numbered sprites are in front of
+// higher numbered ones.
+func (self *BasicSprites) color(x int, y int) int64 {
+	var color int64
+	var i int
+
+	for i = 0; i < SPRITES; i++ {
+		if ( !self.sprites[i].enabled ) {
+			continue
+		}
+		color = self.spritePixel(i, x + SPRITE_SCREEN_X, y + SPRITE_SCREEN_Y)
+		if ( color == 0 ) {
+			continue
+		}
+		if ( self.sprites[i].behind && self.foreground(x, y) ) {
+			return 0
+		}
+		return color
+	}
+	return 0
+}
+
+// visible returns true if any sprite is turned on
+func (self *BasicSprites) visible() bool {
+	for i := range(self.sprites) {
+		if ( self.sprites[i].enabled ) {
+			return true
+		}
+	}
+	return false
+}
+
+// foreground returns true if a pixel of the screen shows something other
+// than the background: a pixel of the bitmap drawn in a colour source
+// other than the background, or a character other than a space.
+func (self *BasicSprites) foreground(x int, y int) bool {
+	var column int
+	var row int
+
+	if ( x < 0 || y < 0 || x >= BITMAP_WIDTH || y >= BITMAP_HEIGHT ) {
+		return false
+	}
+	if ( self.bitmap.visible() && self.bitmap.allocated &&
+		( !self.bitmap.split() || int64(y) < self.bitmap.splitLine * (BITMAP_HEIGHT / TEXT_LINES) ) ) {
+		return self.bitmap.pixels[(y * BITMAP_WIDTH) + x] != COLOR_SOURCE_BACKGROUND
+	}
+	column = x * self.screen.columns / BITMAP_WIDTH
+	row = y / (BITMAP_HEIGHT / TEXT_LINES)
+	return self.screen.characters[(row * self.screen.columns) + column] != ' '
+}
+
+// shape returns a sprite's pixels in the same form as SSHAPE: each row of
+// pixels, followed by the width and height less one, low byte first
+func (self *BasicSprites) shape(sprite *BasicSprite) string {
+	var shape []byte = make([]byte, 0, SPRITE_BYTES + 4)
+	shape = append(shape, sprite.data[:]...)
+	shape = append(shape, SPRITE_WIDTH - 1, 0, SPRITE_HEIGHT - 1, 0)
+	return bytesString(shape)
+}
+
+// setShape sets a sprite's pixels from a string made by SSHAPE or SPRSAV.
+// The part of a bigger shape outside of the sprite is left out. It
+// returns false if the string isn't a shape.
+func (self *BasicSprites) setShape(sprite *BasicSprite, text string) bool {
+	var shape []byte
+	var isShape bool
+	var width int = SPRITE_WIDTH
+	var height int = SPRITE_HEIGHT
+	var rowBytes int
+	var row int
+	var column int
+	var offset int
+
+	shape, isShape = stringBytes(text)
+	if ( !isShape ) {
+		return false
+	}
+	sprite.data = [SPRITE_BYTES]byte{}
+	if ( len(shape) >= 4 ) {
+		width = int(shape[len(shape) - 4]) + (int(shape[len(shape) - 3]) << 8) + 1
+		height = int(shape[len(shape) - 2]) + (int(shape[len(shape) - 1]) << 8) + 1
+		shape = shape[:len(shape) - 4]
+	}
+	rowBytes = (width + 7) / 8
+	for row = 0; row < min(height, SPRITE_HEIGHT); row++ {
+		for column = 0; column < min(rowBytes, SPRITE_WIDTH / 8); column++ {
+			offset = (row * rowBytes) + column
+			if ( offset < len(shape) ) {
+				sprite.data[(row * 3) + column] = shape[offset]
+			}
+		}
+	}
+	self.changed = true
+	self.dirty = true
+	return true
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Programs written by SAVE start with this, followed by the version of the
+// format. Each line after that is its line number (2 bytes, low byte
+// first), the code with its keywords turned into tokens, and a 0.
+const (
+	TOKENIZED_MAGIC = "AKBASIC"
+	TOKENIZED_VERSION = 1
+	// Keywords are single bytes from TOKEN_FIRST up to TOKEN_EXTENDED. The
+	// rest are TOKEN_EXTENDED followed by a second byte. Any other byte of
+	// 0x80 or more in the code is written after TOKEN_ESCAPE.
+	TOKEN_FIRST = 0x80
+	TOKEN_EXTENDED = 0xFE
+	TOKEN_ESCAPE = 0xFF
+)
+
+// The token for a keyword is its index in this list. Only add new keywords
+// to the end, or programs which have already been saved will change.
+var tokenizedKeywords = []string{
+	"REM", "AND", "OR", "NOT",
+	"APPEND", "AUTO", "BACKUP", "BANK", "BEGIN", "BEND", "BLOAD", "BOOT",
+	"BOX", "BSAVE", "CALLFN", "CATALOG", "CHAR", "CIRCLE", "CLOSE", "CLR",
+	"CMD", "COLLECT", "COLLISION", "COLOR", "CONCAT", "CONT", "COPY", "DATA",
+	"DCLEAR", "DCLOSE", "DEF", "DELETE", "DIM", "DIRECTORY", "DLOAD", "DO",
+	"DOPEN", "DRAW", "DSAVE", "DVERIFY", "ELSE", "END", "ENVELOPE", "EXIT",
+	"FAST", "FETCH", "FILTER", "FOR", "GET", "GETKEY", "GLOBAL", "GOSUB",
+	"GOTO", "GRAPHIC", "GSHAPE", "HEADER", "HELP", "IF", "INPUT", "KEY",
+	"LABEL", "LET", "LIST", "LOAD", "LOCATE", "LOOP", "MONITOR", "MOVSPR",
+	"NEW", "NEXT", "ON", "OPEN", "PAINT", "PLAY", "POKE", "PRINT",
+	"PUDEF", "QUIT", "READ", "RECORD", "RENAME", "RENUMBER", "RESTORE", "RESUME",
+	"RETURN", "RUN", "SAVE", "SCALE", "SCNCLR", "SCRATCH", "SHARED", "SLEEP",
+	"SOUND", "SPRCOLOR", "SPRDEF", "SPRITE", "SPRSAV", "SSHAPE", "STASH", "STEP",
+	"STOP", "SWAP", "SYS", "TEMPO", "THEN", "TI", "TO", "TRAP",
+	"TROFF", "TRON", "UNTIL", "USING", "VERIFY", "VOL", "WAIT", "WHILE",
+	"WIDTH", "WINDOW",
+	"ABS", "ATN", "CHR", "COS", "EL", "ER", "ERR", "HEX",
+	"INSTR", "LEFT", "LEN", "LOG", "MID", "MOD", "PEEK", "POINTER",
+	"POINTERVAR", "RAD", "RIGHT", "SGN", "SHL", "SHR", "SIN", "SPC",
+	"ST", "STR", "TAB", "TAN", "VAL", "XOR",
+	"MERGE", "RDOT", "RGR", "RCLR", "RWINDOW", "BUMP", "RSPPOS", "ASC",
+}
+
+func isTokenizedProgram(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(TOKENIZED_MAGIC))
+}
+
+func isKeywordCharacter(c byte) bool {
+	return ( (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') )
+}
+
+// keywordAt returns the index of the longest keyword which starts at
+// code[i] as a whole word, or -1 if there isn't one. Only upper case
+// keywords are tokenized, so that the case of the code is kept.
+func keywordAt(code string, i int) int {
+	var best int = -1
+	var end int
+
+	if ( i > 0 && isKeywordCharacter(code[i - 1]) ) {
+		return -1
+	}
+	for idx, keyword := range(tokenizedKeywords) {
+		end = i + len(keyword)
+		if ( end > len(code) || code[i:end] != keyword ) {
+			continue
+		}
+		if ( end < len(code) && isKeywordCharacter(code[end]) ) {
+			continue
+		}
+		if ( best < 0 || len(keyword) > len(tokenizedKeywords[best]) ) {
+			best = idx
+		}
+	}
+	return best
+}
+
+func tokenizeLine(code string, buffer *bytes.Buffer) {
+	var inString bool = false
+	var inComment bool = false
+	var keyword int
+	var i int = 0
+
+	for ( i < len(code) ) {
+		if ( inComment ) {
+			// Comments are kept as they are
+		} else if ( code[i] == '"' ) {
+			inString = !inString
+		} else if ( !inString ) {
+			keyword = keywordAt(code, i)
+			if ( keyword >= 0 ) {
+				if ( keyword < (TOKEN_EXTENDED - TOKEN_FIRST) ) {
+					buffer.WriteByte(byte(TOKEN_FIRST + keyword))
+				} else {
+					buffer.WriteByte(TOKEN_EXTENDED)
+					buffer.WriteByte(byte(keyword - (TOKEN_EXTENDED - TOKEN_FIRST) + 1))
+				}
+				i += len(tokenizedKeywords[keyword])
+				inComment = ( tokenizedKeywords[keyword] == "REM" )
+				continue
+			}
+		}
+		if ( code[i] >= TOKEN_FIRST ) {
+			buffer.WriteByte(TOKEN_ESCAPE)
+		}
+		buffer.WriteByte(code[i])
+		i += 1
+	}
+	buffer.WriteByte(0)
+}
+
+// tokenize returns the program in the format written by SAVE
+func (self *BasicSource) tokenize() []byte {
+	var buffer bytes.Buffer
+
+	buffer.WriteString(TOKENIZED_MAGIC)
+	buffer.WriteByte(TOKENIZED_VERSION)
+	for _, sourceline := range(self.all()) {
+		buffer.WriteByte(byte(sourceline.lineno & 0xFF))
+		buffer.WriteByte(byte(sourceline.lineno >> 8))
+		tokenizeLine(sourceline.code, &buffer)
+	}
+	return buffer.Bytes()
+}
+
+// text returns the program in the format written by DSAVE
+func (self *BasicSource) text() []byte {
+	var buffer bytes.Buffer
+
+	for _, sourceline := range(self.all()) {
+		buffer.WriteString(fmt.Sprintf("%d %s\n", sourceline.lineno, sourceline.code))
+	}
+	return buffer.Bytes()
+}
+
+// detokenizeProgram returns the lines of the program in data, which was
+// written by SAVE
+func detokenizeProgram(data []byte) ([]BasicSourceLine, error) {
+	var lines []BasicSourceLine
+	var code bytes.Buffer
+	var lineno int64
+	var keyword int
+	var i int
+
+	if ( !isTokenizedProgram(data) || len(data) <= len(TOKENIZED_MAGIC) ) {
+		return nil, newBasicRuntimeError(LOAD, "Not a tokenized program")
+	}
+	if ( data[len(TOKENIZED_MAGIC)] > TOKENIZED_VERSION ) {
+		return nil, newBasicRuntimeError(LOAD, "Tokenized program version %d is newer than %d", data[len(TOKENIZED_MAGIC)], TOKENIZED_VERSION)
+	}
+	i = len(TOKENIZED_MAGIC) + 1
+	for ( i < len(data) ) {
+		if ( i + 2 > len(data) ) {
+			return nil, newBasicRuntimeError(LOAD, "Tokenized program is truncated")
+		}
+		lineno = int64(data[i]) | (int64(data[i + 1]) << 8)
+		i += 2
+		code.Reset()
+		for ( i < len(data) && data[i] != 0 ) {
+			if ( data[i] == TOKEN_ESCAPE || data[i] == TOKEN_EXTENDED ) {
+				if ( i + 1 >= len(data) ) {
+					return nil, newBasicRuntimeError(LOAD, "Tokenized program is truncated")
+				}
+			}
+			switch ( data[i] ) {
+			case TOKEN_ESCAPE:
+				code.WriteByte(data[i + 1])
+				i += 2
+				continue
+			case TOKEN_EXTENDED:
+				keyword = int(data[i + 1]) - 1 + (TOKEN_EXTENDED - TOKEN_FIRST)
+				i += 2
+			default:
+				if ( data[i] < TOKEN_FIRST ) {
+					code.WriteByte(data[i])
+					i += 1
+					continue
+				}
+				keyword = int(data[i]) - TOKEN_FIRST
+				i += 1
+			}
+			if ( keyword >= len(tokenizedKeywords) ) {
+				return nil, newBasicRuntimeError(LOAD, "Unknown token in line %d", lineno)
+			}
+			code.WriteString(tokenizedKeywords[keyword])
+		}
+		if ( i >= len(data) ) {
+			return nil, newBasicRuntimeError(LOAD, "Tokenized program is truncated")
+		}
+		i += 1
+		lines = append(lines, BasicSourceLine{
+			code: code.String(),
+			lineno: lineno})
+	}
+	return lines, nil
+}
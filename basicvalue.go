@@ -18,6 +18,8 @@ const (
 type BasicValue struct {
 	name string
 	valuetype BasicType
+	// UTF-8. Binary data, such as the shapes SSHAPE makes, is one
+	// character per byte. See bytesString.
 	stringval string
 	intval int64
 	floatval float64
@@ -26,6 +28,38 @@ type BasicValue struct {
 	mutable bool
 }
 
+// Strings are UTF-8, and each of their characters is a code point: CHR
+// makes the character with a code and ASC gives it back, and LEN, LEFT,
+// MID and RIGHT count characters. Binary data such as a shape is kept as
+// one character from 0 to 255 for each byte.
+
+// characterString returns the string for the character with code c
+func characterString(c rune) string {
+	return string(c)
+}
+
+// bytesString returns the string with one character for each byte of data
+func bytesString(data []byte) string {
+	var text strings.Builder
+	for _, b := range(data) {
+		text.WriteRune(rune(b))
+	}
+	return text.String()
+}
+
+// stringBytes returns the bytes held by a string made by bytesString. It
+// returns false if a character doesn't fit in a byte.
+func stringBytes(text string) ([]byte, bool) {
+	var data []byte
+	for _, c := range(text) {
+		if ( c > 0xFF ) {
+			return nil, false
+		}
+		data = append(data, byte(c))
+	}
+	return data, true
+}
+
 func (self *BasicValue) init() {
 }
 
@@ -236,8 +270,14 @@ func (self *BasicValue) mathDivide(rval *BasicValue) (*BasicValue, error) {
 		return nil, errors.New("Cannot perform division on strings")
 	}
 	if ( self.valuetype == TYPE_INTEGER ) {
+		if ( (rval.intval + int64(rval.floatval)) == 0 ) {
+			return nil, newBasicRuntimeError(DIVISION_BY_ZERO, "Division by zero")
+		}
 		dest.intval = self.intval / (rval.intval + int64(rval.floatval))
 	} else {
+		if ( (rval.floatval + float64(rval.intval)) == 0 ) {
+			return nil, newBasicRuntimeError(DIVISION_BY_ZERO, "Division by zero")
+		}
 		dest.floatval = self.floatval / (rval.floatval + float64(rval.intval))
 	}
 	return dest, nil
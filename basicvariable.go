@@ -164,7 +164,7 @@ func (self *BasicVariable) flattenIndexSubscripts(subscripts []int64) (int64, er
 
 	for i = len(subscripts) - 1; i >= 0 ; i-- {
 		if ( subscripts[i] < 0 || subscripts[i] >= self.dimensions[i] ) {
-			return 0, fmt.Errorf("Variable index access out of bounds at dimension %d: %d (max %d)", i, subscripts[i], self.dimensions[i]-1)
+			return 0, newBasicRuntimeError(BAD_SUBSCRIPT, "Variable index access out of bounds at dimension %d: %d (max %d)", i, subscripts[i], self.dimensions[i]-1)
 		}
 		flatIndex += subscripts[i] * multiplier
 		multiplier *= self.dimensions[i]
@@ -2,27 +2,36 @@ package main
 
 import (
 	"os"
-	//"fmt"
+	"fmt"
+	"flag"
 	//"strings"
 	//"unsafe"
-	"io"
-	"github.com/veandco/go-sdl2/sdl"
-	"github.com/veandco/go-sdl2/ttf"
 )
 
 const (
-	// These values are per-environment. Leaves, tokens and values are static allocated.
-	MAX_LEAVES = 32
-	MAX_TOKENS = 32
-	MAX_VALUES = 64
-	MAX_VARIABLES = 128
+	// Leaves and values are allocated in blocks of these sizes as they
+	// are needed. There is no limit on how many of them a line uses.
+	LEAF_BLOCK_SIZE = 32
+	VALUE_BLOCK_SIZE = 64
 
 	// These values apply to the entire runtime
-	MAX_SOURCE_LINES = 9999
+	// The highest line number a program may use
+	MAX_LINE_NUMBER = 63999
 	MAX_LINE_LENGTH = 256
 	MAX_ARRAY_DEPTH = 64
+	// A comma in PRINT moves to the start of the next zone this wide
+	PRINT_ZONE_WIDTH = 10
+	// How deeply user defined functions and subroutines may call each
+	// other before raising a STACK OVERFLOW error. Can be changed with -maxdepth.
+	DEFAULT_MAX_CALL_DEPTH = 512
+	// The environment variable which sets the drive directory when
+	// -drive isn't given
+	DRIVE_ENVIRONMENT_VARIABLE = "BASIC_DRIVE"
 	BASIC_TRUE = -1
 	BASIC_FALSE = 0
+	// How long the window waits for keyboard events before checking
+	// on anything else, in milliseconds
+	EVENT_WAIT_MS = 20
 	MODE_REPL = 1
 	MODE_RUN = 2
 	MODE_RUNSTREAM = 3
@@ -31,52 +40,59 @@ const (
 
 func main() {
 	var runtime BasicRuntime;
-	var window *sdl.Window
-	var font *ttf.Font
-	//var surface *sdl.Surface
-	//var text *sdl.Surface
+	var frontend BasicFrontend
+	var headless bool
+	var maxCallDepth int64
+	var drive string
+	var anyPath bool
+	var info os.FileInfo
+	var err error
 
-	err := sdl.Init(sdl.INIT_EVERYTHING)
-	if ( err != nil ) {
-		panic(err)
+	drive = os.Getenv(DRIVE_ENVIRONMENT_VARIABLE)
+	if ( len(drive) == 0 ) {
+		drive = "."
 	}
-	defer sdl.Quit()
 
-	err = ttf.Init()
-	if ( err != nil ) {
-		panic(err)
-	}
+	flag.BoolVar(&headless, "headless", !displayAvailable(), "Run without a window, reading from stdin and writing to stdout")
+	flag.Int64Var(&maxCallDepth, "maxdepth", DEFAULT_MAX_CALL_DEPTH, "Maximum depth of nested calls to user defined functions and subroutines")
+	flag.StringVar(&drive, "drive", drive, "Directory which programs load and save files in. $" + DRIVE_ENVIRONMENT_VARIABLE + " sets it when this isn't given")
+	flag.BoolVar(&anyPath, "anypath", false, "Allow programs to use absolute paths and .. to reach files outside of the drive directory")
+	flag.Parse()
 
-	window, err = sdl.CreateWindow(
-		"BASIC",
-		sdl.WINDOWPOS_UNDEFINED,
-		sdl.WINDOWPOS_UNDEFINED,
-		800, 600,
-		sdl.WINDOW_SHOWN)
-	if ( err != nil ) {
-		return
+	info, err = os.Stat(drive)
+	if ( err != nil || !info.IsDir() ) {
+		fmt.Fprintf(os.Stderr, "Drive %s is not a directory\n", drive)
+		os.Exit(1)
 	}
-	defer window.Destroy()
-
-	//if surface, err = window.GetSurface(); err != nil {
-	//	return
-	//}
 
-	// Load the font for our text
-	font, err = ttf.OpenFont("./fonts/C64_Pro_Mono-STYLE.ttf", 16)
-	if ( err != nil ) {
-		return
+	if ( headless == false ) {
+		frontend = new(BasicSDLFrontend)
+		err = frontend.init(&runtime)
+		if ( err != nil ) {
+			fmt.Fprintf(os.Stderr, "Unable to open a window (%s), running headless\n", err)
+			headless = true
+		}
+	}
+	if ( headless == true ) {
+		frontend = new(BasicConsoleFrontend)
+		err = frontend.init(&runtime)
+		if ( err != nil ) {
+			panic(err)
+		}
 	}
-	defer font.Close()
+	defer frontend.close()
 
-	runtime.init(window, font)
+	runtime.init(frontend)
+	runtime.maxCallDepth = maxCallDepth
+	runtime.drive.init(drive)
+	runtime.drive.anyPath = anyPath
 	
-	if ( len(os.Args) > 1 ) {
-		f := sdl.RWFromFile(os.Args[1], "r")
-		if ( f == nil ) {
-			panic(sdl.GetError())
+	if ( flag.NArg() > 0 ) {
+		f, err := os.Open(flag.Arg(0))
+		if ( err != nil ) {
+			panic(err)
 		}
-		defer io.Closer.Close(f)
+		defer f.Close()
 		runtime.run(f, MODE_RUNSTREAM)
 	} else {
 		runtime.run(os.Stdin, MODE_REPL)
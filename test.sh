@@ -11,13 +11,25 @@ for file in $(find tests -iname "*bas")
 do
     printf "${file} ... "
     output=${file%.bas}.txt
-    ${basic} ${file} > tmpfile
+    # Tests that read from the keyboard run headless, with their input
+    # coming from a .in file
+    input=${file%.bas}.in
+    # Command line options for a test are in a .args file
+    args=""
+    if [[ -f ${file%.bas}.args ]]; then
+	args=$(cat ${file%.bas}.args)
+    fi
+    if [[ -f ${input} ]]; then
+	${basic} -headless ${args} ${file} < ${input} > tmpfile
+    else
+	${basic} ${args} ${file} > tmpfile
+    fi
     if [[ $(md5sum tmpfile ${output} | cut -d ' ' -f 1 | sort -u | wc -l) -gt 1 ]]; then
 	failed=$((failed + 1))
 	echo " FAIL"
     else
 	echo " PASS"
     fi
-    rm -f tmpfile
+    rm -f tmpfile tmpfile.* TMPFILE.*
 done
 exit $failed
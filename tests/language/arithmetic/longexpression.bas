@@ -0,0 +1,4 @@
+10 PRINT 1 + 2 + 3 + 4 + 5 + 6 + 7 + 8 + 9 + 10 + 11 + 12 + 13 + 14 + 15 + 16 + 17 + 18 + 19 + 20 + 21 + 22 + 23 + 24 + 25 + 26 + 27 + 28 + 29 + 30
+20 PRINT ((((((((((((((((((((1 + 1) * 2) - 1) * 2) - 1) * 2) - 1) * 2) - 1) * 2) - 1) * 2) - 1) * 2) - 1) * 2) - 1) * 2) - 1) * 2)
+30 A# = 1 : B# = 2 : C# = 3 : D# = 4 : E# = 5 : F# = 6 : G# = 7 : H# = 8 : I# = 9 : J# = 10
+40 PRINT A# * B# + C# * D# + E# * F# + G# * H# + I# * J# + A# * B# + C# * D# + E# * F# + G# * H# + I# * J#
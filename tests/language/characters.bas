@@ -0,0 +1,13 @@
+10 A$ = CHR(195) + CHR(169)
+20 R$ = RIGHT(A$, 1)
+30 PRINT LEN(A$); " "; ASC(A$); " "; ASC(R$)
+40 PRINT A$
+50 B$ = "é": C$ = CHR(233)
+60 PRINT LEN(B$); " "; ASC(B$); " "; ( A$ == B$ ); " "; ( B$ == C$ )
+70 PRINT MID(A$, 1, 1); LEFT(A$, 1)
+80 D$ = "π←é": PRINT INSTR(D$, "é"); " "; LEN(D$)
+90 DOPEN #1, "tmpfile.seq", W: PRINT #1, A$; C$: DCLOSE #1
+100 DOPEN #1, "tmpfile.seq"
+110 GET #1, E$, F$, G$: PRINT ASC(E$); " "; ASC(F$); " "; ASC(G$)
+120 DCLOSE #1
+130 SCRATCH "tmpfile.seq"
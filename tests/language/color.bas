@@ -0,0 +1,20 @@
+10 TRAP 500
+20 FOR I# = 0 TO 6: PRINT RCLR(I#); " ";: NEXT I#
+30 PRINT
+40 COLOR 0, 7: COLOR 4, 15: COLOR 5, 8
+50 PRINT "BACKGROUND "; RCLR(0); " BORDER "; RCLR(4); " TEXT "; RCLR(5)
+60 PRINT CHR(28) + "RED" + CHR(5) + " WHITE" + CHR(158)
+70 PRINT "TEXT "; RCLR(5)
+80 PRINT CHR(30) + "A", "B"
+90 GRAPHIC 1, 1
+100 COLOR 1, 3: DRAW 1, 0, 0
+110 COLOR 1, 4: DRAW 1, 1, 0
+120 LOCATE 0, 0: PRINT "PIXEL "; RDOT(2); " FOREGROUND "; RCLR(1)
+130 GRAPHIC 0
+140 COLOR 7, 1
+150 COLOR 1, 17
+160 COLOR 1, 0
+170 PRINT RCLR(9)
+180 QUIT
+500 PRINT ERR(ER); " ERROR"
+510 RESUME NEXT
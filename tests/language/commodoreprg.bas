@@ -0,0 +1,2 @@
+10 REM Load a program saved on a C64, which runs once it is loaded
+20 DLOAD "tests/language/commodoreprg.prg"
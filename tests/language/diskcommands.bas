@@ -0,0 +1,20 @@
+10 DOPEN #1, "tmpfile.one", W
+20 PRINT #1, "ONE"
+30 DCLOSE #1
+40 COPY "tmpfile.one" TO "tmpfile.two"
+50 CONCAT "tmpfile.one" TO "tmpfile.two"
+60 RENAME "tmpfile.one" TO "tmpfile.three"
+70 DIRECTORY "tmpfile.*"
+80 DOPEN #1, "tmpfile.two"
+90 INPUT #1, A$, B$
+100 DCLOSE #1
+110 PRINT A$; " "; B$
+120 TRAP 200
+130 COPY "tmpfile.nosuchfile" TO "tmpfile.four"
+140 RENAME "tmpfile.two" TO "tmpfile.three"
+150 CATALOG "../*"
+160 SCRATCH "tmpfile.*"
+170 CATALOG "tmpfile.*"
+180 QUIT
+200 PRINT ERR(ER); " ERROR IN "; EL
+210 RESUME NEXT
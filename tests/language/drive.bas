@@ -0,0 +1,14 @@
+10 TRAP 100
+20 DOPEN #1, "/etc/passwd"
+30 DOPEN #1, "../tmpfile.seq", W
+40 DSAVE "/tmp/tmpfile.bas"
+50 DLOAD "tests/../../tmpfile.bas"
+60 DOPEN #1, "tests/../tmpfile.seq", W: PRINT #1, "INSIDE": DCLOSE
+70 DOPEN #1, "tmpfile.seq": INPUT #1, A$: DCLOSE: PRINT A$
+72 DOPEN #1, "tests/language/outside/tmpfile.seq", W
+74 DOPEN #1, "tests/language/outside/drive.bas"
+76 DOPEN #1, "tests/language/dangling", W
+78 DOPEN #1, "tests/language/../language/drive.bas": DCLOSE: PRINT "LINK CHECK PASSED"
+80 QUIT
+100 PRINT ERR(ER); " ERROR IN "; EL
+110 RESUME NEXT
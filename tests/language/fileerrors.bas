@@ -0,0 +1,10 @@
+10 TRAP 100
+20 DOPEN #1, "tests", W
+30 DOPEN #1, "tests", L20
+40 DOPEN #1, "tests": INPUT #1, A$
+50 DCLOSE #1
+60 DOPEN #2, "/dev/full", W: PRINT #2, "FULL": DCLOSE #2
+70 PRINT "DONE"
+80 QUIT
+100 PRINT ERR(ER); " ERROR IN "; EL
+110 RESUME NEXT
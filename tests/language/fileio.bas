@@ -0,0 +1,17 @@
+10 DOPEN #1, "tmpfile.seq", W
+20 PRINT #1, "HELLO"; ","; 42
+30 PRINT #1, "A,B"
+40 DCLOSE #1
+50 DOPEN #1, "tmpfile.seq", A
+60 PRINT #1, "END";
+70 DCLOSE
+80 DOPEN #2, "tmpfile.seq"
+90 INPUT #2, A$, B#
+100 PRINT A$; " "; B#; " "; ST
+110 INPUT #2, C$, D$
+120 PRINT C$; " "; D$; " "; ST
+130 GET #2, E$
+140 PRINT E$; " "; ST
+150 IF ST == 0 THEN GOTO 130
+160 DCLOSE #2
+170 DOPEN #1, "tmpfile.nosuchfile"
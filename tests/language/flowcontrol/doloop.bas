@@ -0,0 +1,42 @@
+10 I# = 0
+20 DO WHILE I# < 3
+30     PRINT "WHILE " + I#
+40     I# = I# + 1
+50 LOOP
+60 DO
+70     PRINT "UNTIL " + I#
+80     I# = I# - 1
+90 LOOP UNTIL I# == 0
+100 DO UNTIL I# == 0
+110     PRINT "DO UNTIL FAILS if this is seen"
+120 LOOP
+130 DO
+140     I# = I# + 1
+150     IF I# == 2 THEN EXIT
+160     PRINT "EXIT " + I#
+170 LOOP
+180 PRINT "AFTER EXIT " + I#
+185 J# = 0 : DO WHILE J# < 2 : J# = J# + 1 : K# = 0
+190 DO : K# = K# + 1 : PRINT "NESTED " + J# + " " + K# : LOOP WHILE K# < 2 : LOOP
+200 FOR N# = 1 TO 2
+210     M# = 0
+220     DO WHILE M# < N#
+230         M# = M# + 1
+240         PRINT "FOR " + N# + " DO " + M#
+250     LOOP
+260 NEXT N#
+270 DO WHILE 1 == 2
+280     DO
+290         PRINT "SKIPPED NESTED DO FAILS if this is seen"
+300     LOOP
+310     PRINT "SKIPPED DO FAILS if this is seen"
+320 LOOP
+330 FOR N# = 1 TO 5
+340     IF N# == 3 THEN EXIT
+350     PRINT "FOR EXIT " + N#
+360 NEXT N#
+362 REM A variable first set inside a loop is still there after it
+364 DO : K# = 5 : EXIT : LOOP
+366 PRINT "K# AFTER LOOP " + K#
+370 PRINT "DONE"
+380 QUIT
@@ -0,0 +1,8 @@
+10 PRINT "START"
+20 GOTO 63000
+30 PRINT "SKIPPED"
+40000 PRINT "IN SUBROUTINE"
+40010 RETURN
+63000 PRINT "HIGH LINE"
+63010 GOSUB 40000
+63999 PRINT "LAST LINE"
@@ -0,0 +1,13 @@
+10 PRINT "ONE" : PRINT "TWO"
+20 A# = 5 : B# = A# * 2 : PRINT B#
+30 PRINT "COLON : IN A STRING"
+40 FOR I# = 1 TO 3 : PRINT I# : NEXT I#
+50 GOSUB 200 : PRINT "BACK FROM GOSUB"
+60 IF A# == 5 THEN PRINT "A# IS 5" : PRINT "STILL TRUE" : ELSE PRINT "A# IS NOT 5"
+70 IF A# == 6 THEN PRINT "A# IS 6" : ELSE PRINT "A# IS NOT 6" : PRINT "STILL FALSE"
+80 IF A# == 6 THEN PRINT "SHOULD NOT SEE THIS" : PRINT "OR THIS"
+90 GOTO 110 : PRINT "SHOULD NOT SEE THIS EITHER"
+100 PRINT "SKIPPED"
+110 PRINT "DONE" : REM A COMMENT : PRINT "NOT A STATEMENT"
+120 QUIT
+200 PRINT "IN GOSUB" : RETURN
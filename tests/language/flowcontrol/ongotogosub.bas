@@ -0,0 +1,16 @@
+5 LABEL THIRD
+6 IF I# == 3 THEN PRINT "THREE" : GOTO 40
+10 FOR I# = 0 TO 4
+20     ON I# GOTO 100, 200, THIRD
+30     PRINT "FELL THROUGH " + I#
+40 NEXT I#
+50 FOR I# = 1 TO 3
+60     ON I# GOSUB 400, 500, 600 : PRINT "BACK FROM GOSUB " + I#
+70 NEXT I#
+80 PRINT "DONE"
+90 QUIT
+100 PRINT "ONE" : GOTO 40
+200 PRINT "TWO" : GOTO 40
+400 PRINT "GOSUB ONE" : RETURN
+500 PRINT "GOSUB TWO" : RETURN
+600 PRINT "GOSUB THREE" : RETURN
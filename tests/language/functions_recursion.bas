@@ -0,0 +1,8 @@
+10 DEF FIB(N#)
+20 IF N# < 2 THEN RETURN N#
+30 RETURN FIB(N# - 1) + FIB(N# - 2)
+40 DEF FOREVER(N#)
+50 RETURN FOREVER(N# + 1)
+60 PRINT "FIB(15) = " + FIB(15)
+70 PRINT FOREVER(1)
+80 PRINT "STACK OVERFLOW FAILS if this is seen"
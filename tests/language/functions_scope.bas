@@ -0,0 +1,18 @@
+10 A# = 1
+20 B# = 2
+30 C# = 3
+40 DEF SETLOCALS(A#)
+50 B# = 20
+60 GLOBAL C#
+70 C# = 30
+80 PRINT "INSIDE : A# = " + A# + " B# = " + B# + " C# = " + C#
+90 RETURN 0
+100 DEF FACTORIAL(N#)
+110 IF N# <= 1 THEN RETURN 1
+120 RETURN N# * FACTORIAL(N# - 1)
+130 DEF MULTIPLY(X#) = X# * C#
+140 X# = SETLOCALS(10)
+150 PRINT "OUTSIDE : A# = " + A# + " B# = " + B# + " C# = " + C#
+160 PRINT "FACTORIAL(5) = " + FACTORIAL(5)
+170 PRINT "MULTIPLY(2) = " + MULTIPLY(2)
+180 QUIT
@@ -0,0 +1,43 @@
+10 TRAP 500
+20 DRAW 1, 10, 10
+30 PRINT "MODE "; RGR(0)
+40 GRAPHIC 1, 1
+50 PRINT "MODE "; RGR(0)
+60 DRAW 1, 10, 10 TO 100, 10 TO 100, 50
+70 PRINT "CURSOR "; RDOT(0); ","; RDOT(1)
+80 LOCATE 55, 10: PRINT "LINE "; RDOT(2)
+90 LOCATE 100, 30: PRINT "LINE "; RDOT(2)
+100 LOCATE 55, 11: PRINT "OFF LINE "; RDOT(2)
+110 BOX 1, 150, 20, 200, 60
+120 LOCATE 150, 40: PRINT "BOX SIDE "; RDOT(2)
+130 LOCATE 175, 40: PRINT "BOX INSIDE "; RDOT(2)
+140 PAINT 2, 175, 40, 1
+150 LOCATE 175, 40: PRINT "PAINTED "; RDOT(2)
+160 LOCATE 140, 40: PRINT "OUTSIDE "; RDOT(2)
+170 BOX 3, 10, 100, 40, 130, 0, 1
+180 LOCATE 25, 115: PRINT "FILLED "; RDOT(2)
+190 CIRCLE 1, 250, 150, 30
+200 LOCATE 250, 120: PRINT "CIRCLE TOP "; RDOT(2)
+210 LOCATE 280, 150: PRINT "CIRCLE RIGHT "; RDOT(2)
+220 LOCATE 250, 150: PRINT "CIRCLE CENTRE "; RDOT(2)
+230 CIRCLE 1, 60, 170, 20, 10, 0, 90
+240 LOCATE 60, 160: PRINT "ARC TOP "; RDOT(2)
+250 LOCATE 60, 180: PRINT "ARC BOTTOM "; RDOT(2)
+260 SCALE 1
+270 DRAW 1, 0, 1023 TO 1023, 1023
+280 SCALE 0
+290 LOCATE 160, 199: PRINT "SCALED "; RDOT(2)
+300 DRAW 5, 0, 0
+302 BOX 1, 100, 100, 140, 140, 45
+304 LOCATE 120, 92: PRINT "ROTATED "; RDOT(2)
+305 BOX 1, 300, 180, 100000, 100000, 0, 1: LOCATE 319, 199: PRINT "CLIPPED BOX "; RDOT(2)
+306 DRAW 1, -100, 170 TO 2000000000, 170: LOCATE 0, 170: PRINT "CLIPPED LINE "; RDOT(2)
+307 GRAPHIC 3, 1
+308 LOCATE 159, 0: DRAW 3 TO 159, 10: PRINT "MULTICOLOR "; RDOT(2)
+310 GRAPHIC 0
+320 PRINT "MODE "; RGR(0)
+330 GRAPHIC CLR
+340 BOX 1, 0, 0, 10, 10
+350 QUIT
+500 PRINT ERR(ER); " ERROR"
+510 RESUME NEXT
@@ -0,0 +1,15 @@
+10 INPUT "NAME"; N$
+20 INPUT "AGE, HEIGHT"; A#, H%
+30 PRINT N$; " IS "; A#; " AND "; H%
+40 INPUT X$, Y#
+50 PRINT X$; Y#
+60 DIM Z#(3)
+70 INPUT Z#(1)
+80 PRINT Z#(1)
+90 GET K$: IF K$ == "" THEN GOTO 90
+100 GETKEY L$
+110 GET D#: IF D# == 0 THEN GOTO 110
+115 GETKEY R$
+120 PRINT K$; L$; D#; ASC(R$)
+130 INPUT "OLD STYLE" O$
+140 PRINT O$
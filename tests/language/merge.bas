@@ -0,0 +1,16 @@
+10 Q$ = CHR(34)
+20 DOPEN #1, "tmpfile.lib", W
+30 PRINT #1, "500 PRINT " + Q$ + "MERGED" + Q$ + ": RETURN"
+40 PRINT #1, "1000 PRINT " + Q$ + "LIBRARY" + Q$ + ": RETURN"
+50 DCLOSE #1
+60 GOSUB 500
+70 MERGE "tmpfile.lib"
+80 GOSUB 500
+90 GOSUB 1000
+100 DOPEN #1, "tmpfile.lib", W
+110 PRINT #1, "1000 PRINT " + Q$ + "APPENDED" + Q$ + ": RETURN"
+120 DCLOSE #1
+130 APPEND "tmpfile.lib"
+140 GOSUB 1000
+150 QUIT
+500 PRINT "ORIGINAL": RETURN
@@ -0,0 +1,26 @@
+10 A$ = "HELLO"
+20 B# = 42
+30 PRINT A$; B#
+40 PRINT A$, B#, "X"
+50 PRINT "NO NEWLINE";
+60 PRINT " CONTINUED"
+70 PRINT "A"; TAB(10); "B"; SPC(3); "C"
+80 PRINT
+90 PRINT USING "###.##"; 3.14159
+100 PRINT USING "#,###,###"; 1234567
+110 PRINT USING "+##.#"; 5
+120 PRINT USING "##.#-"; -5
+130 PRINT USING "##"; 1234
+140 PRINT USING "TOTAL: $###.##!"; 12.5
+150 PRINT USING ">#####"; "AB"
+160 PRINT USING "=#####"; "AB"
+170 PRINT USING "#####"; "ABCDEFGH"
+180 PRINT USING "##.##^^^^"; 12345.678
+190 PRINT USING "###"; 1, 2;
+200 PRINT "END"
+202 PRINT USING "### ##.#"; 1, 2.5, 3
+204 PRINT USING "A:## B:##!"; 1, 2, 3
+206 PRINT USING "(##)"; "AB", 7
+210 IF B# == 42 THEN PRINT "YES"; "!" ELSE PRINT "NO"
+220 PRINT ,"ZONE"
+230 PRINT TAB(5) "X"
@@ -0,0 +1,22 @@
+10 DOPEN #2, "tmpfile.rel", L20
+20 FOR I# = 1 TO 3
+30 RECORD #2, I#
+40 PRINT #2, "ITEM" + I#; ","; I# * 10
+50 NEXT I#
+60 RECORD #2, 2, 5
+70 PRINT #2, "Z";
+80 DCLOSE #2
+90 DOPEN #2, "tmpfile.rel", L20
+100 FOR I# = 3 TO 1 STEP -1
+110 RECORD#2, I#
+120 INPUT #2, N$, Q#
+130 PRINT N$; " "; Q#; " "; ST
+140 NEXT I#
+150 RECORD #2, 2, 5
+160 GET #2, A$, B$
+170 PRINT A$; B$; " "; ST
+180 RECORD #2, 9
+190 INPUT #2, N$
+200 PRINT ST
+210 RECORD #2, 1
+220 PRINT #2, "THIS IS FAR TOO LONG FOR A RECORD"
@@ -0,0 +1,3 @@
+10 PRINT "A"
+20 RENUMBER
+30 PRINT "B"
@@ -0,0 +1,23 @@
+10 DATA 1, 2, 3
+20 READ A#, B#
+30 PRINT A# + B#
+40 READ C#, D$
+50 PRINT C#
+60 PRINT D$
+70 RESTORE
+80 READ A#
+90 PRINT A#
+100 RESTORE 200
+110 READ D$, E%
+120 PRINT D$
+130 PRINT E%
+140 GOSUB 300
+150 TRAP 400
+160 READ A#
+170 PRINT "NOT REACHED"
+200 DATA "SECOND", 2.5 : DATA "THIRD"
+210 QUIT
+300 READ D$ : PRINT D$ : RETURN
+400 PRINT ER
+410 PRINT ERR(ER)
+420 QUIT
@@ -0,0 +1,24 @@
+10 TRAP 500
+20 PRINT CHR(147);
+30 PRINT "HELLO"
+40 A# = 1024: PRINT "H "; PEEK(A#)
+50 CHAR 1, 10, 5, "ABC"
+60 A# = 1234: B# = 1236: C# = 55506
+70 PRINT "CHAR "; PEEK(A#); " "; PEEK(B#); " COLOUR "; PEEK(C#)
+80 POKE A#, 26: POKE C#, 2: PRINT "POKE "; PEEK(A#); " "; PEEK(C#)
+90 PRINT CHR(147); CHR(17); CHR(29); "X";
+100 A# = 1065: PRINT " CURSOR "; PEEK(A#)
+105 CHAR 1, 20, 0, "Q"
+110 WINDOW 0, 20, 9, 24, 1
+120 PRINT RWINDOW(0); " "; RWINDOW(1); " "; RWINDOW(2)
+130 FOR I# = 1 TO 6: PRINT I#: NEXT I#
+140 A# = 1824: B# = 1984: C# = 1044: PRINT "SCROLLED "; PEEK(A#); " "; PEEK(B#); " OUTSIDE "; PEEK(C#)
+150 PRINT CHR(19); CHR(19);
+160 PRINT "WHOLE SCREEN "; RWINDOW(0); " "; RWINDOW(1)
+170 GRAPHIC 5: PRINT "COLUMNS "; RWINDOW(2): GRAPHIC 0
+180 PRINT "BEFORE";: SCNCLR: A# = 1024: PRINT " CLEARED "; PEEK(A#)
+190 WINDOW 10, 0, 5, 5
+200 CHAR 1, 40, 0, "X"
+210 QUIT
+500 PRINT ERR(ER); " ERROR"
+510 RESUME NEXT
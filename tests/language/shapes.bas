@@ -0,0 +1,51 @@
+10 TRAP 500
+20 GRAPHIC 1, 1
+30 BOX 1, 0, 0, 3, 3
+40 SSHAPE A$, 0, 0, 3, 3
+50 PRINT "LENGTH "; LEN(A$)
+60 GSHAPE A$, 10, 10
+70 LOCATE 10, 10: PRINT "REPLACE EDGE "; RDOT(2)
+80 LOCATE 11, 11: PRINT "REPLACE INSIDE "; RDOT(2)
+90 GSHAPE A$, 10, 10, 1
+100 LOCATE 10, 10: PRINT "INVERT EDGE "; RDOT(2)
+110 LOCATE 11, 11: PRINT "INVERT INSIDE "; RDOT(2)
+120 GSHAPE A$, 10, 10, 4
+130 LOCATE 10, 10: PRINT "XOR EDGE "; RDOT(2)
+140 LOCATE 11, 11: PRINT "XOR INSIDE "; RDOT(2)
+150 GSHAPE A$, 10, 10, 3
+160 LOCATE 10, 10: PRINT "AND EDGE "; RDOT(2)
+170 LOCATE 11, 11: PRINT "AND INSIDE "; RDOT(2)
+180 DRAW 1, 21, 21
+190 GSHAPE A$, 20, 20, 2
+200 LOCATE 20, 20: PRINT "OR EDGE "; RDOT(2)
+210 LOCATE 21, 21: PRINT "OR INSIDE "; RDOT(2)
+220 LOCATE 30, 30: GSHAPE A$
+230 LOCATE 33, 33: PRINT "AT CURSOR "; RDOT(2)
+240 SSHAPE B$, 0, 0, 23, 20
+250 SPRSAV B$, 1
+260 SPRSAV 1, C$
+270 PRINT "SPRITE "; ( B$ == C$ )
+271 H$ = CHR(255): PRINT "CHR LENGTH "; LEN(H$); " ASC "; ASC(CHR(200))
+272 F$ = "": L# = LEN(A$) - 1
+273 FOR I# = 0 TO L#: G$ = MID(A$, I#, 1): F$ = F$ + CHR(ASC(G$)): NEXT I#
+274 PRINT "CHR COPY "; ( F$ == A$ ); " "; LEN(F$)
+275 GSHAPE F$, 50, 50: LOCATE 50, 50: PRINT "CHR COPY EDGE "; RDOT(2)
+276 LOCATE 51, 51: PRINT "CHR COPY INSIDE "; RDOT(2)
+280 GRAPHIC 3, 1
+290 DRAW 2, 5, 5
+300 SSHAPE D$, 5, 5, 6, 5
+310 PRINT "MULTICOLOR LENGTH "; LEN(D$)
+320 GSHAPE D$, 40, 40
+330 LOCATE 40, 40: PRINT "MULTICOLOR "; RDOT(2)
+340 LOCATE 41, 40: PRINT "MULTICOLOR NEXT "; RDOT(2)
+350 GSHAPE "AB", 0, 0
+360 GSHAPE D$, 0, 0, 5
+370 SSHAPE 5, 0, 0
+372 SSHAPE E$, 150, 190, 20000, 20000
+374 PRINT "CLAMPED LENGTH "; LEN(E$)
+376 SSHAPE E$, 400, 0, 500, 10
+380 GRAPHIC CLR
+390 GSHAPE D$, 0, 0
+400 QUIT
+500 PRINT ERR(ER); " ERROR"
+510 RESUME NEXT
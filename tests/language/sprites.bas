@@ -0,0 +1,31 @@
+10 TRAP 500
+20 PRINT CHR(147);
+30 SPRDEF 1
+40 SPRSAV 1, A$: PRINT "SHAPE "; LEN(A$)
+50 SPRSAV A$, 2
+60 MOVSPR 1, 100, 200: MOVSPR 2, 200, 200
+70 SPRITE 1, 1, 3: SPRITE 2, 1, 4
+80 PRINT "START "; BUMP(1); " "; BUMP(2)
+90 PRINT "AT "; RSPPOS(1, 0); " "; RSPPOS(1, 1)
+100 MOVSPR 1, +10, -20: PRINT "RELATIVE "; RSPPOS(1, 0); " "; RSPPOS(1, 1)
+110 MOVSPR 1, 10 ; 90: PRINT "EAST "; RSPPOS(1, 0); " "; RSPPOS(1, 1)
+120 MOVSPR 1, 10 ; 180: PRINT "SOUTH "; RSPPOS(1, 0); " "; RSPPOS(1, 1)
+130 MOVSPR 1, 90 # 5: PRINT "SPEED "; RSPPOS(1, 2)
+140 MOVSPR 1, 0 # 0: MOVSPR 1, 100, 200
+150 COLLISION 1, 400
+160 MOVSPR 2, 110, 210
+170 PRINT "AFTER "; BUMP(1)
+180 COLLISION 1
+190 MOVSPR 2, 300, 200
+200 CHAR 1, 0, 20, "X"
+210 MOVSPR 1, 24, 210
+220 PRINT "BACKGROUND "; BUMP(2)
+230 SPRSAV 2, B$: PRINT "SAME "; A$ == B$
+240 SPRITE 9
+250 MOVSPR 1, 600, 0
+260 MOVSPR 1, 0 # 16
+270 QUIT
+400 PRINT "HIT "; BUMP(1)
+410 RETURN
+500 PRINT ERR(ER); " ERROR"
+510 RESUME NEXT
@@ -0,0 +1,14 @@
+10 REM SAVE and DSAVE this program, then check that both copies match it
+20 TRAP 200
+30 SAVE "tmpfile.prg"
+40 VERIFY "tmpfile.prg"
+50 PRINT "TOKENIZED COPY VERIFIED"
+60 DSAVE "tmpfile.txt"
+70 DVERIFY "tmpfile.txt"
+80 PRINT "TEXT COPY VERIFIED"
+90 DOPEN #1, "tmpfile.other", W: PRINT #1, "10 PRINT "; CHR(34); "SOMETHING ELSE"; CHR(34): DCLOSE #1
+100 VERIFY "tmpfile.other"
+110 PRINT "DONE"
+120 QUIT
+200 PRINT ERR(ER); " ERROR IN "; EL
+210 RESUME NEXT
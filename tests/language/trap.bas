@@ -0,0 +1,22 @@
+10 TRAP 1000
+20 PRINT "ER IS " + ER + " BEFORE ANY ERROR"
+30 D# = 0
+40 A# = 10 / D#
+50 PRINT "RESUMED AT 50, A# IS " + A#
+52 E% = 0.0
+54 C% = 1.5 / E%
+56 PRINT "FLOAT DIVISION BY ZERO IS TRAPPED"
+60 DIM B#(3)
+70 B#(5) = 1 : PRINT "RESUME NEXT CONTINUES WITH THE NEXT STATEMENT"
+80 PRINT "AFTER 70"
+90 RETURN
+100 PRINT "RESUMED AT 100"
+110 PRINT ERR(22)
+120 TRAP
+130 PRINT "TRAP IS OFF"
+140 QUIT
+1000 PRINT "ERROR " + ER + " AT LINE " + EL + " : " + ERR(ER)
+1005 IF EL == 54 THEN RESUME NEXT
+1010 IF ER == 20 THEN D# = 2 : RESUME
+1020 IF ER == 18 THEN RESUME NEXT
+1030 RESUME 100
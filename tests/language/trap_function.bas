@@ -0,0 +1,15 @@
+10 TRAP 1000
+20 DEF F(N#)
+30 Z# = 0: RETURN N# / Z#
+40 DEF G(N#)
+50 RETURN F(N#) + 1
+60 DEF H(N#) = 10 / N#
+70 DEF OK(N#)
+80 RETURN N# * 2
+100 PRINT G(4)
+110 PRINT H(0)
+120 PRINT F(1)
+130 PRINT "OK "; OK(21)
+140 QUIT
+1000 PRINT "TRAPPED " + ER + " AT " + EL
+1010 RESUME NEXT
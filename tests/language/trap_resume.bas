@@ -0,0 +1,10 @@
+0 IF ER == 0 THEN GOTO 10
+1 PRINT "TRAPPED ON LINE 0: ERROR " + ER + " IN LINE " + EL : RESUME NEXT
+10 TRAP 0
+20 D# = 0
+30 A# = 10 / D# : PRINT "RESUME NEXT CONTINUES IN LINE 30"
+40 PRINT "AFTER RESUME NEXT ER IS " + ER + ", EL IS " + EL + " AND ERR(ER) IS " + ERR(ER)
+50 DIM B#(3) : B#(5) = 1
+60 PRINT "AFTER ANOTHER ERROR ER IS " + ER + ", EL IS " + EL + " AND ERR(ER) IS " + ERR(ER)
+70 TRAP
+80 QUIT